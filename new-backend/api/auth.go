@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+	"github.com/ishikabhoyar/monaco/new-backend/auth"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// authenticated wraps a handler that needs to know its caller. The caller's
+// identity is stored in the request context; role, if not empty, must be
+// held by it. Without authentication configured every request passes.
+func (h *Handler) authenticated(next http.HandlerFunc, role string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.auth == nil {
+			next(w, r)
+			return
+		}
+
+		id, err := h.auth.Authenticate(credential(r))
+		if err != nil {
+			if !errors.Is(err, auth.ErrInvalidCredentials) {
+				slog.Error("authentication failed", logging.Err(err))
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="monaco"`)
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		if role != "" && !id.HasRole(role) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		next(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	}
+}
+
+// credential returns the API key or bearer token sent with r. Browsers cannot
+// set headers on WebSocket handshakes, so those may pass it as ?token=.
+func credential(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	if header := r.Header.Get("Authorization"); len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:])
+	}
+	if websocket.IsWebSocketUpgrade(r) {
+		return r.URL.Query().Get("token")
+	}
+	return ""
+}
+
+// isSubmitter reports whether the caller of r made the submission. It is
+// always true without authentication.
+func isSubmitter(r *http.Request, submission *models.CodeSubmission) bool {
+	id := auth.FromContext(r.Context())
+	return id == nil || id.Subject == submission.UserID
+}
+
+// mayJumpQueue reports whether the caller of r may submit with high priority:
+// a configured API key, such as an exam system's, or an admin. Without
+// authentication nobody may.
+func mayJumpQueue(r *http.Request) bool {
+	id := auth.FromContext(r.Context())
+	return id != nil && (id.APIKey || id.HasRole(config.RoleAdmin))
+}
+
+// canAccess reports whether the caller of r may act on a submission: its
+// submitter, or anyone holding role
+func canAccess(r *http.Request, submission *models.CodeSubmission, role string) bool {
+	if isSubmitter(r, submission) {
+		return true
+	}
+	return auth.FromContext(r.Context()).HasRole(role)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ishikabhoyar/monaco/new-backend/auth"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+const testSecret = "test-secret"
+
+// newAuthHandler returns a handler authenticating an admin API key, a viewer
+// API key and HS256 tokens signed with testSecret
+func newAuthHandler(t *testing.T) *Handler {
+	t.Helper()
+	keyFile := filepath.Join(t.TempDir(), "jwt.key")
+	if err := os.WriteFile(keyFile, []byte(testSecret), 0600); err != nil {
+		t.Fatal(err)
+	}
+	a, err := auth.New(config.AuthConfig{
+		Enabled: true,
+		APIKeys: []config.APIKeyConfig{
+			{Key: "admin-key", Subject: "grader", Roles: []string{config.RoleAdmin}},
+			{Key: "viewer-key", Subject: "dashboard", Roles: []string{config.RoleViewer}},
+		},
+		JWT: config.JWTConfig{Algorithm: config.JWTHS256, KeyFile: keyFile},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Handler{auth: a}
+}
+
+// token returns an HS256 token for subject with the given roles that expires
+// after ttl, which may be negative
+func token(t *testing.T, secret, subject string, roles []string, ttl time.Duration) string {
+	t.Helper()
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   subject,
+		"roles": roles,
+		"exp":   time.Now().Add(ttl).Unix(),
+	}).SignedString([]byte(secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// serve runs r through h.authenticated and returns the response and the
+// identity the wrapped handler saw, nil if it was not called
+func serve(h *Handler, r *http.Request, role string) (*httptest.ResponseRecorder, *auth.Identity, bool) {
+	var seen *auth.Identity
+	called := false
+	handler := h.authenticated(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+		seen = auth.FromContext(r.Context())
+	}, role)
+
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w, seen, called
+}
+
+func TestAuthenticated(t *testing.T) {
+	h := newAuthHandler(t)
+	viewerToken := token(t, testSecret, "alice", []string{config.RoleViewer}, time.Hour)
+
+	tests := []struct {
+		name        string
+		header      string
+		value       string
+		role        string
+		wantStatus  int
+		wantSubject string
+	}{
+		{"missing header", "", "", "", http.StatusUnauthorized, ""},
+		{"missing header for admin route", "", "", config.RoleAdmin, http.StatusUnauthorized, ""},
+		{"bearer token", "Authorization", "Bearer " + viewerToken, "", http.StatusOK, "alice"},
+		{"lowercase bearer", "Authorization", "bearer " + viewerToken, config.RoleViewer, http.StatusOK, "alice"},
+		{"basic credentials", "Authorization", "Basic YWxpY2U6c2VjcmV0", "", http.StatusUnauthorized, ""},
+		{"empty bearer", "Authorization", "Bearer ", "", http.StatusUnauthorized, ""},
+		{"expired token", "Authorization",
+			"Bearer " + token(t, testSecret, "alice", nil, -time.Minute), "", http.StatusUnauthorized, ""},
+		{"wrong signature", "Authorization",
+			"Bearer " + token(t, "other-secret", "alice", nil, time.Hour), "", http.StatusUnauthorized, ""},
+		{"wrong role", "Authorization", "Bearer " + viewerToken, config.RoleAdmin, http.StatusForbidden, ""},
+		{"API key", "X-API-Key", "viewer-key", config.RoleViewer, http.StatusOK, "dashboard"},
+		{"API key with wrong role", "X-API-Key", "viewer-key", config.RoleAdmin, http.StatusForbidden, ""},
+		{"admin API key", "X-API-Key", "admin-key", config.RoleAdmin, http.StatusOK, "grader"},
+		{"unknown API key", "X-API-Key", "guess", "", http.StatusUnauthorized, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/languages", nil)
+			if tt.header != "" {
+				r.Header.Set(tt.header, tt.value)
+			}
+
+			w, id, called := serve(h, r, tt.role)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantStatus == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("401 without a WWW-Authenticate header")
+			}
+			if called != (tt.wantStatus == http.StatusOK) {
+				t.Fatalf("handler called = %v, want %v", called, tt.wantStatus == http.StatusOK)
+			}
+			if called && (id == nil || id.Subject != tt.wantSubject) {
+				t.Errorf("identity = %+v, want subject %q", id, tt.wantSubject)
+			}
+		})
+	}
+}
+
+func TestAuthenticatedQueryToken(t *testing.T) {
+	h := newAuthHandler(t)
+	viewerToken := token(t, testSecret, "alice", nil, time.Hour)
+
+	// Only WebSocket handshakes may pass the token in the URL
+	r := httptest.NewRequest(http.MethodGet, "/api/status/1?token="+viewerToken, nil)
+	if w, _, _ := serve(h, r, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("plain request with ?token: status = %d, want 401", w.Code)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/api/ws/terminal/1?token="+viewerToken, nil)
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	if w, id, _ := serve(h, r, ""); w.Code != http.StatusOK || id == nil || id.Subject != "alice" {
+		t.Errorf("WebSocket handshake with ?token: status = %d, identity = %+v", w.Code, id)
+	}
+}
+
+func TestAuthenticatedDisabled(t *testing.T) {
+	h := &Handler{}
+	r := httptest.NewRequest(http.MethodPost, "/api/admin/reload", nil)
+
+	w, id, called := serve(h, r, config.RoleAdmin)
+	if w.Code != http.StatusOK || !called {
+		t.Fatalf("status = %d, called = %v; want every request to pass", w.Code, called)
+	}
+	if id != nil {
+		t.Errorf("identity = %+v, want none without authentication", id)
+	}
+}
+
+func TestMayJumpQueue(t *testing.T) {
+	tests := []struct {
+		name string
+		id   *auth.Identity
+		want bool
+	}{
+		{"no authentication", nil, false},
+		{"token", &auth.Identity{Subject: "alice", Roles: []string{config.RoleViewer}}, false},
+		{"admin token", &auth.Identity{Subject: "alice", Roles: []string{config.RoleAdmin}}, true},
+		{"API key", &auth.Identity{Subject: "grader", APIKey: true}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/submit", nil)
+			if tt.id != nil {
+				r = r.WithContext(auth.WithIdentity(r.Context(), tt.id))
+			}
+			if got := mayJumpQueue(r); got != tt.want {
+				t.Errorf("mayJumpQueue = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
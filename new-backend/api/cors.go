@@ -0,0 +1,103 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/rs/cors"
+)
+
+// exposedHeaders are the response headers browser clients may read
+var exposedHeaders = []string{"Retry-After", "X-Queue-Depth", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"}
+
+// preflightMaxAge is how long browsers may cache a preflight response, in seconds
+const preflightMaxAge = 300
+
+// originPolicy decides which pages may call the API. It is shared by the CORS
+// middleware and the WebSocket upgrader, so both enforce the same origins.
+type originPolicy struct {
+	allowAll bool
+	origins  []string // Lower-cased, each with at most one "*" starting a label
+}
+
+// newOriginPolicy creates a policy allowing the given origins
+func newOriginPolicy(origins []string) *originPolicy {
+	policy := &originPolicy{}
+	for _, origin := range origins {
+		if origin == "*" {
+			policy.allowAll = true
+		}
+		policy.origins = append(policy.origins, strings.ToLower(origin))
+	}
+	return policy
+}
+
+// allowed reports whether a page from origin may send r. Requests without an
+// Origin header do not come from a browser page, and a page served by this
+// server is always allowed.
+func (p *originPolicy) allowed(r *http.Request, origin string) bool {
+	if origin == "" || p.allowAll {
+		return true
+	}
+	if u, err := url.Parse(origin); err == nil && strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	for _, pattern := range p.origins {
+		if matchOrigin(pattern, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchOrigin matches origin against an allowed origin. A "*" wildcard stands
+// for exactly one subdomain label, so "https://*.example.com" matches
+// "https://a.example.com" but neither "https://a.b.example.com" nor
+// "https://evilexample.com".
+func matchOrigin(pattern, origin string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return pattern == origin
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	if !strings.HasPrefix(suffix, ".") || len(origin) <= len(prefix)+len(suffix) ||
+		!strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	// The wildcard ends at the dot that starts suffix; it must stay in one label
+	label := origin[len(prefix) : len(origin)-len(suffix)]
+	return !strings.ContainsAny(label, "./:@")
+}
+
+// checkWebSocketOrigin is the upgrader's CheckOrigin. Refusing foreign
+// origins stops other sites from hijacking a user's terminal.
+func (p *originPolicy) checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if p.allowed(r, origin) {
+		return true
+	}
+	slog.Warn("rejected WebSocket connection", "origin", origin, "path", r.URL.Path)
+	return false
+}
+
+// newCORS creates the CORS middleware for the server configuration
+func newCORS(cfg config.ServerConfig, policy *originPolicy) *cors.Cors {
+	return cors.New(cors.Options{
+		AllowOriginRequestFunc: policy.allowed,
+		AllowedMethods:         cfg.AllowedMethods,
+		AllowedHeaders:         cfg.AllowedHeaders,
+		ExposedHeaders:         exposedHeaders,
+		AllowCredentials:       cfg.AllowCredentials,
+		MaxAge:                 preflightMaxAge,
+	})
+}
+
+// CORS wraps the server's routes with the configured CORS policy
+func (h *Handler) CORS(next http.Handler) http.Handler {
+	return h.cors.Handler(next)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+func TestMatchOrigin(t *testing.T) {
+	tests := []struct {
+		pattern string
+		origin  string
+		want    bool
+	}{
+		{"https://exam.example.com", "https://exam.example.com", true},
+		{"https://exam.example.com", "https://other.example.com", false},
+		{"https://exam.example.com", "https://exam.example.com.evil.com", false},
+
+		{"https://*.example.com", "https://a.example.com", true},
+		{"https://*.example.com", "https://exam-2.example.com", true},
+		{"https://*.example.com", "https://a.b.example.com", false},
+		{"https://*.example.com", "https://example.com", false},
+		{"https://*.example.com", "https://.example.com", false},
+		{"https://*.example.com", "https://evil-example.com", false},
+		{"https://*.example.com", "https://evilexample.com", false},
+		{"https://*.example.com", "https://a.example.com.evil.com", false},
+		{"https://*.example.com", "https://evil.com/.example.com", false},
+		{"https://*.example.com", "https://user@a.example.com", false},
+
+		// Scheme and port are part of the origin
+		{"https://*.example.com", "http://a.example.com", false},
+		{"https://*.example.com", "https://a.example.com:8443", false},
+		{"https://*.example.com", "https://evil.com:443.example.com", false},
+		{"http://*.example.com:8080", "http://a.example.com:8080", true},
+		{"http://*.example.com:8080", "http://a.example.com:9090", false},
+		{"http://localhost:5173", "http://localhost:5174", false},
+		{"http://localhost:5173", "https://localhost:5173", false},
+	}
+
+	for _, tt := range tests {
+		if got := matchOrigin(tt.pattern, tt.origin); got != tt.want {
+			t.Errorf("matchOrigin(%q, %q) = %v, want %v", tt.pattern, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestOriginPolicy(t *testing.T) {
+	policy := newOriginPolicy([]string{"https://Exam.example.com", "https://*.example.org"})
+
+	tests := []struct {
+		name   string
+		origin string
+		want   bool
+	}{
+		{"no origin", "", true},
+		{"own origin", "http://monaco.local:8080", true},
+		{"listed origin in other case", "https://EXAM.example.com", true},
+		{"wildcard", "https://a.example.org", true},
+		{"unlisted origin", "https://evil.com", false},
+		{"own host on another port", "http://monaco.local:9090", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "http://monaco.local:8080/api/languages", nil)
+			if got := policy.allowed(r, tt.origin); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.origin, got, tt.want)
+			}
+		})
+	}
+
+	if !newOriginPolicy([]string{"*"}).allowed(httptest.NewRequest(http.MethodGet, "/", nil), "https://evil.com") {
+		t.Error(`"*" does not allow every origin`)
+	}
+}
+
+func TestCORSHeaders(t *testing.T) {
+	// request sends a GET from origin through the CORS middleware and returns
+	// the allowed origin and whether credentials are allowed
+	request := func(cfg config.ServerConfig, origins []string, origin string) (string, string) {
+		handler := newCORS(cfg, newOriginPolicy(origins)).Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+		r := httptest.NewRequest(http.MethodGet, "http://monaco.local/api/languages", nil)
+		r.Header.Set("Origin", origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Header().Get("Access-Control-Allow-Origin"), w.Header().Get("Access-Control-Allow-Credentials")
+	}
+	cfg := config.ServerConfig{AllowedMethods: []string{http.MethodGet}}
+	credentials := cfg
+	credentials.AllowCredentials = true
+
+	if allowed, _ := request(cfg, []string{"https://*.example.com"}, "https://a.b.example.com"); allowed != "" {
+		t.Errorf("foreign origin allowed as %q", allowed)
+	}
+	if allowed, creds := request(credentials, []string{"https://*.example.com"}, "https://a.example.com"); allowed != "https://a.example.com" || creds != "true" {
+		t.Errorf("listed origin with credentials: origin %q, credentials %q", allowed, creds)
+	}
+	if allowed, creds := request(cfg, []string{"*"}, "https://evil.com"); allowed == "" || creds != "" {
+		t.Errorf(`"*" without credentials: origin %q, credentials %q`, allowed, creds)
+	}
+
+	// Validation refuses "*" with credentials; should it get through, the
+	// origin is still echoed rather than sent as "*"
+	anyOrigin := credentials
+	anyOrigin.AllowedOrigins = []string{"*"}
+	if err := (&config.Config{Server: anyOrigin}).Validate(); err == nil || !strings.Contains(err.Error(), "server.allowCredentials") {
+		t.Errorf(`Validate() = %v, want "*" with credentials refused`, err)
+	}
+	if allowed, _ := request(credentials, []string{"*"}, "https://evil.com"); allowed == "*" {
+		t.Error(`"*" sent together with credentials`)
+	}
+}
@@ -2,63 +2,118 @@ package api
 
 import (
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	"net/http"
+	"sort"
+	"strconv"
 	"time"
 
-	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
+	"github.com/ishikabhoyar/monaco/new-backend/auth"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
 	"github.com/ishikabhoyar/monaco/new-backend/executor"
+	"github.com/ishikabhoyar/monaco/new-backend/judge"
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
 	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/ishikabhoyar/monaco/new-backend/store"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/rs/cors"
 )
 
+// queueFullRetryAfter is how long clients are asked to wait when the
+// execution queue is full
+const queueFullRetryAfter = 5 * time.Second
+
 // Handler manages all API routes
 type Handler struct {
 	executor *executor.CodeExecutor
+	limits   *submitLimits
+	auth     *auth.Authenticator // nil when authentication is disabled
+	cors     *cors.Cors
 	upgrader websocket.Upgrader
+
+	maxTestCases int
 }
 
 // NewHandler creates a new API handler
-func NewHandler(executor *executor.CodeExecutor) *Handler {
+func NewHandler(executor *executor.CodeExecutor, cfg *config.Config) (*Handler, error) {
+	var authenticator *auth.Authenticator
+	if cfg.Auth.Enabled {
+		var err error
+		if authenticator, err = auth.New(cfg.Auth); err != nil {
+			return nil, err
+		}
+	}
+
+	origins := newOriginPolicy(cfg.Server.AllowedOrigins)
 	return &Handler{
 		executor: executor,
+		limits:   newSubmitLimits(cfg.RateLimit),
+		auth:     authenticator,
+		cors:     newCORS(cfg.Server, origins),
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for development
-			},
+			ReadBufferSize:   1024,
+			WriteBufferSize:  1024,
+			CheckOrigin:      origins.checkWebSocketOrigin,
 			HandshakeTimeout: 10 * time.Second,
 		},
-	}
+		maxTestCases: cfg.Executor.MaxTestCases,
+	}, nil
 }
 
 // RegisterRoutes sets up all API routes
 func (h *Handler) RegisterRoutes(router *mux.Router) {
+	router.Use(instrument)
+
 	// Code execution endpoints
-	router.HandleFunc("/api/submit", h.SubmitCodeHandler).Methods("POST")
-	router.HandleFunc("/api/status/{id}", h.StatusHandler).Methods("GET")
-	router.HandleFunc("/api/result/{id}", h.ResultHandler).Methods("GET")
-	
+	router.HandleFunc("/api/submit", h.authenticated(h.SubmitCodeHandler, "")).Methods("POST")
+	router.HandleFunc("/api/status/{id}", h.authenticated(h.StatusHandler, "")).Methods("GET")
+	router.HandleFunc("/api/result/{id}", h.authenticated(h.ResultHandler, "")).Methods("GET")
+	router.HandleFunc("/api/submissions/{id}", h.authenticated(h.CancelHandler, "")).Methods("DELETE")
+
 	// WebSocket endpoint for real-time output
-	router.HandleFunc("/api/ws/terminal/{id}", h.TerminalWebSocketHandler)
-	
+	router.HandleFunc("/api/ws/terminal/{id}", h.authenticated(h.TerminalWebSocketHandler, ""))
+
 	// Language support endpoint
-	router.HandleFunc("/api/languages", h.SupportedLanguagesHandler).Methods("GET")
-	
-	// Health check
+	router.HandleFunc("/api/languages", h.authenticated(h.SupportedLanguagesHandler, "")).Methods("GET")
+
+	// Health checks; the probes live outside /api like the metrics
 	router.HandleFunc("/api/health", h.HealthCheckHandler).Methods("GET")
+	router.HandleFunc("/livez", h.HealthCheckHandler).Methods("GET")
+	router.HandleFunc("/readyz", h.ReadinessHandler).Methods("GET")
+
+	// Prometheus metrics, outside /api so the bundled nginx does not expose them
+	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+
+	// Administration. Without authentication anyone could call it, so it is
+	// only served when authentication is enabled; SIGHUP always works.
+	if h.auth != nil {
+		router.HandleFunc("/api/admin/reload", h.authenticated(h.ReloadConfigHandler, config.RoleAdmin)).Methods("POST")
+	}
 }
 
 // SubmitCodeHandler handles code submission requests
 func (h *Handler) SubmitCodeHandler(w http.ResponseWriter, r *http.Request) {
-	// Parse request
-	var submission models.CodeSubmission
-	if err := json.NewDecoder(r.Body).Decode(&submission); err != nil {
+	// Parse request; fields the server owns, such as status and results, are not read
+	var request models.SubmissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid request format", http.StatusBadRequest)
 		return
 	}
+	submission := request.Submission()
+
+	// Submissions belong to the authenticated caller, whatever the body says
+	if id := auth.FromContext(r.Context()); id != nil {
+		submission.UserID = id.Subject
+	}
+
+	// Enforce rate limits before doing any other work
+	if !h.limits.allow(w, r, submission.UserID) {
+		return
+	}
 
 	// Validate request
 	if submission.Code == "" {
@@ -71,13 +126,66 @@ func (h *Handler) SubmitCodeHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Generate ID if not provided
-	if submission.ID == "" {
-		submission.ID = uuid.New().String()
+	switch submission.Priority {
+	case "":
+		submission.Priority = models.PriorityNormal
+	case models.PriorityHigh:
+		if !mayJumpQueue(r) {
+			http.Error(w, "High priority requires an API key or the admin role", http.StatusForbidden)
+			return
+		}
+	case models.PriorityNormal, models.PriorityLow:
+	default:
+		http.Error(w, "Unknown priority: "+string(submission.Priority), http.StatusBadRequest)
+		return
+	}
+
+	// An unknown language fails when the submission runs
+	langConfig, _ := h.executor.Language(submission.Language)
+	if err := validateTestCases(submission.TestCases, langConfig, h.maxTestCases); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if submission.Checker != nil && submission.Interactor != nil {
+		http.Error(w, "A submission cannot have both a checker and an interactor", http.StatusBadRequest)
+		return
+	}
+	if err := h.validateHelper("checker", submission.Checker, submission.TestCases); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := h.validateHelper("interactor", submission.Interactor, submission.TestCases); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
 	// Submit code for execution
-	id := h.executor.SubmitCode(&submission)
+	id, err := h.executor.SubmitCode(r.Context(), submission)
+	if errors.Is(err, executor.ErrQueueFull) {
+		depth := h.executor.QueueDepth()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Retry-After", strconv.Itoa(int(queueFullRetryAfter/time.Second)))
+		w.Header().Set("X-Queue-Depth", strconv.Itoa(depth))
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":         "The execution queue is full, please retry later",
+			"queueDepth":    depth,
+			"queueCapacity": h.executor.QueueCapacity(),
+		})
+		return
+	}
+	if errors.Is(err, executor.ErrTooManyActive) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(concurrentRetryAfter/time.Second)))
+		writeTooManyRequests(w, "Too many submissions in progress, wait for one to finish", map[string]interface{}{
+			"maxConcurrent": h.limits.maxConcurrentPerUser,
+		})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// Return response
 	response := models.SubmissionResponse{
@@ -90,22 +198,82 @@ func (h *Handler) SubmitCodeHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// validateTestCases rejects too many test cases and test cases with limits
+// the sandbox cannot apply or that would loosen the language's limits
+func validateTestCases(testCases []models.TestCase, langConfig config.LanguageConfig, maxTestCases int) error {
+	if len(testCases) > maxTestCases {
+		return fmt.Errorf("testCases: at most %d test cases are allowed", maxTestCases)
+	}
+	maxMemory, maxMemoryErr := config.ParseMemory(langConfig.MemoryLimit)
+
+	for i, testCase := range testCases {
+		if testCase.TimeLimitMs < 0 {
+			return fmt.Errorf("testCases[%d].timeLimitMs: must not be negative", i)
+		}
+		if langConfig.TimeoutSec > 0 && testCase.TimeLimitMs > langConfig.TimeoutSec*1000 {
+			return fmt.Errorf("testCases[%d].timeLimitMs: must not exceed the language's timeout of %d seconds", i, langConfig.TimeoutSec)
+		}
+		if testCase.Points < 0 {
+			return fmt.Errorf("testCases[%d].points: must not be negative", i)
+		}
+		if testCase.MemoryLimit != "" {
+			memory, err := config.ParseMemory(testCase.MemoryLimit)
+			switch {
+			case err != nil:
+				return fmt.Errorf("testCases[%d].memoryLimit: %v", i, err)
+			case memory < config.MinMemoryBytes:
+				return fmt.Errorf("testCases[%d].memoryLimit: %q is below the 6m minimum", i, testCase.MemoryLimit)
+			case maxMemoryErr == nil && memory > maxMemory:
+				return fmt.Errorf("testCases[%d].memoryLimit: %q exceeds the language's limit of %s", i, testCase.MemoryLimit, langConfig.MemoryLimit)
+			}
+		}
+		options := judge.Options{AbsEpsilon: testCase.AbsEpsilon, RelEpsilon: testCase.RelEpsilon}
+		if _, err := judge.NewComparator(testCase.Comparator, options, testCase.ExpectedOutput); err != nil {
+			return fmt.Errorf("testCases[%d].comparator: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// validateHelper checks an optional checker or interactor program
+func (h *Handler) validateHelper(kind string, program *models.Program, testCases []models.TestCase) error {
+	if program == nil {
+		return nil
+	}
+	if len(testCases) == 0 {
+		return fmt.Errorf("A %s requires test cases", kind)
+	}
+	if program.Code == "" {
+		return fmt.Errorf("The %s code cannot be empty", kind)
+	}
+	if _, exists := h.executor.Language(program.Language); !exists {
+		return fmt.Errorf("Unsupported %s language: %s", kind, program.Language)
+	}
+	return nil
+}
+
 // StatusHandler returns the current status of a code execution
 func (h *Handler) StatusHandler(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
 	submission, exists := h.executor.GetSubmission(id)
-	if !exists {
+	if !exists || !canAccess(r, submission, config.RoleViewer) {
 		http.Error(w, "Submission not found", http.StatusNotFound)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
+	response := map[string]interface{}{
 		"id":     submission.ID,
 		"status": submission.Status,
-	})
+	}
+	if estimate, queued := h.executor.QueuePosition(id); queued {
+		response["queuePosition"] = estimate.Position
+		response["estimatedStart"] = estimate.EstimatedStart.Format(time.RFC3339)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
 }
 
 // ResultHandler returns the complete result of a code execution
@@ -114,7 +282,7 @@ func (h *Handler) ResultHandler(w http.ResponseWriter, r *http.Request) {
 	id := params["id"]
 
 	submission, exists := h.executor.GetSubmission(id)
-	if !exists {
+	if !exists || !canAccess(r, submission, config.RoleViewer) {
 		http.Error(w, "Submission not found", http.StatusNotFound)
 		return
 	}
@@ -123,13 +291,46 @@ func (h *Handler) ResultHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(submission)
 }
 
+// CancelHandler stops a queued or running submission
+func (h *Handler) CancelHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := params["id"]
+
+	// Only the submitter or an admin may cancel; others are not told it exists
+	if submission, exists := h.executor.GetSubmission(id); exists && !canAccess(r, submission, config.RoleAdmin) {
+		http.Error(w, "Submission not found", http.StatusNotFound)
+		return
+	}
+
+	err := h.executor.Cancel(id)
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		http.Error(w, "Submission not found", http.StatusNotFound)
+		return
+	case errors.Is(err, executor.ErrAlreadyFinished):
+		http.Error(w, "Submission has already finished", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.SubmissionResponse{
+		ID:      id,
+		Status:  "cancelled",
+		Message: "Submission cancelled",
+	})
+}
+
 // TerminalWebSocketHandler handles WebSocket connections for real-time output
 func (h *Handler) TerminalWebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
 	id := params["id"]
 
-	// Check if submission exists
-	if _, exists := h.executor.GetSubmission(id); !exists {
+	// Check if submission exists and the caller may watch it
+	submission, exists := h.executor.GetSubmission(id)
+	if !exists || !canAccess(r, submission, config.RoleViewer) {
 		http.Error(w, "Submission not found", http.StatusNotFound)
 		return
 	}
@@ -137,35 +338,25 @@ func (h *Handler) TerminalWebSocketHandler(w http.ResponseWriter, r *http.Reques
 	// Upgrade connection to WebSocket
 	conn, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		logging.ForSubmission(slog.Default(), submission).Warn("WebSocket upgrade failed", logging.Err(err))
 		return
 	}
 
-	log.Printf("WebSocket connection established for submission %s", id)
-
 	// Register connection
-	h.executor.RegisterTerminalConnection(id, conn)
+	h.executor.RegisterTerminalConnection(id, conn, !isSubmitter(r, submission))
 
 	// Connection will be handled by the executor
 }
 
-// SupportedLanguagesHandler returns a list of supported languages
+// SupportedLanguagesHandler lists the configured languages with their limits
+// and toolchain versions
 func (h *Handler) SupportedLanguagesHandler(w http.ResponseWriter, r *http.Request) {
-	// This is a placeholder - in a real implementation, you'd get this from the config
-	languages := []map[string]string{
-		{"id": "python", "name": "Python", "version": "3.9"},
-		{"id": "java", "name": "Java", "version": "11"},
-		{"id": "c", "name": "C", "version": "GCC 10.2"},
-		{"id": "cpp", "name": "C++", "version": "GCC 10.2"},
-		{"id": "javascript", "name": "JavaScript", "version": "Node.js 16"},
-		{"id": "golang", "name": "Go", "version": "1.19"},
-	}
-
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(languages)
+	json.NewEncoder(w).Encode(h.executor.LanguageInfos())
 }
 
-// HealthCheckHandler provides a simple health check endpoint
+// HealthCheckHandler reports that the server is up. It serves liveness
+// probes, so it does not depend on Docker or the queue; see ReadinessHandler.
 func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{
@@ -173,3 +364,42 @@ func (h *Handler) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 		"time":   time.Now().Format(time.RFC3339),
 	})
 }
+
+// ReadinessHandler reports whether the server can run submissions, with the
+// result of each check. It responds 503 if any check fails.
+func (h *Handler) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	checks, ready := h.executor.Readiness(r.Context())
+
+	status := "ready"
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		status = "not ready"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status": status,
+		"checks": checks,
+		"time":   time.Now().Format(time.RFC3339),
+	})
+}
+
+// ReloadConfigHandler reloads the language configuration without a restart
+func (h *Handler) ReloadConfigHandler(w http.ResponseWriter, r *http.Request) {
+	if err := h.executor.Reload(); err != nil {
+		slog.Error("configuration reload failed", logging.Err(err))
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	languages := make([]string, 0)
+	for id := range h.executor.Languages() {
+		languages = append(languages, id)
+	}
+	sort.Strings(languages)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    "reloaded",
+		"languages": languages,
+	})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+func TestValidateTestCases(t *testing.T) {
+	python := config.LanguageConfig{MemoryLimit: "100m", TimeoutSec: 5}
+
+	tests := []struct {
+		name      string
+		testCases []models.TestCase
+		wantErr   string // Empty if the test cases are valid
+	}{
+		{"none", nil, ""},
+		{"language limits", []models.TestCase{{TimeLimitMs: 5000, MemoryLimit: "100m"}}, ""},
+		{"tighter limits", []models.TestCase{{TimeLimitMs: 500, MemoryLimit: "6m"}}, ""},
+		{"too many", make([]models.TestCase, 4), "testCases: at most 3 test cases are allowed"},
+		{"negative time limit", []models.TestCase{{TimeLimitMs: -1}}, "testCases[0].timeLimitMs: must not be negative"},
+		{"time limit above timeout", []models.TestCase{{}, {TimeLimitMs: 5001}},
+			"testCases[1].timeLimitMs: must not exceed the language's timeout of 5 seconds"},
+		{"malformed memory limit", []models.TestCase{{MemoryLimit: "lots"}}, `testCases[0].memoryLimit: malformed memory size "lots"`},
+		{"memory limit below minimum", []models.TestCase{{MemoryLimit: "1m"}}, `testCases[0].memoryLimit: "1m" is below the 6m minimum`},
+		{"memory limit above language", []models.TestCase{{MemoryLimit: "64g"}},
+			`testCases[0].memoryLimit: "64g" exceeds the language's limit of 100m`},
+		{"negative points", []models.TestCase{{Points: -1}}, "testCases[0].points: must not be negative"},
+		{"unknown comparator", []models.TestCase{{Comparator: "fuzzy"}}, `testCases[0].comparator: unknown comparator "fuzzy"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateTestCases(tt.testCases, python, 3)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("validateTestCases() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("validateTestCases() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"encoding/json"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/auth"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/metrics"
+	"github.com/ishikabhoyar/monaco/new-backend/ratelimit"
+)
+
+// concurrentRetryAfter is how long clients at their concurrent submission
+// limit are asked to wait
+const concurrentRetryAfter = 5 * time.Second
+
+// submitLimits applies the rate limits of config.RateLimitConfig to submissions
+type submitLimits struct {
+	ip                   *ratelimit.Limiter
+	user                 *ratelimit.Limiter
+	apiKey               *ratelimit.Limiter
+	maxConcurrentPerUser int
+	trustedProxies       []*net.IPNet
+}
+
+// newSubmitLimits creates the limiters described by cfg. The configuration
+// has been validated, so malformed proxy CIDRs cannot occur.
+func newSubmitLimits(cfg config.RateLimitConfig) *submitLimits {
+	limits := &submitLimits{
+		ip:                   ratelimit.New(cfg.IP.PerMinute, cfg.IP.Burst),
+		user:                 ratelimit.New(cfg.User.PerMinute, cfg.User.Burst),
+		apiKey:               ratelimit.New(cfg.APIKey.PerMinute, cfg.APIKey.Burst),
+		maxConcurrentPerUser: cfg.MaxConcurrentPerUser,
+	}
+	for _, cidr := range cfg.TrustedProxies {
+		if _, network, err := net.ParseCIDR(cidr); err == nil {
+			limits.trustedProxies = append(limits.trustedProxies, network)
+		}
+	}
+	return limits
+}
+
+// allow takes a token from every limiter that applies to the request and sets
+// the X-RateLimit-* headers from the most restrictive one. Callers that
+// authenticated with an API key are charged the apiKey bucket of the key's
+// subject instead of a user bucket. If any limiter refuses, the tokens already
+// taken are returned and it writes a 429 response.
+func (l *submitLimits) allow(w http.ResponseWriter, r *http.Request, userID string) bool {
+	type check struct {
+		limiter *ratelimit.Limiter
+		key     string
+	}
+	checks := []check{{l.ip, l.clientIP(r)}}
+	if id := auth.FromContext(r.Context()); id != nil && id.APIKey {
+		checks = append(checks, check{l.apiKey, id.Subject})
+	} else if userID != "" {
+		checks = append(checks, check{l.user, userID})
+	}
+
+	var tightest *ratelimit.Result
+	for i, c := range checks {
+		if c.limiter == nil {
+			continue
+		}
+		result := c.limiter.Allow(c.key)
+		if !result.Allowed {
+			for _, taken := range checks[:i] {
+				taken.limiter.Refund(taken.key)
+			}
+			metrics.SubmissionsRejected.WithLabelValues("rate_limited").Inc()
+			setRateLimitHeaders(w, result)
+			retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			writeTooManyRequests(w, "Rate limit exceeded, please slow down", map[string]interface{}{
+				"retryAfter": retryAfter,
+			})
+			return false
+		}
+		if tightest == nil || result.Remaining < tightest.Remaining {
+			tightest = &result
+		}
+	}
+
+	if tightest != nil {
+		setRateLimitHeaders(w, *tightest)
+	}
+	return true
+}
+
+// clientIP returns the address of the client that sent r. X-Forwarded-For is
+// only believed when the request comes through a trusted proxy, and the
+// client is the last address in it that is not a trusted proxy itself.
+func (l *submitLimits) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	if !l.trusted(host) {
+		return host
+	}
+
+	forwarded := strings.Split(r.Header.Get("X-Forwarded-For"), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		address := strings.TrimSpace(forwarded[i])
+		if address == "" {
+			continue
+		}
+		if !l.trusted(address) {
+			return address
+		}
+		host = address
+	}
+	return host
+}
+
+// trusted reports whether address belongs to a trusted proxy
+func (l *submitLimits) trusted(address string) bool {
+	ip := net.ParseIP(address)
+	if ip == nil {
+		return false
+	}
+	for _, network := range l.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// setRateLimitHeaders describes the state of a rate limit to the client
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimit.Result) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.Reset.Seconds()))))
+}
+
+// writeTooManyRequests writes a 429 response with a JSON body
+func writeTooManyRequests(w http.ResponseWriter, message string, details map[string]interface{}) {
+	body := map[string]interface{}{"error": message}
+	for key, value := range details {
+		body[key] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+// submitAs runs a submission for userID through authentication and the submit
+// limits of h, with the given header set, and returns the response status
+func submitAs(h *Handler, header, value, userID string) int {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		if h.limits.allow(w, r, userID) {
+			w.WriteHeader(http.StatusOK)
+		}
+	}
+	if h.auth != nil {
+		handler = h.authenticated(handler, "")
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/api/submit", nil)
+	if header != "" {
+		r.Header.Set(header, value)
+	}
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w.Code
+}
+
+// testLimits allows one submission per user and three per API key
+func testLimits() *submitLimits {
+	return newSubmitLimits(config.RateLimitConfig{
+		User:   config.RateLimit{PerMinute: 1, Burst: 1},
+		APIKey: config.RateLimit{PerMinute: 3, Burst: 3},
+	})
+}
+
+func TestSubmitLimitsAPIKey(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		value  string
+	}{
+		{"X-API-Key header", "X-API-Key", "admin-key"},
+		{"bearer token", "Authorization", "Bearer admin-key"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newAuthHandler(t)
+			h.limits = testLimits()
+
+			// The key's subject is also its userId; only the apiKey bucket applies
+			for i := 0; i < 3; i++ {
+				if status := submitAs(h, tt.header, tt.value, "grader"); status != http.StatusOK {
+					t.Fatalf("submission %d: status = %d, want 200", i+1, status)
+				}
+			}
+			if status := submitAs(h, tt.header, tt.value, "grader"); status != http.StatusTooManyRequests {
+				t.Errorf("submission beyond the apiKey burst: status = %d, want 429", status)
+			}
+
+			// Another caller with the same userId has its own user bucket
+			token := token(t, testSecret, "grader", nil, time.Hour)
+			if status := submitAs(h, "Authorization", "Bearer "+token, "grader"); status != http.StatusOK {
+				t.Errorf("token caller after the key ran out: status = %d, want 200", status)
+			}
+		})
+	}
+}
+
+func TestSubmitLimitsWithoutAuth(t *testing.T) {
+	h := &Handler{limits: testLimits()}
+
+	if status := submitAs(h, "X-API-Key", "made-up-1", "alice"); status != http.StatusOK {
+		t.Fatalf("first submission: status = %d, want 200", status)
+	}
+	// An unverified header does not bring its own bucket
+	if status := submitAs(h, "X-API-Key", "made-up-2", "alice"); status != http.StatusTooManyRequests {
+		t.Errorf("second submission with a new X-API-Key: status = %d, want 429", status)
+	}
+	if status := submitAs(h, "", "", "bob"); status != http.StatusOK {
+		t.Errorf("another user: status = %d, want 200", status)
+	}
+}
+
+func TestSubmitLimitsRefund(t *testing.T) {
+	h := &Handler{limits: newSubmitLimits(config.RateLimitConfig{
+		IP:   config.RateLimit{PerMinute: 2, Burst: 2},
+		User: config.RateLimit{PerMinute: 1, Burst: 1},
+	})}
+
+	submitAs(h, "", "", "alice")
+	if status := submitAs(h, "", "", "alice"); status != http.StatusTooManyRequests {
+		t.Fatalf("second submission of alice: status = %d, want 429", status)
+	}
+	// The IP token taken for the refused submission was returned
+	if status := submitAs(h, "", "", "bob"); status != http.StatusOK {
+		t.Errorf("bob from the same IP: status = %d, want 200", status)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	limits := newSubmitLimits(config.RateLimitConfig{TrustedProxies: []string{"10.0.0.0/8"}})
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"untrusted forwarder", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed prefix", "10.0.0.2:5000", "192.0.2.66, 198.51.100.1", "198.51.100.1"},
+		{"proxy chain", "10.0.0.2:5000", "198.51.100.1, 10.0.0.3", "198.51.100.1"},
+		{"only proxies", "10.0.0.2:5000", "10.0.0.3", "10.0.0.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/api/submit", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := limits.clientIP(r); got != tt.want {
+				t.Errorf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/executor"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/ishikabhoyar/monaco/new-backend/store"
+	"github.com/ishikabhoyar/monaco/new-backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// keptSpans is an in-memory exporter that keeps its spans after shutdown,
+// which flushes them
+type keptSpans struct {
+	*tracetest.InMemoryExporter
+}
+
+func (keptSpans) Shutdown(context.Context) error { return nil }
+
+// tracingInstalled is set once TestTracing has called Install. The tracer of
+// the tracing package only follows the first global provider installed, so
+// only one test per process can see its spans.
+var tracingInstalled bool
+
+// TestTracing follows one submission of a compiled language from its HTTP
+// request to its result
+func TestTracing(t *testing.T) {
+	if tracingInstalled {
+		t.Skip("spans go to the provider installed by an earlier run")
+	}
+	tracingInstalled = true
+	exporter := tracetest.NewInMemoryExporter()
+	shutdown, err := tracing.Install(keptSpans{exporter}, config.TracingConfig{Enabled: true, SampleRatio: 1, ServiceName: "monaco-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TMPDIR", t.TempDir())
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Executor.ConcurrentExecutions = 1
+	cfg.Languages = map[string]config.LanguageConfig{
+		"c": {
+			Name:        "C",
+			Image:       "gcc:latest",
+			MemoryLimit: "64m",
+			CPULimit:    "0.5",
+			TimeoutSec:  5,
+			CompileCmd:  []string{"gcc", "-o", "{dir}/program", "{source}"},
+			RunCmd:      []string{"{dir}/program"},
+			FileExt:     ".c",
+		},
+	}
+
+	// The program waits for a line typed into its terminal, so the terminal
+	// is sure to be connected when the final status is sent
+	started := make(chan struct{})
+	rt := executor.NewFakeRuntime()
+	rt.RunFunc = func(ctx context.Context, spec executor.Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+		close(started)
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(stdout, line)
+		return err
+	}
+	e := executor.NewCodeExecutorWithRuntime(cfg, rt, store.NewMemoryStore(0))
+	h, err := NewHandler(e, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := mux.NewRouter()
+	h.RegisterRoutes(router)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	// The caller's trace continues into the server
+	const callerTrace, callerSpan = "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	request, err := http.NewRequest(http.MethodPost, server.URL+"/api/submit", strings.NewReader(`{"language": "c", "code": "int main() {}"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	request.Header.Set("traceparent", "00-"+callerTrace+"-"+callerSpan+"-01")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var submitted models.SubmissionResponse
+	err = json.NewDecoder(response.Body).Decode(&submitted)
+	response.Body.Close()
+	if err != nil || response.StatusCode != http.StatusOK {
+		t.Fatalf("submit: status %d, %v", response.StatusCode, err)
+	}
+
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the program did not start")
+	}
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/ws/terminal/"+submitted.ID, nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if err := conn.WriteJSON(map[string]string{"type": "input", "content": "hello\n"}); err != nil {
+		t.Fatal(err)
+	}
+	for status := ""; status != "completed"; {
+		var message struct {
+			Type    string          `json:"type"`
+			Content json.RawMessage `json:"content"`
+		}
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("read: %v", err)
+		}
+		if message.Type == "status" {
+			var update models.StatusUpdateMessage
+			json.Unmarshal(message.Content, &update)
+			if update.Status == "failed" || update.Status == "cancelled" {
+				t.Fatalf("submission %s", update.Status)
+			}
+			status = update.Status
+		}
+	}
+
+	// Flush the spans of the submission; the terminal's own span is still open
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans := make(map[string]tracetest.SpanStub)
+	for _, span := range exporter.GetSpans() {
+		if _, exists := spans[span.Name]; exists {
+			t.Errorf("more than one %q span", span.Name)
+		}
+		spans[span.Name] = span
+	}
+
+	// span returns the span named name after checking it belongs to the
+	// caller's trace and is a child of parent
+	span := func(name, parent string) tracetest.SpanStub {
+		t.Helper()
+		span, exists := spans[name]
+		if !exists {
+			names := make([]string, 0, len(spans))
+			for name := range spans {
+				names = append(names, name)
+			}
+			t.Fatalf("no %q span among %q", name, names)
+		}
+		if got := span.SpanContext.TraceID().String(); got != callerTrace {
+			t.Errorf("%q span is in trace %s, want %s", name, got, callerTrace)
+		}
+		wantParent := callerSpan
+		if parent != "" {
+			wantParent = spans[parent].SpanContext.SpanID().String()
+		}
+		if got := span.Parent.SpanID().String(); got != wantParent {
+			t.Errorf("%q span has parent %s, want %q span %s", name, got, parent, wantParent)
+		}
+		return span
+	}
+	// hasAttributes reports the attributes of span that differ from want
+	hasAttributes := func(span tracetest.SpanStub, want ...attribute.KeyValue) {
+		t.Helper()
+		got := make(map[attribute.Key]attribute.Value)
+		for _, kv := range span.Attributes {
+			got[kv.Key] = kv.Value
+		}
+		for _, kv := range want {
+			if value, exists := got[kv.Key]; !exists || value != kv.Value {
+				t.Errorf("%q span has %s = %q, want %q", span.Name, kv.Key, value.Emit(), kv.Value.Emit())
+			}
+		}
+	}
+	submission := []attribute.KeyValue{
+		attribute.String("monaco.submission.id", submitted.ID),
+		attribute.String("monaco.submission.language", "c"),
+	}
+
+	submit := span("POST /api/submit", "")
+	if submit.SpanKind != trace.SpanKindServer {
+		t.Errorf("submit span is of kind %s, want server", submit.SpanKind)
+	}
+	hasAttributes(submit,
+		attribute.String("http.method", http.MethodPost),
+		attribute.String("http.route", "/api/submit"),
+		attribute.Int("http.status_code", http.StatusOK))
+
+	hasAttributes(span("queue", "POST /api/submit"), submission...)
+	hasAttributes(span("execute", "POST /api/submit"), append(submission,
+		attribute.Int("monaco.worker", 0),
+		attribute.String("monaco.submission.status", "completed"))...)
+	hasAttributes(span("compile", "execute"), attribute.String("monaco.image", "gcc:latest"))
+	hasAttributes(span("run", "execute"), attribute.String("monaco.image", "gcc:latest"))
+	for _, name := range []string{"create workspace", "remove workspace", "save result"} {
+		span(name, "execute")
+	}
+
+	// Each step of the execution starts once the one before has ended
+	order := []string{"create workspace", "compile", "run", "remove workspace", "save result"}
+	for i := 1; i < len(order); i++ {
+		if before, after := spans[order[i-1]], spans[order[i]]; after.StartTime.Before(before.EndTime) {
+			t.Errorf("%q span starts before the %q span ends", order[i], order[i-1])
+		}
+	}
+	if spans["execute"].StartTime.Before(spans["queue"].EndTime) {
+		t.Error("execute span starts before the queue span ends")
+	}
+}
@@ -0,0 +1,149 @@
+// Package auth identifies API callers from static API keys and JWT bearer tokens
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+// ErrInvalidCredentials is returned for an unknown API key or a token that
+// does not verify
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Identity is an authenticated caller
+type Identity struct {
+	Subject string
+	Roles   []string
+	APIKey  bool // Authenticated with a configured API key rather than a JWT
+}
+
+// HasRole reports whether the identity was granted role. Admins hold every role.
+func (id *Identity) HasRole(role string) bool {
+	for _, r := range id.Roles {
+		if r == role || r == config.RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator verifies credentials against the configured API keys and
+// JWT key
+type Authenticator struct {
+	apiKeys  map[[sha256.Size]byte]*Identity // Keyed by hash so lookups do not depend on the key's bytes
+	jwtKey   interface{}
+	jwtAlg   string
+	issuer   string
+	audience string
+}
+
+// New creates an authenticator for cfg, reading the JWT key file if one is
+// configured
+func New(cfg config.AuthConfig) (*Authenticator, error) {
+	a := &Authenticator{
+		apiKeys:  make(map[[sha256.Size]byte]*Identity),
+		jwtAlg:   cfg.JWT.Algorithm,
+		issuer:   cfg.JWT.Issuer,
+		audience: cfg.JWT.Audience,
+	}
+
+	for _, apiKey := range cfg.APIKeys {
+		a.apiKeys[sha256.Sum256([]byte(apiKey.Key))] = &Identity{
+			Subject: apiKey.Subject,
+			Roles:   apiKey.Roles,
+			APIKey:  true,
+		}
+	}
+
+	if a.jwtAlg == "" {
+		return a, nil
+	}
+
+	data, err := os.ReadFile(cfg.JWT.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWT key: %w", err)
+	}
+	switch a.jwtAlg {
+	case config.JWTHS256:
+		secret := []byte(strings.TrimSpace(string(data)))
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("JWT key file %s is empty", cfg.JWT.KeyFile)
+		}
+		a.jwtKey = secret
+	case config.JWTRS256:
+		if a.jwtKey, err = jwt.ParseRSAPublicKeyFromPEM(data); err != nil {
+			return nil, fmt.Errorf("JWT key file %s: %w", cfg.JWT.KeyFile, err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", a.jwtAlg)
+	}
+	return a, nil
+}
+
+// Authenticate returns the identity behind a credential, which is either an
+// API key or a JWT
+func (a *Authenticator) Authenticate(credential string) (*Identity, error) {
+	if credential == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if id, exists := a.apiKeys[sha256.Sum256([]byte(credential))]; exists {
+		return id, nil
+	}
+	if a.jwtAlg == "" {
+		return nil, ErrInvalidCredentials
+	}
+	return a.parseToken(credential)
+}
+
+// claims are the JWT claims read by parseToken
+type claims struct {
+	jwt.RegisteredClaims
+	Roles []string `json:"roles"`
+}
+
+// parseToken verifies a JWT and returns the identity it asserts
+func (a *Authenticator) parseToken(raw string) (*Identity, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{a.jwtAlg}),
+		jwt.WithExpirationRequired(),
+	}
+	if a.issuer != "" {
+		options = append(options, jwt.WithIssuer(a.issuer))
+	}
+	if a.audience != "" {
+		options = append(options, jwt.WithAudience(a.audience))
+	}
+
+	var c claims
+	_, err := jwt.ParseWithClaims(raw, &c, func(*jwt.Token) (interface{}, error) {
+		return a.jwtKey, nil
+	}, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if c.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	return &Identity{Subject: c.Subject, Roles: c.Roles}, nil
+}
+
+// contextKey keys the identity stored in a request context
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity stored by WithIdentity, or nil
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
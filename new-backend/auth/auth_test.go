@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+const testSecret = "test-secret"
+
+// writeKey stores a JWT key in a temporary file and returns its path
+func writeKey(t *testing.T, data []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwt.key")
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// newHS256 creates an authenticator with one API key and an HS256 secret
+func newHS256(t *testing.T, jwtConfig config.JWTConfig) *Authenticator {
+	t.Helper()
+	jwtConfig.Algorithm = config.JWTHS256
+	jwtConfig.KeyFile = writeKey(t, []byte(testSecret+"\n"))
+	a, err := New(config.AuthConfig{
+		Enabled: true,
+		APIKeys: []config.APIKeyConfig{{Key: "grader-key", Subject: "grader", Roles: []string{config.RoleAdmin}}},
+		JWT:     jwtConfig,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// sign returns a token with the given claims signed by method and key
+func sign(t *testing.T, method jwt.SigningMethod, key interface{}, c claims) string {
+	t.Helper()
+	token, err := jwt.NewWithClaims(method, c).SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// validClaims are claims every test authenticator accepts
+func validClaims() claims {
+	return claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   "alice",
+			Issuer:    "exam",
+			Audience:  jwt.ClaimStrings{"monaco"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+		Roles: []string{config.RoleViewer},
+	}
+}
+
+func TestAuthenticateToken(t *testing.T) {
+	a := newHS256(t, config.JWTConfig{Issuer: "exam", Audience: "monaco"})
+
+	id, err := a.Authenticate(sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "alice" || len(id.Roles) != 1 || id.Roles[0] != config.RoleViewer || id.APIKey {
+		t.Errorf("identity = %+v, want alice with the viewer role from a token", *id)
+	}
+}
+
+func TestAuthenticateRejectsTokens(t *testing.T) {
+	a := newHS256(t, config.JWTConfig{Issuer: "exam", Audience: "monaco"})
+	secret := []byte(testSecret)
+
+	with := func(edit func(c *claims)) claims {
+		c := validClaims()
+		edit(&c)
+		return c
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"empty", ""},
+		{"malformed", "not.a.token"},
+		{"expired", sign(t, jwt.SigningMethodHS256, secret, with(func(c *claims) {
+			c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+		}))},
+		{"no expiry", sign(t, jwt.SigningMethodHS256, secret, with(func(c *claims) { c.ExpiresAt = nil }))},
+		{"not yet valid", sign(t, jwt.SigningMethodHS256, secret, with(func(c *claims) {
+			c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Hour))
+		}))},
+		{"wrong signature", sign(t, jwt.SigningMethodHS256, []byte("other-secret"), validClaims())},
+		{"wrong algorithm", sign(t, jwt.SigningMethodHS384, secret, validClaims())},
+		{"RS256 for an HS256 key", sign(t, jwt.SigningMethodRS256, rsaKey, validClaims())},
+		{"unsigned", sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, validClaims())},
+		{"wrong issuer", sign(t, jwt.SigningMethodHS256, secret, with(func(c *claims) { c.Issuer = "elsewhere" }))},
+		{"wrong audience", sign(t, jwt.SigningMethodHS256, secret, with(func(c *claims) {
+			c.Audience = jwt.ClaimStrings{"other"}
+		}))},
+		{"no subject", sign(t, jwt.SigningMethodHS256, secret, with(func(c *claims) { c.Subject = "" }))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := a.Authenticate(tt.token)
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Authenticate() = %+v, %v; want ErrInvalidCredentials", id, err)
+			}
+		})
+	}
+}
+
+func TestAuthenticateRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := New(config.AuthConfig{JWT: config.JWTConfig{
+		Algorithm: config.JWTRS256,
+		KeyFile:   writeKey(t, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: public})),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodRS256, key, validClaims())); err != nil {
+		t.Errorf("valid RS256 token rejected: %v", err)
+	}
+
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.Authenticate(sign(t, jwt.SigningMethodRS256, other, validClaims())); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("token signed by another key: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestAuthenticateAPIKey(t *testing.T) {
+	a := newHS256(t, config.JWTConfig{})
+
+	id, err := a.Authenticate("grader-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id.Subject != "grader" || !id.APIKey || !id.HasRole(config.RoleAdmin) {
+		t.Errorf("identity = %+v, want the grader admin API key", *id)
+	}
+
+	if _, err := a.Authenticate("grader-key2"); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("unknown API key: err = %v, want ErrInvalidCredentials", err)
+	}
+
+	// Without a JWT algorithm only API keys are accepted
+	keysOnly, err := New(config.AuthConfig{APIKeys: []config.APIKeyConfig{{Key: "k", Subject: "s"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := sign(t, jwt.SigningMethodHS256, []byte(testSecret), validClaims())
+	if _, err := keysOnly.Authenticate(token); !errors.Is(err, ErrInvalidCredentials) {
+		t.Errorf("token without JWT configured: err = %v, want ErrInvalidCredentials", err)
+	}
+}
+
+func TestNewRejectsBadKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		jwt  config.JWTConfig
+	}{
+		{"missing file", config.JWTConfig{Algorithm: config.JWTHS256, KeyFile: filepath.Join(t.TempDir(), "missing")}},
+		{"empty secret", config.JWTConfig{Algorithm: config.JWTHS256, KeyFile: writeKey(t, []byte("\n"))}},
+		{"not a PEM key", config.JWTConfig{Algorithm: config.JWTRS256, KeyFile: writeKey(t, []byte(testSecret))}},
+		{"unknown algorithm", config.JWTConfig{Algorithm: "ES256", KeyFile: writeKey(t, []byte(testSecret))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(config.AuthConfig{JWT: tt.jwt}); err == nil {
+				t.Error("New() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestHasRole(t *testing.T) {
+	tests := []struct {
+		roles []string
+		role  string
+		want  bool
+	}{
+		{nil, config.RoleViewer, false},
+		{[]string{config.RoleViewer}, config.RoleViewer, true},
+		{[]string{config.RoleViewer}, config.RoleAdmin, false},
+		{[]string{config.RoleAdmin}, config.RoleViewer, true},
+		{[]string{"other", config.RoleAdmin}, config.RoleAdmin, true},
+	}
+
+	for _, tt := range tests {
+		id := &Identity{Subject: "alice", Roles: tt.roles}
+		if got := id.HasRole(tt.role); got != tt.want {
+			t.Errorf("roles %v: HasRole(%q) = %v, want %v", tt.roles, tt.role, got, tt.want)
+		}
+	}
+}
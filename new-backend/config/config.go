@@ -1,8 +1,10 @@
 package config
 
 import (
+	"fmt"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -12,6 +14,12 @@ type Config struct {
 	Executor  ExecutorConfig
 	Languages map[string]LanguageConfig
 	Sandbox   SandboxConfig
+	Store     StoreConfig
+	RateLimit RateLimitConfig
+	Auth      AuthConfig
+	Log       LogConfig
+	Tracing   TracingConfig
+	Health    HealthConfig
 }
 
 // ServerConfig holds server-related configurations
@@ -20,6 +28,16 @@ type ServerConfig struct {
 	ReadTimeout  time.Duration
 	WriteTimeout time.Duration
 	IdleTimeout  time.Duration
+
+	// AllowedOrigins lists the origins, e.g. "https://exam.example.com", whose
+	// pages may call the API and open terminal WebSockets. An entry may start
+	// its host with a "*." wildcard for one subdomain label, e.g.
+	// "https://*.example.com", and "*" alone allows every origin. The
+	// server's own origin is always allowed.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool // Let browsers send cookies; cannot be combined with "*"
 }
 
 // ExecutorConfig holds executor-related configurations
@@ -27,51 +45,342 @@ type ExecutorConfig struct {
 	ConcurrentExecutions int
 	QueueCapacity        int
 	DefaultTimeout       time.Duration
+	MaxTestCases         int // Most test cases a submission may have
 }
 
-// LanguageConfig holds language-specific configurations
+// LanguageConfig holds language-specific configurations.
+//
+// SourceFile, CompileCmd, RunCmd, Env and WorkDir are templates in which
+// {dir} is the sandbox working directory, {file} the source file name and
+// {source} its full path inside the sandbox. A SourceHook may define more
+// placeholders, e.g. "java-class-name" defines {class}.
 type LanguageConfig struct {
-	Name        string
-	Image       string
-	MemoryLimit string
-	CPULimit    string
-	TimeoutSec  int
-	CompileCmd  []string
-	RunCmd      []string
-	FileExt     string
-	VersionCmd  []string
-}
-
-// SandboxConfig holds sandbox-related configurations
+	Name              string   `json:"name" yaml:"name"`
+	Image             string   `json:"image" yaml:"image"`
+	MemoryLimit       string   `json:"memoryLimit" yaml:"memoryLimit"`
+	CPULimit          string   `json:"cpuLimit" yaml:"cpuLimit"`
+	TimeoutSec        int      `json:"timeoutSec" yaml:"timeoutSec"`
+	CompileTimeoutSec int      `json:"compileTimeoutSec,omitempty" yaml:"compileTimeoutSec"` // Defaults to the executor's default timeout
+	SourceFile        string   `json:"sourceFile,omitempty" yaml:"sourceFile"`               // Defaults to "code" + FileExt
+	SourceHook        string   `json:"sourceHook,omitempty" yaml:"sourceHook"`               // Optional source preparation step, see executor.SourceHook
+	CompileCmd        []string `json:"compileCmd,omitempty" yaml:"compileCmd"`
+	RunCmd            []string `json:"runCmd" yaml:"runCmd"`
+	Env               []string `json:"env,omitempty" yaml:"env"`
+	WorkDir           string   `json:"workDir,omitempty" yaml:"workDir"`
+	FileExt           string   `json:"fileExt" yaml:"fileExt"`
+	VersionCmd        []string `json:"versionCmd,omitempty" yaml:"versionCmd"`
+}
+
+// SandboxConfig holds sandbox-related configurations. Compile steps get the
+// same isolation as runs, with their own memory and CPU limits as compilers
+// need more than most programs.
 type SandboxConfig struct {
-	NetworkDisabled bool
-	MemorySwapLimit string
-	PidsLimit       int64
+	NetworkDisabled    bool
+	MemorySwapLimit    string
+	PidsLimit          int64
+	MeasureUsage       bool   // Report peak memory and CPU time of each run; needs /bin/sh in every image
+	CompileMemoryLimit string // Memory limit of compile steps, in Docker notation
+	CompileCPULimit    string // CPU limit of compile steps, as a fraction of one CPU
+}
+
+// Submission store backends
+const (
+	StoreMemory = "memory"
+	StoreBolt   = "bolt"
+)
+
+// StoreConfig selects where submissions are kept and for how long.
+// A zero retention limit means "no limit".
+type StoreConfig struct {
+	Backend       string        // StoreMemory or StoreBolt
+	Path          string        // Database file of the bolt backend
+	TTL           time.Duration // How long the memory backend keeps a submission after its last update; 0 keeps it forever
+	MaxAge        time.Duration // Delete finished submissions this long after they completed
+	MaxCount      int           // Keep at most this many submissions
+	MaxOutput     string        // Keep at most this much output in total, in Docker memory notation
+	SweepInterval time.Duration // How often retention is enforced
+}
+
+// RateLimit is a token bucket: PerMinute submissions on average with bursts
+// of up to Burst. A PerMinute of 0 disables the limit.
+type RateLimit struct {
+	PerMinute int
+	Burst     int
+}
+
+// RateLimitConfig limits how fast clients can submit code
+type RateLimitConfig struct {
+	IP                   RateLimit // Per client IP address
+	User                 RateLimit // Per userId given with the submission
+	APIKey               RateLimit // Per X-API-Key header
+	MaxConcurrentPerUser int       // Queued or running submissions per user; 0 means no limit
+	TrustedProxies       []string  // CIDRs whose X-Forwarded-For header is trusted to name the client
+}
+
+// Roles that can be granted to API keys and JWT subjects
+const (
+	RoleViewer = "viewer" // May watch and read any submission
+	RoleAdmin  = "admin"  // Viewer, and may cancel any submission and reload the configuration
+)
+
+// JWT signing algorithms accepted by JWTConfig.Algorithm
+const (
+	JWTHS256 = "HS256"
+	JWTRS256 = "RS256"
+)
+
+// AuthConfig controls who may use the API. When Enabled, every request other
+// than the health check must present one of APIKeys or a valid JWT.
+type AuthConfig struct {
+	Enabled bool
+	APIKeys []APIKeyConfig
+	JWT     JWTConfig
+}
+
+// APIKeyConfig is a static API key and the identity it grants
+type APIKeyConfig struct {
+	Key     string   `json:"key" yaml:"key"`
+	Subject string   `json:"subject" yaml:"subject"` // Becomes the userId of submissions made with the key
+	Roles   []string `json:"roles,omitempty" yaml:"roles"`
+}
+
+// JWTConfig describes how bearer tokens are verified. The subject is taken
+// from the "sub" claim and the roles from a "roles" string array claim.
+type JWTConfig struct {
+	Algorithm string // JWTHS256 or JWTRS256; empty disables JWTs
+	KeyFile   string // Shared secret for HS256, PEM public key for RS256
+	Issuer    string // Required "iss" claim, if set
+	Audience  string // Required "aud" claim, if set
+}
+
+// Log output formats
+const (
+	LogJSON = "json"
+	LogText = "text" // logfmt-style key=value pairs
+)
+
+// LogConfig controls the server's structured logs
+type LogConfig struct {
+	Format  string // LogJSON or LogText
+	Level   string // debug, info, warn or error
+	Content bool   // Log submitted code and program input verbatim instead of redacting them
+}
+
+// TracingConfig controls the export of OpenTelemetry spans over OTLP/HTTP
+type TracingConfig struct {
+	Enabled     bool
+	Endpoint    string  // Collector host:port; empty uses OTEL_EXPORTER_OTLP_ENDPOINT or localhost:4318
+	Insecure    bool    // Send spans over plain HTTP instead of HTTPS
+	SampleRatio float64 // Fraction of new traces recorded, from 0 to 1
+	ServiceName string
 }
 
-// GetConfig returns the application configuration
-func GetConfig() *Config {
+// HealthConfig sets the thresholds of the readiness checks
+type HealthConfig struct {
+	MinFreeDisk   string        // Free space needed in the temp directory, in Docker notation; "0" disables the check
+	MaxQueueUsage float64       // Share of the queue capacity in use at which the server stops being ready
+	StuckAfter    time.Duration // A worker busy this long counts as stuck; the server is not ready while all are
+	CheckTimeout  time.Duration // Time allowed for the Docker checks of one probe
+}
+
+// Load builds the application configuration. Built-in defaults are overlaid
+// with the config file at path (if path is not empty) and then with
+// environment variables. The result is validated before it is returned.
+func Load(path string) (*Config, error) {
+	cfg := defaultConfig()
+
+	if path != "" {
+		if err := loadFile(path, cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := applyEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// defaultConfig returns the built-in configuration
+func defaultConfig() *Config {
 	return &Config{
 		Server: ServerConfig{
-			Port:         getEnv("PORT", "8080"),
-			ReadTimeout:  time.Duration(getEnvAsInt("READ_TIMEOUT", 15)) * time.Second,
-			WriteTimeout: time.Duration(getEnvAsInt("WRITE_TIMEOUT", 15)) * time.Second,
-			IdleTimeout:  time.Duration(getEnvAsInt("IDLE_TIMEOUT", 90)) * time.Second,
+			Port:         "8080",
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  90 * time.Second,
+			// Open for development; list the frontend's origins in production
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+			AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key"},
 		},
 		Executor: ExecutorConfig{
-			ConcurrentExecutions: getEnvAsInt("CONCURRENT_EXECUTIONS", 100),
-			QueueCapacity:        getEnvAsInt("QUEUE_CAPACITY", 1000),
-			DefaultTimeout:       time.Duration(getEnvAsInt("DEFAULT_TIMEOUT", 30)) * time.Second,
+			ConcurrentExecutions: 100,
+			QueueCapacity:        1000,
+			DefaultTimeout:       30 * time.Second,
+			MaxTestCases:         100,
 		},
 		Languages: getLanguageConfigs(),
 		Sandbox: SandboxConfig{
-			NetworkDisabled: getEnvAsBool("SANDBOX_NETWORK_DISABLED", true),
-			MemorySwapLimit: getEnv("SANDBOX_MEMORY_SWAP_LIMIT", "0"),
-			PidsLimit:       int64(getEnvAsInt("SANDBOX_PIDS_LIMIT", 50)),
+			NetworkDisabled:    true,
+			MemorySwapLimit:    "0",
+			PidsLimit:          50,
+			MeasureUsage:       true,
+			CompileMemoryLimit: "512m",
+			CompileCPULimit:    "1",
+		},
+		Store: StoreConfig{
+			Backend:       StoreMemory,
+			Path:          "monaco.db",
+			TTL:           time.Hour,
+			MaxAge:        7 * 24 * time.Hour,
+			MaxCount:      100000,
+			MaxOutput:     "1g",
+			SweepInterval: 5 * time.Minute,
+		},
+		Log: LogConfig{
+			Format: LogText,
+			Level:  "info",
+		},
+		Tracing: TracingConfig{
+			SampleRatio: 1,
+			ServiceName: "monaco",
+		},
+		Health: HealthConfig{
+			MinFreeDisk:   "1g",
+			MaxQueueUsage: 0.9,
+			StuckAfter:    10 * time.Minute,
+			CheckTimeout:  5 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			IP:                   RateLimit{PerMinute: 30, Burst: 10},
+			User:                 RateLimit{PerMinute: 20, Burst: 10},
+			APIKey:               RateLimit{PerMinute: 120, Burst: 30},
+			MaxConcurrentPerUser: 5,
+			TrustedProxies:       []string{"127.0.0.1/32", "::1/128"},
 		},
 	}
 }
 
+// applyEnv overrides cfg with values set through environment variables
+func applyEnv(cfg *Config) error {
+	var errs []string
+
+	setString := func(key string, dst *string) {
+		*dst = getEnv(key, *dst)
+	}
+	setInt := func(key string, dst *int) {
+		if valueStr := os.Getenv(key); valueStr != "" {
+			value, err := strconv.Atoi(valueStr)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not an integer", key, valueStr))
+				return
+			}
+			*dst = value
+		}
+	}
+	setSeconds := func(key string, dst *time.Duration) {
+		seconds := int(*dst / time.Second)
+		setInt(key, &seconds)
+		*dst = time.Duration(seconds) * time.Second
+	}
+	setList := func(key string, dst *[]string) {
+		if value, set := os.LookupEnv(key); set {
+			*dst = splitList(value)
+		}
+	}
+	setFloat := func(key string, dst *float64) {
+		if valueStr := os.Getenv(key); valueStr != "" {
+			value, err := strconv.ParseFloat(valueStr, 64)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a number", key, valueStr))
+				return
+			}
+			*dst = value
+		}
+	}
+	setBool := func(key string, dst *bool) {
+		if valueStr := os.Getenv(key); valueStr != "" {
+			value, err := strconv.ParseBool(valueStr)
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %q is not a boolean", key, valueStr))
+				return
+			}
+			*dst = value
+		}
+	}
+
+	setString("PORT", &cfg.Server.Port)
+	setSeconds("READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	setSeconds("WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	setSeconds("IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	setList("CORS_ALLOWED_ORIGINS", &cfg.Server.AllowedOrigins)
+	setList("CORS_ALLOWED_METHODS", &cfg.Server.AllowedMethods)
+	setList("CORS_ALLOWED_HEADERS", &cfg.Server.AllowedHeaders)
+	setBool("CORS_ALLOW_CREDENTIALS", &cfg.Server.AllowCredentials)
+
+	setInt("CONCURRENT_EXECUTIONS", &cfg.Executor.ConcurrentExecutions)
+	setInt("QUEUE_CAPACITY", &cfg.Executor.QueueCapacity)
+	setSeconds("DEFAULT_TIMEOUT", &cfg.Executor.DefaultTimeout)
+	setInt("MAX_TEST_CASES", &cfg.Executor.MaxTestCases)
+
+	setBool("SANDBOX_NETWORK_DISABLED", &cfg.Sandbox.NetworkDisabled)
+	setString("SANDBOX_MEMORY_SWAP_LIMIT", &cfg.Sandbox.MemorySwapLimit)
+	pidsLimit := int(cfg.Sandbox.PidsLimit)
+	setInt("SANDBOX_PIDS_LIMIT", &pidsLimit)
+	cfg.Sandbox.PidsLimit = int64(pidsLimit)
+	setBool("SANDBOX_MEASURE_USAGE", &cfg.Sandbox.MeasureUsage)
+	setString("SANDBOX_COMPILE_MEMORY_LIMIT", &cfg.Sandbox.CompileMemoryLimit)
+	setString("SANDBOX_COMPILE_CPU_LIMIT", &cfg.Sandbox.CompileCPULimit)
+
+	setString("STORE_BACKEND", &cfg.Store.Backend)
+	setString("STORE_PATH", &cfg.Store.Path)
+	setSeconds("STORE_TTL", &cfg.Store.TTL)
+	setSeconds("STORE_MAX_AGE", &cfg.Store.MaxAge)
+	setInt("STORE_MAX_COUNT", &cfg.Store.MaxCount)
+	setString("STORE_MAX_OUTPUT", &cfg.Store.MaxOutput)
+	setSeconds("STORE_SWEEP_INTERVAL", &cfg.Store.SweepInterval)
+
+	setInt("RATE_LIMIT_IP_PER_MINUTE", &cfg.RateLimit.IP.PerMinute)
+	setInt("RATE_LIMIT_IP_BURST", &cfg.RateLimit.IP.Burst)
+	setInt("RATE_LIMIT_USER_PER_MINUTE", &cfg.RateLimit.User.PerMinute)
+	setInt("RATE_LIMIT_USER_BURST", &cfg.RateLimit.User.Burst)
+	setInt("RATE_LIMIT_API_KEY_PER_MINUTE", &cfg.RateLimit.APIKey.PerMinute)
+	setInt("RATE_LIMIT_API_KEY_BURST", &cfg.RateLimit.APIKey.Burst)
+	setInt("RATE_LIMIT_MAX_CONCURRENT_PER_USER", &cfg.RateLimit.MaxConcurrentPerUser)
+	setList("RATE_LIMIT_TRUSTED_PROXIES", &cfg.RateLimit.TrustedProxies)
+
+	setString("LOG_FORMAT", &cfg.Log.Format)
+	setString("LOG_LEVEL", &cfg.Log.Level)
+	setBool("LOG_CONTENT", &cfg.Log.Content)
+
+	setBool("TRACING_ENABLED", &cfg.Tracing.Enabled)
+	setString("TRACING_ENDPOINT", &cfg.Tracing.Endpoint)
+	setBool("TRACING_INSECURE", &cfg.Tracing.Insecure)
+	setFloat("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	setString("TRACING_SERVICE_NAME", &cfg.Tracing.ServiceName)
+
+	setString("HEALTH_MIN_FREE_DISK", &cfg.Health.MinFreeDisk)
+	setFloat("HEALTH_MAX_QUEUE_USAGE", &cfg.Health.MaxQueueUsage)
+	setSeconds("HEALTH_STUCK_AFTER", &cfg.Health.StuckAfter)
+	setSeconds("HEALTH_CHECK_TIMEOUT", &cfg.Health.CheckTimeout)
+
+	setBool("AUTH_ENABLED", &cfg.Auth.Enabled)
+	setString("AUTH_JWT_ALGORITHM", &cfg.Auth.JWT.Algorithm)
+	setString("AUTH_JWT_KEY_FILE", &cfg.Auth.JWT.KeyFile)
+	setString("AUTH_JWT_ISSUER", &cfg.Auth.JWT.Issuer)
+	setString("AUTH_JWT_AUDIENCE", &cfg.Auth.JWT.Audience)
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid environment: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
 // getLanguageConfigs returns configurations for all supported languages
 func getLanguageConfigs() map[string]LanguageConfig {
 	return map[string]LanguageConfig{
@@ -81,7 +390,8 @@ func getLanguageConfigs() map[string]LanguageConfig {
 			MemoryLimit: "100m",
 			CPULimit:    "0.1",
 			TimeoutSec:  90,
-			RunCmd:      []string{"python", "-c"},
+			RunCmd:      []string{"python", "-u", "{source}"},
+			Env:         []string{"PYTHONUNBUFFERED=1"},
 			FileExt:     ".py",
 			VersionCmd:  []string{"python", "--version"},
 		},
@@ -91,10 +401,15 @@ func getLanguageConfigs() map[string]LanguageConfig {
 			MemoryLimit: "400m",
 			CPULimit:    "0.5",
 			TimeoutSec:  100,
-			CompileCmd:  []string{"javac"},
-			RunCmd:      []string{"java"},
-			FileExt:     ".java",
-			VersionCmd:  []string{"java", "-version"},
+			SourceFile:  "{class}.java",
+			SourceHook:  "java-class-name",
+			CompileCmd:  []string{"javac", "{source}"},
+			RunCmd: []string{
+				"java", "-XX:+TieredCompilation", "-XX:TieredStopAtLevel=1",
+				"-Xms64m", "-Xmx256m", "-cp", "{dir}", "{class}",
+			},
+			FileExt:    ".java",
+			VersionCmd: []string{"java", "-version"},
 		},
 		"c": {
 			Name:        "C",
@@ -102,8 +417,9 @@ func getLanguageConfigs() map[string]LanguageConfig {
 			MemoryLimit: "100m",
 			CPULimit:    "0.1",
 			TimeoutSec:  90,
-			CompileCmd:  []string{"gcc", "-o", "program"},
-			RunCmd:      []string{"./program"},
+			SourceHook:  "c-unbuffered-main",
+			CompileCmd:  []string{"gcc", "-o", "{dir}/program", "{source}"},
+			RunCmd:      []string{"{dir}/program"},
 			FileExt:     ".c",
 			VersionCmd:  []string{"gcc", "--version"},
 		},
@@ -113,8 +429,8 @@ func getLanguageConfigs() map[string]LanguageConfig {
 			MemoryLimit: "100m",
 			CPULimit:    "0.1",
 			TimeoutSec:  90,
-			CompileCmd:  []string{"g++", "-o", "program"},
-			RunCmd:      []string{"./program"},
+			CompileCmd:  []string{"g++", "-o", "{dir}/program", "{source}"},
+			RunCmd:      []string{"{dir}/program"},
 			FileExt:     ".cpp",
 			VersionCmd:  []string{"g++", "--version"},
 		},
@@ -124,7 +440,7 @@ func getLanguageConfigs() map[string]LanguageConfig {
 			MemoryLimit: "100m",
 			CPULimit:    "0.1",
 			TimeoutSec:  90,
-			RunCmd:      []string{"node", "-e"},
+			RunCmd:      []string{"node", "{source}"},
 			FileExt:     ".js",
 			VersionCmd:  []string{"node", "--version"},
 		},
@@ -134,15 +450,27 @@ func getLanguageConfigs() map[string]LanguageConfig {
 			MemoryLimit: "100m",
 			CPULimit:    "0.1",
 			TimeoutSec:  90,
-			CompileCmd:  []string{"go", "build", "-o", "program"},
-			RunCmd:      []string{"./program"},
+			CompileCmd:  []string{"go", "build", "-o", "{dir}/program", "{source}"},
+			RunCmd:      []string{"{dir}/program"},
+			WorkDir:     "{dir}",
 			FileExt:     ".go",
 			VersionCmd:  []string{"go", "version"},
 		},
 	}
 }
 
-// Helper functions to get environment variables with defaults
+// splitList splits a comma-separated list, dropping empty entries
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getEnv returns the value of an environment variable or a default
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
 	if value == "" {
@@ -150,19 +478,3 @@ func getEnv(key, defaultValue string) string {
 	}
 	return value
 }
-
-func getEnvAsInt(key string, defaultValue int) int {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.Atoi(valueStr); err == nil {
-		return value
-	}
-	return defaultValue
-}
-
-func getEnvAsBool(key string, defaultValue bool) bool {
-	valueStr := getEnv(key, "")
-	if value, err := strconv.ParseBool(valueStr); err == nil {
-		return value
-	}
-	return defaultValue
-}
@@ -0,0 +1,253 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the on-disk layout of the configuration file. Durations are
+// given in whole seconds, matching the environment variables.
+type fileConfig struct {
+	Server    serverFile              `json:"server" yaml:"server"`
+	Executor  executorFile            `json:"executor" yaml:"executor"`
+	Sandbox   sandboxFile             `json:"sandbox" yaml:"sandbox"`
+	Store     storeFile               `json:"store" yaml:"store"`
+	RateLimit rateLimitFile           `json:"rateLimit" yaml:"rateLimit"`
+	Auth      authFile                `json:"auth" yaml:"auth"`
+	Log       logFile                 `json:"log" yaml:"log"`
+	Tracing   tracingFile             `json:"tracing" yaml:"tracing"`
+	Health    healthFile              `json:"health" yaml:"health"`
+	Languages map[string]languageFile `json:"languages" yaml:"languages"`
+}
+
+// languageFile is a language in the config file. Setting enabled to false
+// removes the built-in language with that key instead of defining one.
+type languageFile struct {
+	LanguageConfig `yaml:",inline"`
+	Enabled        *bool `json:"enabled,omitempty" yaml:"enabled"`
+}
+
+type serverFile struct {
+	Port             string   `json:"port" yaml:"port"`
+	ReadTimeoutSec   int      `json:"readTimeoutSec" yaml:"readTimeoutSec"`
+	WriteTimeoutSec  int      `json:"writeTimeoutSec" yaml:"writeTimeoutSec"`
+	IdleTimeoutSec   int      `json:"idleTimeoutSec" yaml:"idleTimeoutSec"`
+	AllowedOrigins   []string `json:"allowedOrigins" yaml:"allowedOrigins"`
+	AllowedMethods   []string `json:"allowedMethods" yaml:"allowedMethods"`
+	AllowedHeaders   []string `json:"allowedHeaders" yaml:"allowedHeaders"`
+	AllowCredentials bool     `json:"allowCredentials" yaml:"allowCredentials"`
+}
+
+type executorFile struct {
+	ConcurrentExecutions int `json:"concurrentExecutions" yaml:"concurrentExecutions"`
+	QueueCapacity        int `json:"queueCapacity" yaml:"queueCapacity"`
+	DefaultTimeoutSec    int `json:"defaultTimeoutSec" yaml:"defaultTimeoutSec"`
+	MaxTestCases         int `json:"maxTestCases" yaml:"maxTestCases"`
+}
+
+type sandboxFile struct {
+	NetworkDisabled    bool   `json:"networkDisabled" yaml:"networkDisabled"`
+	MemorySwapLimit    string `json:"memorySwapLimit" yaml:"memorySwapLimit"`
+	PidsLimit          int64  `json:"pidsLimit" yaml:"pidsLimit"`
+	MeasureUsage       bool   `json:"measureUsage" yaml:"measureUsage"`
+	CompileMemoryLimit string `json:"compileMemoryLimit" yaml:"compileMemoryLimit"`
+	CompileCPULimit    string `json:"compileCpuLimit" yaml:"compileCpuLimit"`
+}
+
+type storeFile struct {
+	Backend          string `json:"backend" yaml:"backend"`
+	Path             string `json:"path" yaml:"path"`
+	TTLSec           int    `json:"ttlSec" yaml:"ttlSec"`
+	MaxAgeSec        int    `json:"maxAgeSec" yaml:"maxAgeSec"`
+	MaxCount         int    `json:"maxCount" yaml:"maxCount"`
+	MaxOutput        string `json:"maxOutput" yaml:"maxOutput"`
+	SweepIntervalSec int    `json:"sweepIntervalSec" yaml:"sweepIntervalSec"`
+}
+
+type rateLimitFile struct {
+	IP                   rateFile `json:"ip" yaml:"ip"`
+	User                 rateFile `json:"user" yaml:"user"`
+	APIKey               rateFile `json:"apiKey" yaml:"apiKey"`
+	MaxConcurrentPerUser int      `json:"maxConcurrentPerUser" yaml:"maxConcurrentPerUser"`
+	TrustedProxies       []string `json:"trustedProxies" yaml:"trustedProxies"`
+}
+
+type rateFile struct {
+	PerMinute int `json:"perMinute" yaml:"perMinute"`
+	Burst     int `json:"burst" yaml:"burst"`
+}
+
+type logFile struct {
+	Format  string `json:"format" yaml:"format"`
+	Level   string `json:"level" yaml:"level"`
+	Content bool   `json:"content" yaml:"content"`
+}
+
+type tracingFile struct {
+	Enabled     bool    `json:"enabled" yaml:"enabled"`
+	Endpoint    string  `json:"endpoint" yaml:"endpoint"`
+	Insecure    bool    `json:"insecure" yaml:"insecure"`
+	SampleRatio float64 `json:"sampleRatio" yaml:"sampleRatio"`
+	ServiceName string  `json:"serviceName" yaml:"serviceName"`
+}
+
+type healthFile struct {
+	MinFreeDisk     string  `json:"minFreeDisk" yaml:"minFreeDisk"`
+	MaxQueueUsage   float64 `json:"maxQueueUsage" yaml:"maxQueueUsage"`
+	StuckAfterSec   int     `json:"stuckAfterSec" yaml:"stuckAfterSec"`
+	CheckTimeoutSec int     `json:"checkTimeoutSec" yaml:"checkTimeoutSec"`
+}
+
+type authFile struct {
+	Enabled bool           `json:"enabled" yaml:"enabled"`
+	APIKeys []APIKeyConfig `json:"apiKeys" yaml:"apiKeys"`
+	JWT     jwtFile        `json:"jwt" yaml:"jwt"`
+}
+
+type jwtFile struct {
+	Algorithm string `json:"algorithm" yaml:"algorithm"`
+	KeyFile   string `json:"keyFile" yaml:"keyFile"`
+	Issuer    string `json:"issuer" yaml:"issuer"`
+	Audience  string `json:"audience" yaml:"audience"`
+}
+
+// loadFile overlays the config file at path onto cfg. Sections and fields
+// missing from the file keep their current values; a language defined in the
+// file replaces the built-in definition with the same key, and one disabled
+// in the file removes it.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	// Start from the current values so omitted fields are left untouched
+	fc := fileConfig{
+		Server: serverFile{
+			Port:             cfg.Server.Port,
+			ReadTimeoutSec:   int(cfg.Server.ReadTimeout / time.Second),
+			WriteTimeoutSec:  int(cfg.Server.WriteTimeout / time.Second),
+			IdleTimeoutSec:   int(cfg.Server.IdleTimeout / time.Second),
+			AllowedOrigins:   cfg.Server.AllowedOrigins,
+			AllowedMethods:   cfg.Server.AllowedMethods,
+			AllowedHeaders:   cfg.Server.AllowedHeaders,
+			AllowCredentials: cfg.Server.AllowCredentials,
+		},
+		Executor: executorFile{
+			ConcurrentExecutions: cfg.Executor.ConcurrentExecutions,
+			QueueCapacity:        cfg.Executor.QueueCapacity,
+			DefaultTimeoutSec:    int(cfg.Executor.DefaultTimeout / time.Second),
+			MaxTestCases:         cfg.Executor.MaxTestCases,
+		},
+		Sandbox: sandboxFile(cfg.Sandbox),
+		Store: storeFile{
+			Backend:          cfg.Store.Backend,
+			Path:             cfg.Store.Path,
+			TTLSec:           int(cfg.Store.TTL / time.Second),
+			MaxAgeSec:        int(cfg.Store.MaxAge / time.Second),
+			MaxCount:         cfg.Store.MaxCount,
+			MaxOutput:        cfg.Store.MaxOutput,
+			SweepIntervalSec: int(cfg.Store.SweepInterval / time.Second),
+		},
+		RateLimit: rateLimitFile{
+			IP:                   rateFile(cfg.RateLimit.IP),
+			User:                 rateFile(cfg.RateLimit.User),
+			APIKey:               rateFile(cfg.RateLimit.APIKey),
+			MaxConcurrentPerUser: cfg.RateLimit.MaxConcurrentPerUser,
+			TrustedProxies:       cfg.RateLimit.TrustedProxies,
+		},
+		Log:     logFile(cfg.Log),
+		Tracing: tracingFile(cfg.Tracing),
+		Health: healthFile{
+			MinFreeDisk:     cfg.Health.MinFreeDisk,
+			MaxQueueUsage:   cfg.Health.MaxQueueUsage,
+			StuckAfterSec:   int(cfg.Health.StuckAfter / time.Second),
+			CheckTimeoutSec: int(cfg.Health.CheckTimeout / time.Second),
+		},
+		Auth: authFile{
+			Enabled: cfg.Auth.Enabled,
+			APIKeys: cfg.Auth.APIKeys,
+			JWT:     jwtFile(cfg.Auth.JWT),
+		},
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(&fc)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(&fc)
+	default:
+		return fmt.Errorf("config file %s: unsupported format (use .json, .yaml or .yml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	cfg.Server = ServerConfig{
+		Port:         fc.Server.Port,
+		ReadTimeout:  time.Duration(fc.Server.ReadTimeoutSec) * time.Second,
+		WriteTimeout: time.Duration(fc.Server.WriteTimeoutSec) * time.Second,
+		IdleTimeout:  time.Duration(fc.Server.IdleTimeoutSec) * time.Second,
+
+		AllowedOrigins:   fc.Server.AllowedOrigins,
+		AllowedMethods:   fc.Server.AllowedMethods,
+		AllowedHeaders:   fc.Server.AllowedHeaders,
+		AllowCredentials: fc.Server.AllowCredentials,
+	}
+	cfg.Executor = ExecutorConfig{
+		ConcurrentExecutions: fc.Executor.ConcurrentExecutions,
+		QueueCapacity:        fc.Executor.QueueCapacity,
+		DefaultTimeout:       time.Duration(fc.Executor.DefaultTimeoutSec) * time.Second,
+		MaxTestCases:         fc.Executor.MaxTestCases,
+	}
+	cfg.Sandbox = SandboxConfig(fc.Sandbox)
+	cfg.Store = StoreConfig{
+		Backend:       fc.Store.Backend,
+		Path:          fc.Store.Path,
+		TTL:           time.Duration(fc.Store.TTLSec) * time.Second,
+		MaxAge:        time.Duration(fc.Store.MaxAgeSec) * time.Second,
+		MaxCount:      fc.Store.MaxCount,
+		MaxOutput:     fc.Store.MaxOutput,
+		SweepInterval: time.Duration(fc.Store.SweepIntervalSec) * time.Second,
+	}
+	cfg.RateLimit = RateLimitConfig{
+		IP:                   RateLimit(fc.RateLimit.IP),
+		User:                 RateLimit(fc.RateLimit.User),
+		APIKey:               RateLimit(fc.RateLimit.APIKey),
+		MaxConcurrentPerUser: fc.RateLimit.MaxConcurrentPerUser,
+		TrustedProxies:       fc.RateLimit.TrustedProxies,
+	}
+	cfg.Log = LogConfig(fc.Log)
+	cfg.Tracing = TracingConfig(fc.Tracing)
+	cfg.Health = HealthConfig{
+		MinFreeDisk:   fc.Health.MinFreeDisk,
+		MaxQueueUsage: fc.Health.MaxQueueUsage,
+		StuckAfter:    time.Duration(fc.Health.StuckAfterSec) * time.Second,
+		CheckTimeout:  time.Duration(fc.Health.CheckTimeoutSec) * time.Second,
+	}
+	cfg.Auth = AuthConfig{
+		Enabled: fc.Auth.Enabled,
+		APIKeys: fc.Auth.APIKeys,
+		JWT:     JWTConfig(fc.Auth.JWT),
+	}
+	for key, language := range fc.Languages {
+		if language.Enabled != nil && !*language.Enabled {
+			delete(cfg.Languages, strings.ToLower(key))
+			continue
+		}
+		cfg.Languages[strings.ToLower(key)] = language.LanguageConfig
+	}
+
+	return nil
+}
@@ -0,0 +1,331 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MinMemoryBytes is the smallest memory limit Docker accepts
+const MinMemoryBytes = 6 * 1024 * 1024
+
+// placeholderRegex matches a {name} placeholder in a language template.
+// Braces around anything that is not a name, like a shell's {1..3}, are left
+// alone.
+var placeholderRegex = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// builtinPlaceholders are defined for every language; a source hook may add more
+var builtinPlaceholders = []string{"dir", "file", "source"}
+
+// memoryRegex matches Docker memory sizes such as "512k", "100m" or "1g"
+var memoryRegex = regexp.MustCompile(`^(\d+)([bkmg]?)$`)
+
+// ParseMemory converts a Docker memory size such as "100m" into bytes
+func ParseMemory(s string) (int64, error) {
+	matches := memoryRegex.FindStringSubmatch(strings.ToLower(strings.TrimSpace(s)))
+	if matches == nil {
+		return 0, fmt.Errorf("malformed memory size %q (expected e.g. 512k, 100m, 1g)", s)
+	}
+
+	value, err := strconv.ParseInt(matches[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("malformed memory size %q: %w", s, err)
+	}
+
+	switch matches[2] {
+	case "k":
+		value <<= 10
+	case "m":
+		value <<= 20
+	case "g":
+		value <<= 30
+	}
+	return value, nil
+}
+
+// Validate checks the configuration for values the server cannot run with.
+// All problems are reported together.
+func (c *Config) Validate() error {
+	var errs []string
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Sprintf(format, args...))
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		fail("server.port: %q is not a valid port", c.Server.Port)
+	}
+	if c.Server.ReadTimeout <= 0 {
+		fail("server.readTimeoutSec: must be positive")
+	}
+	if c.Server.WriteTimeout <= 0 {
+		fail("server.writeTimeoutSec: must be positive")
+	}
+	if c.Server.IdleTimeout <= 0 {
+		fail("server.idleTimeoutSec: must be positive")
+	}
+
+	for _, origin := range c.Server.AllowedOrigins {
+		if origin == "*" {
+			if c.Server.AllowCredentials {
+				fail("server.allowCredentials: cannot be combined with the \"*\" origin")
+			}
+			continue
+		}
+		if !strings.Contains(origin, "://") || strings.HasSuffix(origin, "/") {
+			fail("server.allowedOrigins: %q is not an origin like https://example.com", origin)
+		} else if strings.Contains(origin, "*") && (strings.Count(origin, "*") > 1 || !strings.Contains(origin, "://*.")) {
+			fail("server.allowedOrigins: %q may only use \"*\" for leading subdomains, like https://*.example.com", origin)
+		}
+	}
+	if len(c.Server.AllowedMethods) == 0 {
+		fail("server.allowedMethods: at least one method must be allowed")
+	}
+
+	if c.Executor.ConcurrentExecutions <= 0 {
+		fail("executor.concurrentExecutions: must be positive")
+	}
+	if c.Executor.QueueCapacity <= 0 {
+		fail("executor.queueCapacity: must be positive")
+	}
+	if c.Executor.DefaultTimeout <= 0 {
+		fail("executor.defaultTimeoutSec: must be positive")
+	}
+	if c.Executor.MaxTestCases <= 0 {
+		fail("executor.maxTestCases: must be positive")
+	}
+
+	// Docker treats a swap limit of 0 as unset and -1 as unlimited
+	if swap := c.Sandbox.MemorySwapLimit; swap != "" && swap != "0" && swap != "-1" {
+		if _, err := ParseMemory(swap); err != nil {
+			fail("sandbox.memorySwapLimit: %v", err)
+		}
+	}
+	if c.Sandbox.PidsLimit < 0 {
+		fail("sandbox.pidsLimit: must not be negative")
+	}
+	if memory, err := ParseMemory(c.Sandbox.CompileMemoryLimit); err != nil {
+		fail("sandbox.compileMemoryLimit: %v", err)
+	} else if memory < MinMemoryBytes {
+		fail("sandbox.compileMemoryLimit: %q is below Docker's 6m minimum", c.Sandbox.CompileMemoryLimit)
+	}
+	if cpus, err := strconv.ParseFloat(c.Sandbox.CompileCPULimit, 64); err != nil || cpus <= 0 {
+		fail("sandbox.compileCpuLimit: %q is not a positive number", c.Sandbox.CompileCPULimit)
+	}
+
+	switch c.Store.Backend {
+	case StoreMemory:
+	case StoreBolt:
+		if c.Store.Path == "" {
+			fail("store.path: must be set for the %s backend", StoreBolt)
+		}
+	default:
+		fail("store.backend: %q is not one of %s, %s", c.Store.Backend, StoreMemory, StoreBolt)
+	}
+	if c.Store.TTL < 0 {
+		fail("store.ttlSec: must not be negative")
+	}
+	if c.Store.MaxAge < 0 {
+		fail("store.maxAgeSec: must not be negative")
+	}
+	if c.Store.MaxCount < 0 {
+		fail("store.maxCount: must not be negative")
+	}
+	if c.Store.MaxOutput != "" && c.Store.MaxOutput != "0" {
+		if _, err := ParseMemory(c.Store.MaxOutput); err != nil {
+			fail("store.maxOutput: %v", err)
+		}
+	}
+	if c.Store.SweepInterval <= 0 {
+		fail("store.sweepIntervalSec: must be positive")
+	}
+
+	for _, limit := range []struct {
+		name string
+		RateLimit
+	}{{"ip", c.RateLimit.IP}, {"user", c.RateLimit.User}, {"apiKey", c.RateLimit.APIKey}} {
+		if limit.PerMinute < 0 {
+			fail("rateLimit.%s.perMinute: must not be negative", limit.name)
+		}
+		if limit.PerMinute > 0 && limit.Burst <= 0 {
+			fail("rateLimit.%s.burst: must be positive when perMinute is set", limit.name)
+		}
+	}
+	if c.RateLimit.MaxConcurrentPerUser < 0 {
+		fail("rateLimit.maxConcurrentPerUser: must not be negative")
+	}
+	for _, cidr := range c.RateLimit.TrustedProxies {
+		if _, _, err := net.ParseCIDR(cidr); err != nil {
+			fail("rateLimit.trustedProxies: %q is not a CIDR", cidr)
+		}
+	}
+
+	if c.Log.Format != LogJSON && c.Log.Format != LogText {
+		fail("log.format: %q is not one of %s, %s", c.Log.Format, LogJSON, LogText)
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Log.Level)); err != nil {
+		fail("log.level: %q is not one of debug, info, warn, error", c.Log.Level)
+	}
+
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		fail("tracing.sampleRatio: must be between 0 and 1")
+	}
+	if strings.Contains(c.Tracing.Endpoint, "/") {
+		fail("tracing.endpoint: %q is not a host:port", c.Tracing.Endpoint)
+	}
+	if c.Tracing.Enabled && c.Tracing.ServiceName == "" {
+		fail("tracing.serviceName: must be set when tracing is enabled")
+	}
+
+	if c.Health.MinFreeDisk != "0" {
+		if _, err := ParseMemory(c.Health.MinFreeDisk); err != nil {
+			fail("health.minFreeDisk: %v", err)
+		}
+	}
+	if c.Health.MaxQueueUsage <= 0 || c.Health.MaxQueueUsage > 1 {
+		fail("health.maxQueueUsage: must be above 0 and at most 1")
+	}
+	if c.Health.StuckAfter <= 0 {
+		fail("health.stuckAfterSec: must be positive")
+	}
+	if c.Health.CheckTimeout <= 0 {
+		fail("health.checkTimeoutSec: must be positive")
+	}
+
+	switch c.Auth.JWT.Algorithm {
+	case "":
+	case JWTHS256, JWTRS256:
+		if c.Auth.JWT.KeyFile == "" {
+			fail("auth.jwt.keyFile: must be set when an algorithm is")
+		}
+	default:
+		fail("auth.jwt.algorithm: %q is not one of %s, %s", c.Auth.JWT.Algorithm, JWTHS256, JWTRS256)
+	}
+	if c.Auth.Enabled && len(c.Auth.APIKeys) == 0 && c.Auth.JWT.Algorithm == "" {
+		fail("auth: enabled without any API keys or JWT algorithm")
+	}
+	seenKeys := make(map[string]bool)
+	for i, apiKey := range c.Auth.APIKeys {
+		if apiKey.Key == "" {
+			fail("auth.apiKeys[%d].key: must be set", i)
+		} else if seenKeys[apiKey.Key] {
+			fail("auth.apiKeys[%d].key: duplicates an earlier key", i)
+		}
+		seenKeys[apiKey.Key] = true
+		if apiKey.Subject == "" {
+			fail("auth.apiKeys[%d].subject: must be set", i)
+		}
+		for _, role := range apiKey.Roles {
+			if role != RoleViewer && role != RoleAdmin {
+				fail("auth.apiKeys[%d].roles: %q is not one of %s, %s", i, role, RoleViewer, RoleAdmin)
+			}
+		}
+	}
+
+	if len(c.Languages) == 0 {
+		fail("languages: at least one language must be configured")
+	}
+
+	// Sort keys so errors come out in a stable order
+	keys := make([]string, 0, len(c.Languages))
+	for key := range c.Languages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		for _, err := range c.Languages[key].validate() {
+			fail("languages.%s.%s", key, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// validate returns the problems with a single language definition
+func (l LanguageConfig) validate() []string {
+	var errs []string
+
+	if l.Image == "" {
+		errs = append(errs, "image: must be set")
+	}
+	if len(l.RunCmd) == 0 {
+		errs = append(errs, "runCmd: must be set")
+	}
+	if l.SourceFile == "" && l.FileExt == "" {
+		errs = append(errs, "fileExt: must be set when sourceFile is empty")
+	}
+	if l.TimeoutSec <= 0 {
+		errs = append(errs, "timeoutSec: must be positive")
+	}
+	if l.CompileTimeoutSec < 0 {
+		errs = append(errs, "compileTimeoutSec: must not be negative")
+	}
+
+	if memory, err := ParseMemory(l.MemoryLimit); err != nil {
+		errs = append(errs, "memoryLimit: "+err.Error())
+	} else if memory < MinMemoryBytes {
+		errs = append(errs, fmt.Sprintf("memoryLimit: %q is below Docker's 6m minimum", l.MemoryLimit))
+	}
+
+	if cpus, err := strconv.ParseFloat(l.CPULimit, 64); err != nil || cpus <= 0 {
+		errs = append(errs, fmt.Sprintf("cpuLimit: %q is not a positive number", l.CPULimit))
+	}
+
+	// The source file name defines {file} and {source}, so it cannot use them
+	if strings.Contains(l.SourceFile, "{file}") || strings.Contains(l.SourceFile, "{source}") {
+		errs = append(errs, fmt.Sprintf("sourceFile: %q cannot use {file} or {source}", l.SourceFile))
+	}
+	if strings.ContainsAny(l.SourceFile, `/\`) {
+		errs = append(errs, fmt.Sprintf("sourceFile: %q must be a file name, not a path", l.SourceFile))
+	}
+
+	// The placeholders of a source hook are only known to the executor, which
+	// checks languages with hooks against them
+	if l.SourceHook == "" {
+		errs = append(errs, l.CheckPlaceholders(nil)...)
+	}
+
+	return errs
+}
+
+// CheckPlaceholders returns a problem for every placeholder in the language's
+// templates that is neither built in nor one of extra
+func (l LanguageConfig) CheckPlaceholders(extra []string) []string {
+	known := make(map[string]bool)
+	for _, names := range [][]string{builtinPlaceholders, extra} {
+		for _, name := range names {
+			known[name] = true
+		}
+	}
+
+	templates := []struct {
+		field string
+		list  []string
+	}{
+		{"sourceFile", []string{l.SourceFile}},
+		{"compileCmd", l.CompileCmd},
+		{"runCmd", l.RunCmd},
+		{"env", l.Env},
+		{"workDir", []string{l.WorkDir}},
+	}
+
+	var errs []string
+	for _, template := range templates {
+		for _, s := range template.list {
+			for _, match := range placeholderRegex.FindAllStringSubmatch(s, -1) {
+				if !known[match[1]] {
+					errs = append(errs, fmt.Sprintf("%s: unknown placeholder %s in %q", template.field, match[0], s))
+				}
+			}
+		}
+	}
+	return errs
+}
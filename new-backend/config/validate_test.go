@@ -0,0 +1,232 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDefaultConfigIsValid(t *testing.T) {
+	if err := defaultConfig().Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	// language edits the python definition of the default configuration
+	language := func(edit func(l *LanguageConfig)) func(c *Config) {
+		return func(c *Config) {
+			l := c.Languages["python"]
+			edit(&l)
+			c.Languages["python"] = l
+		}
+	}
+
+	tests := []struct {
+		name    string
+		edit    func(c *Config)
+		wantErr string // Empty if the configuration is valid
+	}{
+		// Templates
+		{"builtin placeholders", language(func(l *LanguageConfig) {
+			l.CompileCmd = []string{"cc", "-o", "{dir}/program", "{source}"}
+			l.RunCmd = []string{"run", "{file}"}
+			l.Env = []string{"HOME={dir}"}
+			l.WorkDir = "{dir}"
+		}), ""},
+		{"shell braces", language(func(l *LanguageConfig) {
+			l.RunCmd = []string{"sh", "-c", "for i in {1..3}; do python {source}; done"}
+		}), ""},
+		{"unknown placeholder", language(func(l *LanguageConfig) {
+			l.RunCmd = []string{"python", "{src}"}
+		}), `languages.python.runCmd: unknown placeholder {src} in "{src}"`},
+		{"unknown placeholder in env", language(func(l *LanguageConfig) {
+			l.Env = []string{"CLASS={class}"}
+		}), `languages.python.env: unknown placeholder {class}`},
+		{"hook placeholders left to the executor", language(func(l *LanguageConfig) {
+			l.SourceHook = "java-class-name"
+			l.SourceFile = "{class}.py"
+			l.RunCmd = []string{"python", "{class}"}
+		}), ""},
+		{"source file defined by itself", language(func(l *LanguageConfig) {
+			l.SourceFile = "{file}.py"
+		}), `languages.python.sourceFile: "{file}.py" cannot use {file} or {source}`},
+		{"source file path", language(func(l *LanguageConfig) {
+			l.SourceFile = "../main.py"
+		}), `languages.python.sourceFile: "../main.py" must be a file name, not a path`},
+
+		// Limits
+		{"malformed memory limit", language(func(l *LanguageConfig) { l.MemoryLimit = "100x" }),
+			`languages.python.memoryLimit: malformed memory size "100x"`},
+		{"memory limit below minimum", language(func(l *LanguageConfig) { l.MemoryLimit = "4m" }),
+			`languages.python.memoryLimit: "4m" is below Docker's 6m minimum`},
+		{"zero cpu limit", language(func(l *LanguageConfig) { l.CPULimit = "0" }),
+			`languages.python.cpuLimit: "0" is not a positive number`},
+		{"zero timeout", language(func(l *LanguageConfig) { l.TimeoutSec = 0 }),
+			"languages.python.timeoutSec: must be positive"},
+		{"negative compile timeout", language(func(l *LanguageConfig) { l.CompileTimeoutSec = -1 }),
+			"languages.python.compileTimeoutSec: must not be negative"},
+		{"compile memory limit", func(c *Config) { c.Sandbox.CompileMemoryLimit = "1k" },
+			`sandbox.compileMemoryLimit: "1k" is below Docker's 6m minimum`},
+		{"compile cpu limit", func(c *Config) { c.Sandbox.CompileCPULimit = "fast" },
+			`sandbox.compileCpuLimit: "fast" is not a positive number`},
+		{"swap limit", func(c *Config) { c.Sandbox.MemorySwapLimit = "lots" },
+			`sandbox.memorySwapLimit: malformed memory size "lots"`},
+		{"unlimited swap", func(c *Config) { c.Sandbox.MemorySwapLimit = "-1" }, ""},
+		{"queue capacity", func(c *Config) { c.Executor.QueueCapacity = 0 },
+			"executor.queueCapacity: must be positive"},
+		{"max test cases", func(c *Config) { c.Executor.MaxTestCases = 0 },
+			"executor.maxTestCases: must be positive"},
+		{"rate limit burst", func(c *Config) { c.RateLimit.IP.Burst = 0 },
+			"rateLimit.ip.burst: must be positive when perMinute is set"},
+
+		// Languages
+		{"no languages", func(c *Config) { c.Languages = nil },
+			"languages: at least one language must be configured"},
+		{"missing image", language(func(l *LanguageConfig) { l.Image = "" }),
+			"languages.python.image: must be set"},
+		{"missing run command", language(func(l *LanguageConfig) { l.RunCmd = nil }),
+			"languages.python.runCmd: must be set"},
+		{"missing file extension", language(func(l *LanguageConfig) { l.FileExt = "" }),
+			"languages.python.fileExt: must be set when sourceFile is empty"},
+		{"source file instead of extension", language(func(l *LanguageConfig) {
+			l.FileExt = ""
+			l.SourceFile = "main.py"
+		}), ""},
+
+		// Origins
+		{"explicit origins", func(c *Config) {
+			c.Server.AllowedOrigins = []string{"https://exam.example.com", "http://localhost:5173"}
+			c.Server.AllowCredentials = true
+		}, ""},
+		{"subdomain wildcard", func(c *Config) { c.Server.AllowedOrigins = []string{"https://*.example.com"} }, ""},
+		{"missing scheme", func(c *Config) { c.Server.AllowedOrigins = []string{"example.com"} },
+			`server.allowedOrigins: "example.com" is not an origin like https://example.com`},
+		{"trailing slash", func(c *Config) { c.Server.AllowedOrigins = []string{"https://example.com/"} },
+			`server.allowedOrigins: "https://example.com/" is not an origin`},
+		{"partial label wildcard", func(c *Config) { c.Server.AllowedOrigins = []string{"https://*example.com"} },
+			`server.allowedOrigins: "https://*example.com" may only use "*" for leading subdomains`},
+		{"inner wildcard", func(c *Config) { c.Server.AllowedOrigins = []string{"https://api.*.example.com"} },
+			`server.allowedOrigins: "https://api.*.example.com" may only use "*" for leading subdomains`},
+		{"two wildcards", func(c *Config) { c.Server.AllowedOrigins = []string{"https://*.*.example.com"} },
+			`server.allowedOrigins: "https://*.*.example.com" may only use "*" for leading subdomains`},
+		{"any origin with credentials", func(c *Config) { c.Server.AllowCredentials = true },
+			`server.allowCredentials: cannot be combined with the "*" origin`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := defaultConfig()
+			tt.edit(cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate() = %v, want nil", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("Validate() = nil, want an error containing %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("Validate() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Server.Port = "http"
+	cfg.Executor.DefaultTimeout = 0
+	cfg.Languages["python"] = LanguageConfig{}
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate() = nil, want an error")
+	}
+	for _, want := range []string{
+		`server.port: "http" is not a valid port`,
+		"executor.defaultTimeoutSec: must be positive",
+		"languages.python.image: must be set",
+		"languages.python.runCmd: must be set",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	write := func(t *testing.T, content string) string {
+		path := filepath.Join(t.TempDir(), "monaco.yaml")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	t.Run("example", func(t *testing.T) {
+		cfg := defaultConfig()
+		if err := loadFile("../monaco.example.yaml", cfg); err != nil {
+			t.Fatal(err)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Languages["ruby"].Image; got != "ruby:3.2-alpine" {
+			t.Errorf("ruby image = %q, want ruby:3.2-alpine", got)
+		}
+		if _, exists := cfg.Languages["cpp"]; !exists {
+			t.Error("built-in language dropped by the file")
+		}
+		if _, exists := cfg.Languages["golang"]; exists {
+			t.Error("disabled built-in language kept")
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		cfg := defaultConfig()
+		path := write(t, `
+languages:
+  Python:
+    enabled: false
+  java:
+    enabled: true
+    image: openjdk:21
+    memoryLimit: 400m
+    cpuLimit: "1"
+    timeoutSec: 10
+    runCmd: [java, "{source}"]
+    fileExt: .java
+`)
+		if err := loadFile(path, cfg); err != nil {
+			t.Fatal(err)
+		}
+		if _, exists := cfg.Languages["python"]; exists {
+			t.Error("python kept after enabled: false")
+		}
+		if got := cfg.Languages["java"].Image; got != "openjdk:21" {
+			t.Errorf("java image = %q, want openjdk:21", got)
+		}
+		if err := cfg.Validate(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		cfg := defaultConfig()
+		if err := loadFile(write(t, "executor:\n  queueCapacty: 10\n"), cfg); err == nil {
+			t.Error("loadFile accepted an unknown key")
+		}
+	})
+
+	t.Run("invalid language", func(t *testing.T) {
+		cfg := defaultConfig()
+		path := write(t, "languages:\n  python:\n    image: python:3.12\n    memoryLimit: 100mb\n")
+		if err := loadFile(path, cfg); err != nil {
+			t.Fatal(err)
+		}
+		err := cfg.Validate()
+		if err == nil || !strings.Contains(err.Error(), `languages.python.memoryLimit: malformed memory size "100mb"`) {
+			t.Errorf("Validate() = %v, want a malformed memory size", err)
+		}
+	})
+}
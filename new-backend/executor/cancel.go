@@ -0,0 +1,176 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/ishikabhoyar/monaco/new-backend/store"
+	"github.com/ishikabhoyar/monaco/new-backend/tracing"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrAlreadyFinished is returned when cancelling a submission that has ended
+var ErrAlreadyFinished = errors.New("submission has already finished")
+
+// ErrQueueFull is returned by SubmitCode when no more submissions can wait
+var ErrQueueFull = errors.New("execution queue is full")
+
+// ErrTooManyActive is returned by SubmitCode when the submitter already has
+// the configured maximum of submissions queued or running
+var ErrTooManyActive = errors.New("too many submissions in progress")
+
+// job tracks a submission from SubmitCode until its run ends
+type job struct {
+	ctx       context.Context // Cancelled to stop the run
+	cancel    context.CancelFunc
+	userID    string
+	logger    *slog.Logger // Tagged with the submission and, once started, the worker
+	queueSpan trace.Span   // Ends when the job leaves the queue
+	started   bool         // A worker has picked it up
+}
+
+// addJob starts tracking a newly queued submission. Its spans become children
+// of the span in ctx, which may end long before the submission runs. It
+// returns ErrTooManyActive, without tracking the submission, if its user
+// already has rateLimit.maxConcurrentPerUser submissions queued or running;
+// the check and the addition are atomic, so concurrent calls cannot exceed it.
+func (e *CodeExecutor) addJob(ctx context.Context, submission *models.CodeSubmission) error {
+	e.jobsMutex.Lock()
+	defer e.jobsMutex.Unlock()
+
+	if max := e.config.RateLimit.MaxConcurrentPerUser; max > 0 && submission.UserID != "" &&
+		e.activeSubmissions(submission.UserID) >= max {
+		return ErrTooManyActive
+	}
+
+	parent := trace.SpanContextFromContext(ctx)
+	jobCtx, cancel := context.WithCancel(trace.ContextWithSpanContext(context.Background(), parent))
+	_, queueSpan := tracing.Start(jobCtx, "queue", tracing.Submission(submission))
+
+	logger := logging.ForSubmission(slog.Default(), submission)
+	if parent.HasTraceID() {
+		logger = logger.With("trace", parent.TraceID().String())
+	}
+
+	e.jobs[submission.ID] = &job{
+		ctx:       jobCtx,
+		cancel:    cancel,
+		userID:    submission.UserID,
+		logger:    logger,
+		queueSpan: queueSpan,
+	}
+	return nil
+}
+
+// activeSubmissions returns how many submissions of a user are queued or
+// running. The caller must hold jobsMutex.
+func (e *CodeExecutor) activeSubmissions(userID string) int {
+	count := 0
+	for _, j := range e.jobs {
+		if j.userID == userID {
+			count++
+		}
+	}
+	return count
+}
+
+// startJob marks a job as picked up by a worker. It returns nil if the job
+// was cancelled while queued.
+func (e *CodeExecutor) startJob(id string, worker int) *job {
+	e.jobsMutex.Lock()
+	defer e.jobsMutex.Unlock()
+
+	j, exists := e.jobs[id]
+	if !exists {
+		return nil
+	}
+	j.started = true
+	j.logger = j.logger.With("worker", worker)
+	j.queueSpan.End()
+	return j
+}
+
+// submissionLogger returns the logger of a queued or running submission, or
+// one tagged with just its ID once it has finished
+func (e *CodeExecutor) submissionLogger(id string) *slog.Logger {
+	e.jobsMutex.Lock()
+	defer e.jobsMutex.Unlock()
+
+	if j, exists := e.jobs[id]; exists {
+		return j.logger
+	}
+	return slog.With("submission", id)
+}
+
+// finishJob stops tracking a job
+func (e *CodeExecutor) finishJob(id string) {
+	e.jobsMutex.Lock()
+	defer e.jobsMutex.Unlock()
+
+	j, exists := e.jobs[id]
+	if !exists {
+		return
+	}
+	delete(e.jobs, id)
+	j.cancel()
+	if !j.started {
+		j.queueSpan.End()
+	}
+}
+
+// Cancel stops a submission. A queued submission is removed from the queue
+// and marked cancelled at once; a running one has its processes killed and
+// is marked cancelled by its worker shortly after, unless its run had
+// already ended, in which case its result stands. It returns
+// store.ErrNotFound for unknown submissions and ErrAlreadyFinished for ones
+// that have already ended.
+func (e *CodeExecutor) Cancel(id string) error {
+	e.jobsMutex.Lock()
+	j, exists := e.jobs[id]
+	if exists {
+		j.cancel()
+		if !j.started {
+			// A worker that already popped it skips jobs it cannot find
+			delete(e.jobs, id)
+			j.queueSpan.AddEvent("cancelled")
+			j.queueSpan.End()
+		}
+	}
+	e.jobsMutex.Unlock()
+
+	if exists {
+		j.logger.Info("cancelling submission", "running", j.started)
+	}
+
+	if exists && !j.started && e.queue.remove(id) {
+		e.broadcastQueuePositions()
+	}
+
+	if !exists {
+		if _, found := e.GetSubmission(id); found {
+			return ErrAlreadyFinished
+		}
+		return store.ErrNotFound
+	}
+
+	if j.started {
+		e.sendToTerminals(id, models.NewSystemMessage("Cancelling execution..."))
+		return nil
+	}
+
+	submission, found := e.GetSubmission(id)
+	if !found {
+		return store.ErrNotFound
+	}
+	submission.Status = "cancelled"
+	submission.CompletedAt = time.Now()
+	e.saveSubmission(submission)
+	e.recordMetrics(submission)
+	e.sendToTerminals(id, models.NewSystemMessage("Execution cancelled"))
+	e.sendToTerminals(id, models.NewFinalStatusMessage(submission))
+	return nil
+}
@@ -0,0 +1,168 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// Exit codes of checker programs, following the testlib convention
+const (
+	checkerAccepted          = 0
+	checkerWrongAnswer       = 1
+	checkerPresentationError = 2
+)
+
+// maxCheckerMessage caps the checker comment stored on a result
+const maxCheckerMessage = 4096
+
+// programChecker judges output by running a custom checker program ("special
+// judge"). The checker is built once, in its own sandbox directory, and is
+// invoked for each test case as
+//
+//	<run command> input.txt output.txt answer.txt
+//
+// with the test input, the contestant's output and the expected output. It
+// exits 0 for accepted and 1 or 2 for a wrong answer; any other outcome is a
+// judge error. A wrong answer may earn partial credit if the first line of
+// the checker's stdout is a number between 0 and 1. The rest of its output is
+// returned as a comment.
+type programChecker struct {
+	*auxProgram
+}
+
+// newProgramChecker builds a checker program through the normal language pipeline
+func (e *CodeExecutor) newProgramChecker(ctx context.Context, submissionID string, program *models.Program) (*programChecker, error) {
+	aux, err := e.buildAuxProgram(ctx, "checker", submissionID, program)
+	if err != nil {
+		return nil, err
+	}
+	return &programChecker{aux}, nil
+}
+
+// auxProgram is a judging helper, such as a checker or interactor, built in a
+// sandbox directory of its own so the solution cannot see it or its files
+type auxProgram struct {
+	executor *CodeExecutor
+	spec     Spec
+	dir      string
+	timeout  time.Duration
+}
+
+// buildAuxProgram builds a helper program through the normal language pipeline
+func (e *CodeExecutor) buildAuxProgram(ctx context.Context, kind, submissionID string, program *models.Program) (*auxProgram, error) {
+	langConfig, exists := e.Language(program.Language)
+	if !exists {
+		return nil, fmt.Errorf("Unsupported %s language: %s", kind, program.Language)
+	}
+
+	dir, err := os.MkdirTemp("", fmt.Sprintf("%s%s-code-%s-", tempDirPrefix, kind, submissionID))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to create %s environment: %v", kind, err)
+	}
+
+	spec, _, err := e.buildProgram(ctx, program.Code, langConfig, dir)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, fmt.Errorf("Failed to build %s: %v", kind, err)
+	}
+	spec.ReadOnly = true
+
+	return &auxProgram{
+		executor: e,
+		spec:     spec,
+		dir:      dir,
+		timeout:  time.Duration(langConfig.TimeoutSec) * time.Second,
+	}, nil
+}
+
+// close removes the helper's sandbox directory
+func (a *auxProgram) close() {
+	os.RemoveAll(a.dir)
+}
+
+// auxFile is a file handed to a helper program
+type auxFile struct {
+	name    string
+	content string
+}
+
+// command writes files into the helper's directory and returns a spec that
+// runs the helper with their sandbox paths as arguments
+func (a *auxProgram) command(files ...auxFile) (Spec, error) {
+	spec := a.spec
+	spec.Cmd = append([]string(nil), a.spec.Cmd...)
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(a.dir, file.name), []byte(file.content), 0644); err != nil {
+			return Spec{}, err
+		}
+		spec.Cmd = append(spec.Cmd, path.Join(SandboxDir, file.name))
+	}
+	return spec, nil
+}
+
+func (c *programChecker) check(ctx context.Context, testCase models.TestCase, output string) checkResult {
+	spec, err := c.command(
+		auxFile{"input.txt", testCase.Input},
+		auxFile{"output.txt", output},
+		auxFile{"answer.txt", testCase.ExpectedOutput},
+	)
+	if err != nil {
+		return checkResult{verdict: models.VerdictJudgeError, message: "Failed to write checker input: " + err.Error()}
+	}
+
+	run := c.executor.runProgram(ctx, spec, "", c.timeout)
+	message := strings.TrimSpace(run.stdout + "\n" + run.stderr)
+
+	switch {
+	case run.err != nil:
+		return checkResult{verdict: models.VerdictJudgeError, message: "Checker failed to run: " + run.err.Error()}
+	case run.timedOut:
+		return checkResult{verdict: models.VerdictJudgeError, message: "Checker timed out after " + c.timeout.String()}
+	}
+
+	switch run.status.ExitCode {
+	case checkerAccepted:
+		return checkResult{verdict: models.VerdictAccepted, fraction: 1, message: truncate(message)}
+	case checkerWrongAnswer, checkerPresentationError:
+		fraction, comment := partialScore(run.stdout)
+		if comment == "" {
+			comment = strings.TrimSpace(run.stderr)
+		}
+		return checkResult{verdict: models.VerdictWrongAnswer, fraction: fraction, message: truncate(comment)}
+	default:
+		return checkResult{
+			verdict: models.VerdictJudgeError,
+			message: truncate(strings.TrimSpace(fmt.Sprintf("Checker exited with code %d\n%s", run.status.ExitCode, message))),
+		}
+	}
+}
+
+// partialScore reads an optional score between 0 and 1 from the first line of
+// a checker's stdout and returns it along with the remaining comment
+func partialScore(stdout string) (float64, string) {
+	stdout = strings.TrimSpace(stdout)
+	firstLine, rest, _ := strings.Cut(stdout, "\n")
+
+	fraction, err := strconv.ParseFloat(strings.TrimSpace(firstLine), 64)
+	// Written this way round so that NaN is rejected too
+	if err != nil || !(fraction >= 0 && fraction <= 1) {
+		return 0, stdout
+	}
+	return fraction, strings.TrimSpace(rest)
+}
+
+// truncate shortens a checker comment to maxCheckerMessage bytes
+func truncate(message string) string {
+	if len(message) > maxCheckerMessage {
+		return message[:maxCheckerMessage] + "..."
+	}
+	return message
+}
@@ -0,0 +1,232 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// runFunc is the signature of FakeRuntime.RunFunc
+type runFunc = func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error
+
+// sandboxFile reads a file a spec refers to by its sandbox path
+func sandboxFile(spec Spec, sandboxPath string) string {
+	data, err := os.ReadFile(filepath.Join(spec.Dir, path.Base(sandboxPath)))
+	if err != nil {
+		return "<" + err.Error() + ">"
+	}
+	return string(data)
+}
+
+// runByCode is a RunFunc that plays the program whose source, the first
+// argument of the run command, is a key of programs
+func runByCode(programs map[string]runFunc) runFunc {
+	return func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+		code := sandboxFile(spec, spec.Cmd[1])
+		program, exists := programs[code]
+		if !exists {
+			return fmt.Errorf("no program for source %q", code)
+		}
+		return program(ctx, spec, stdin, stdout, stderr)
+	}
+}
+
+// checkerArgs returns the contents of the input, output and answer files a
+// checker is given
+func checkerArgs(spec Spec) (input, output, answer string) {
+	args := spec.Cmd[len(spec.Cmd)-3:]
+	return sandboxFile(spec, args[0]), sandboxFile(spec, args[1]), sandboxFile(spec, args[2])
+}
+
+func TestProgramChecker(t *testing.T) {
+	// checker returns a checker program that prints stdout and stderr and
+	// exits with code
+	checker := func(stdout, stderr string, code int) runFunc {
+		return func(ctx context.Context, spec Spec, stdin io.Reader, out, errOut io.Writer) error {
+			io.WriteString(out, stdout)
+			io.WriteString(errOut, stderr)
+			return &FakeExit{Status: exitStatus(code)}
+		}
+	}
+
+	tests := []struct {
+		name        string
+		checker     runFunc
+		solution    runFunc
+		wantVerdict models.Verdict
+		wantScore   float64
+		wantOutput  string
+	}{
+		{
+			name:        "accepted",
+			checker:     checker("ok\n", "", checkerAccepted),
+			wantVerdict: models.VerdictAccepted,
+			wantScore:   4,
+			wantOutput:  "ok",
+		},
+		{
+			name:        "wrong answer",
+			checker:     checker("", "expected 2, found 3\n", checkerWrongAnswer),
+			wantVerdict: models.VerdictWrongAnswer,
+			wantOutput:  "expected 2, found 3",
+		},
+		{
+			name:        "presentation error",
+			checker:     checker("extra spaces\n", "", checkerPresentationError),
+			wantVerdict: models.VerdictWrongAnswer,
+			wantOutput:  "extra spaces",
+		},
+		{
+			name:        "partial credit",
+			checker:     checker("0.25\none of four parts\n", "", checkerWrongAnswer),
+			wantVerdict: models.VerdictWrongAnswer,
+			wantScore:   1,
+			wantOutput:  "one of four parts",
+		},
+		{
+			name:        "score out of range",
+			checker:     checker("1.5\ntoo generous\n", "", checkerWrongAnswer),
+			wantVerdict: models.VerdictWrongAnswer,
+			wantOutput:  "1.5\ntoo generous",
+		},
+		{
+			name:        "accepted ignores the score",
+			checker:     checker("0.5\n", "", checkerAccepted),
+			wantVerdict: models.VerdictAccepted,
+			wantScore:   4,
+			wantOutput:  "0.5",
+		},
+		{
+			name:        "unknown exit code",
+			checker:     checker("", "assertion failed\n", 3),
+			wantVerdict: models.VerdictJudgeError,
+			wantOutput:  "Checker exited with code 3\nassertion failed",
+		},
+		{
+			name: "checker over its time limit",
+			checker: func(ctx context.Context, spec Spec, stdin io.Reader, out, errOut io.Writer) error {
+				return &FakeExit{Status: ExitStatus{Usage: Usage{WallTime: 2 * time.Second}}}
+			},
+			wantVerdict: models.VerdictJudgeError,
+			wantOutput:  "Checker timed out after 1s",
+		},
+		{
+			name:    "solution crash skips the checker",
+			checker: checker("ok\n", "", checkerAccepted),
+			solution: func(ctx context.Context, spec Spec, stdin io.Reader, out, errOut io.Writer) error {
+				return &FakeExit{Status: exitStatus(1)}
+			},
+			wantVerdict: models.VerdictRuntimeError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			solution := tt.solution
+			if solution == nil {
+				solution = echoLine
+			}
+			var gotInput, gotOutput, gotAnswer string
+			rt := NewFakeRuntime()
+			rt.RunFunc = runByCode(map[string]runFunc{
+				"solution": solution,
+				"checker": func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+					gotInput, gotOutput, gotAnswer = checkerArgs(spec)
+					return tt.checker(ctx, spec, stdin, stdout, stderr)
+				},
+			})
+			e := newTestExecutor(t, rt, nil)
+
+			id := submit(t, e, &models.CodeSubmission{
+				Language:  "script",
+				Code:      "solution",
+				Checker:   &models.Program{Language: "script", Code: "checker"},
+				TestCases: []models.TestCase{{Input: "3\n", ExpectedOutput: "2\n", Points: 4}},
+			})
+			submission := waitFinished(t, e, id)
+			if len(submission.TestResults) != 1 {
+				t.Fatalf("status %q with %d results, want 1: %s", submission.Status, len(submission.TestResults), submission.Output)
+			}
+			result := submission.TestResults[0]
+
+			if result.Verdict != tt.wantVerdict || submission.Verdict != tt.wantVerdict {
+				t.Errorf("verdict = %q (submission %q), want %q", result.Verdict, submission.Verdict, tt.wantVerdict)
+			}
+			if result.Score != tt.wantScore || submission.Score != tt.wantScore || submission.MaxScore != 4 {
+				t.Errorf("score = %v (submission %v/%v), want %v/4", result.Score, submission.Score, submission.MaxScore, tt.wantScore)
+			}
+			if result.CheckerOutput != tt.wantOutput {
+				t.Errorf("checker output = %q, want %q", result.CheckerOutput, tt.wantOutput)
+			}
+			if tt.wantVerdict != models.VerdictRuntimeError && (gotInput != "3\n" || gotOutput != "3\n" || gotAnswer != "2\n") {
+				t.Errorf("checker got input %q, output %q, answer %q", gotInput, gotOutput, gotAnswer)
+			}
+		})
+	}
+}
+
+func TestProgramCheckerBuildFailure(t *testing.T) {
+	rt := NewFakeRuntime()
+	rt.RunFunc = echoLine
+	e := newTestExecutor(t, rt, nil)
+
+	id := submit(t, e, &models.CodeSubmission{
+		Language:  "script",
+		Code:      "solution",
+		Checker:   &models.Program{Language: "cobol", Code: "checker"},
+		TestCases: []models.TestCase{{Input: "1\n", ExpectedOutput: "1\n"}},
+	})
+	submission := waitFinished(t, e, id)
+	if submission.Status != "failed" || !strings.Contains(submission.Output, "Unsupported checker language: cobol") {
+		t.Errorf("status %q, output %q; want failed for the checker language", submission.Status, submission.Output)
+	}
+	if len(rt.Specs()) != 0 {
+		t.Errorf("%d programs ran, want none", len(rt.Specs()))
+	}
+}
+
+func TestPartialScore(t *testing.T) {
+	tests := []struct {
+		stdout      string
+		wantScore   float64
+		wantComment string
+	}{
+		{"", 0, ""},
+		{"0.5\nhalf of it", 0.5, "half of it"},
+		{"  0.75 \n\n  three quarters \n", 0.75, "three quarters"},
+		{"1", 1, ""},
+		{"0\nnothing", 0, "nothing"},
+		{"1e-1\n", 0.1, ""},
+		{"1.01\nabove", 0, "1.01\nabove"},
+		{"-0.5\nbelow", 0, "-0.5\nbelow"},
+		{"NaN\nnot a number", 0, "NaN\nnot a number"},
+		{"Inf", 0, "Inf"},
+		{"wrong answer on line 3", 0, "wrong answer on line 3"},
+		{"0.5 points", 0, "0.5 points"},
+	}
+
+	for _, tt := range tests {
+		score, comment := partialScore(tt.stdout)
+		if score != tt.wantScore || comment != tt.wantComment {
+			t.Errorf("partialScore(%q) = %v, %q; want %v, %q", tt.stdout, score, comment, tt.wantScore, tt.wantComment)
+		}
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if got := truncate("short"); got != "short" {
+		t.Errorf("truncate(short) = %q", got)
+	}
+	long := strings.Repeat("x", maxCheckerMessage+1)
+	if got := truncate(long); len(got) != maxCheckerMessage+3 || !strings.HasSuffix(got, "...") {
+		t.Errorf("truncate of %d bytes has %d bytes", len(long), len(got))
+	}
+}
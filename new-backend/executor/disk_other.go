@@ -0,0 +1,10 @@
+//go:build !unix
+
+package executor
+
+import "errors"
+
+// freeDiskSpace is not implemented on this platform
+func freeDiskSpace(dir string) (int64, error) {
+	return 0, errors.ErrUnsupported
+}
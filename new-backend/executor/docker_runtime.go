@@ -0,0 +1,297 @@
+package executor
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
+	"github.com/ishikabhoyar/monaco/new-backend/metrics"
+)
+
+// DockerRuntime runs sandboxed processes through the docker CLI
+type DockerRuntime struct {
+	// MeasureUsage wraps every run in a shell that reports the container's
+	// peak memory and CPU time, see usageScript
+	MeasureUsage bool
+}
+
+// NewDockerRuntime creates a runtime backed by the local Docker daemon
+func NewDockerRuntime() *DockerRuntime {
+	return &DockerRuntime{}
+}
+
+// Compile runs spec in a throwaway container and returns its combined output
+func (d *DockerRuntime) Compile(ctx context.Context, spec Spec) ([]byte, error) {
+	name := containerName()
+	cmd := exec.CommandContext(ctx, "docker", dockerRunArgs(spec, name, "--rm")...)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		killContainer(name)
+	}
+	// A failing compiler is the submission's fault; failing to run docker is not
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) && ctx.Err() == nil {
+		operation := "compile"
+		if spec.Probe {
+			operation = "version_probe"
+		}
+		metrics.DockerFailures.WithLabelValues(operation).Inc()
+	}
+	return output, err
+}
+
+// Run starts spec in a new container with its standard streams attached
+func (d *DockerRuntime) Run(ctx context.Context, spec Spec) (Process, error) {
+	name := containerName()
+	// The container is kept after exit so its state can be inspected
+	flags := []string{"-i"}
+
+	if d.MeasureUsage {
+		spec.Cmd = measureCmd(spec.Cmd)
+	}
+
+	cmd := exec.Command("docker", dockerRunArgs(spec, name, flags...)...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdin pipe: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stdout pipe: %w", err)
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create stderr pipe: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		metrics.DockerFailures.WithLabelValues("run").Inc()
+		return nil, fmt.Errorf("failed to start process: %w", err)
+	}
+
+	p := &dockerProcess{
+		name:     name,
+		cmd:      cmd,
+		stdin:    stdin,
+		stdout:   stdout,
+		stderr:   stderr,
+		measured: d.MeasureUsage,
+		done:     make(chan struct{}),
+	}
+
+	// Tear the container down if the caller gives up on it
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Kill()
+		case <-p.done:
+		}
+	}()
+
+	return p, nil
+}
+
+// Ping asks the Docker daemon for its version
+func (d *DockerRuntime) Ping(ctx context.Context) (string, error) {
+	out, err := exec.CommandContext(ctx, "docker", "version", "--format", "{{.Server.Version}}").CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("docker version: %w: %s", err, bytes.TrimSpace(out))
+	}
+	return string(bytes.TrimSpace(out)), nil
+}
+
+// ImageExists looks image up in the local image store
+func (d *DockerRuntime) ImageExists(ctx context.Context, image string) (bool, error) {
+	out, err := exec.CommandContext(ctx, "docker", "image", "inspect", "--format", "{{.Id}}", image).CombinedOutput()
+	if err == nil {
+		return true, nil
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && ctx.Err() == nil && bytes.Contains(bytes.ToLower(out), []byte("no such image")) {
+		return false, nil
+	}
+	return false, fmt.Errorf("docker image inspect %s: %w: %s", image, err, bytes.TrimSpace(out))
+}
+
+// dockerProcess is a running `docker run` invocation
+type dockerProcess struct {
+	name     string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	stdout   io.Reader
+	stderr   io.Reader
+	measured bool // The command is wrapped by measureCmd
+	done     chan struct{}
+	waitOnce sync.Once
+	status   ExitStatus
+	waitErr  error
+}
+
+func (p *dockerProcess) Stdin() io.WriteCloser { return p.stdin }
+func (p *dockerProcess) Stdout() io.Reader     { return p.stdout }
+func (p *dockerProcess) Stderr() io.Reader     { return p.stderr }
+
+// Wait blocks until the container exits, then reads its final state and removes it
+func (p *dockerProcess) Wait() (ExitStatus, error) {
+	p.waitOnce.Do(func() {
+		defer close(p.done)
+		defer removeContainer(p.name)
+
+		err := p.cmd.Wait()
+		var exitErr *exec.ExitError
+		if err != nil && !errors.As(err, &exitErr) {
+			metrics.DockerFailures.WithLabelValues("wait").Inc()
+			p.waitErr = err
+			return
+		}
+
+		// The container's own state is authoritative; the client's exit code
+		// is only a fallback for containers that never started
+		if p.status, err = inspectContainer(p.name); err != nil {
+			metrics.DockerFailures.WithLabelValues("inspect").Inc()
+			p.status = exitStatus(p.cmd.ProcessState.ExitCode())
+		}
+		if p.measured {
+			usage := copyUsage(p.name)
+			p.status.Usage.PeakMemory = usage.PeakMemory
+			p.status.Usage.CPUTime = usage.CPUTime
+		}
+	})
+	return p.status, p.waitErr
+}
+
+// Kill stops the container and the docker client attached to it
+func (p *dockerProcess) Kill() error {
+	select {
+	case <-p.done:
+		return nil
+	default:
+	}
+
+	killContainer(p.name)
+	return p.cmd.Process.Kill()
+}
+
+// dockerRunArgs builds the `docker run` argument list for spec
+func dockerRunArgs(spec Spec, name string, flags ...string) []string {
+	args := append([]string{"run", "--name", name}, flags...)
+
+	limits := spec.Limits
+	if limits.NetworkDisabled {
+		args = append(args, "--network=none")
+	}
+	if limits.Memory != "" {
+		args = append(args, "--memory="+limits.Memory)
+	}
+	if limits.MemorySwap != "" {
+		args = append(args, "--memory-swap="+limits.MemorySwap)
+	}
+	if limits.CPUs > 0 {
+		args = append(args, fmt.Sprintf("--cpu-quota=%d", int(100000*limits.CPUs)))
+	}
+	if limits.PidsLimit > 0 {
+		args = append(args, fmt.Sprintf("--pids-limit=%d", limits.PidsLimit))
+	}
+
+	if spec.Dir != "" {
+		mount := spec.Dir + ":" + SandboxDir
+		if spec.ReadOnly {
+			mount += ":ro"
+		}
+		args = append(args, "-v", mount)
+	}
+	if spec.WorkDir != "" {
+		args = append(args, "-w", spec.WorkDir)
+	}
+	for _, env := range spec.Env {
+		args = append(args, "-e", env)
+	}
+
+	args = append(args, spec.Image)
+	return append(args, spec.Cmd...)
+}
+
+// containerName returns a unique name so the container can be killed later
+func containerName() string {
+	return "monaco-" + uuid.New().String()
+}
+
+// killContainer force-stops a container, ignoring containers that already exited
+func killContainer(name string) {
+	if out, err := exec.Command("docker", "kill", name).CombinedOutput(); err != nil {
+		if containerGone(out) {
+			slog.Debug("container already exited", "container", name)
+			return
+		}
+		metrics.DockerFailures.WithLabelValues("kill").Inc()
+		slog.Warn("docker kill failed", "container", name, logging.Err(err), "output", string(bytes.TrimSpace(out)))
+	}
+}
+
+// containerGone reports whether docker failed because the container had
+// already exited or been removed, which races with killing it are expected to hit
+func containerGone(out []byte) bool {
+	return bytes.Contains(out, []byte("is not running")) || bytes.Contains(out, []byte("No such container"))
+}
+
+// inspectContainer reads the exit state of a stopped container, including how
+// long its process ran
+func inspectContainer(name string) (ExitStatus, error) {
+	out, err := exec.Command("docker", "inspect", "--format", "{{json .State}}", name).Output()
+	if err != nil {
+		return ExitStatus{}, fmt.Errorf("docker inspect %s: %w", name, err)
+	}
+
+	var state struct {
+		ExitCode   int
+		OOMKilled  bool
+		StartedAt  time.Time
+		FinishedAt time.Time
+	}
+	if err := json.Unmarshal(out, &state); err != nil {
+		return ExitStatus{}, fmt.Errorf("docker inspect %s: %w", name, err)
+	}
+
+	status := exitStatus(state.ExitCode)
+	status.OOMKilled = state.OOMKilled
+	if !state.StartedAt.IsZero() && state.FinishedAt.After(state.StartedAt) {
+		status.Usage.WallTime = state.FinishedAt.Sub(state.StartedAt)
+	}
+	return status, nil
+}
+
+// copyUsage reads the report usageScript left in a stopped container. A
+// container without one reports no usage. Only the start of the archive is
+// read, whatever the program left at usageFile.
+func copyUsage(name string) Usage {
+	cmd := exec.Command("docker", "cp", name+":"+usageFile, "-")
+	archive, err := cmd.StdoutPipe()
+	if err != nil {
+		return Usage{}
+	}
+	if err := cmd.Start(); err != nil {
+		metrics.DockerFailures.WithLabelValues("copy").Inc()
+		return Usage{}
+	}
+	defer cmd.Wait()
+	defer cmd.Process.Kill()
+	return usageFromArchive(archive)
+}
+
+// removeContainer deletes a container kept around for inspection
+func removeContainer(name string) {
+	if out, err := exec.Command("docker", "rm", "-f", name).CombinedOutput(); err != nil {
+		metrics.DockerFailures.WithLabelValues("remove").Inc()
+		slog.Warn("docker rm failed", "container", name, logging.Err(err), "output", string(bytes.TrimSpace(out)))
+	}
+}
@@ -0,0 +1,186 @@
+package executor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/metrics"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// statsWindow is how many recent runs per language the estimates are based on
+const statsWindow = 20
+
+// defaultRunEstimate is assumed for languages that have not run yet
+const defaultRunEstimate = 10 * time.Second
+
+// positionBroadcastInterval is the shortest time between two broadcasts of
+// queue positions
+const positionBroadcastInterval = 500 * time.Millisecond
+
+// runStats remembers how long recent submissions kept a worker busy, per language
+type runStats struct {
+	mutex  sync.Mutex
+	recent map[string][]time.Duration
+}
+
+func newRunStats() *runStats {
+	return &runStats{recent: make(map[string][]time.Duration)}
+}
+
+// add records that a submission in language kept a worker busy for d
+func (s *runStats) add(language string, d time.Duration) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	recent := append(s.recent[language], d)
+	if len(recent) > statsWindow {
+		recent = recent[len(recent)-statsWindow:]
+	}
+	s.recent[language] = recent
+}
+
+// estimate returns how long a submission in language is expected to keep a
+// worker busy: the mean of its recent runs, or of all recent runs if the
+// language has none
+func (s *runStats) estimate(language string) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if recent := s.recent[language]; len(recent) > 0 {
+		return mean(recent)
+	}
+
+	var all []time.Duration
+	for _, recent := range s.recent {
+		all = append(all, recent...)
+	}
+	if len(all) > 0 {
+		return mean(all)
+	}
+	return defaultRunEstimate
+}
+
+func mean(durations []time.Duration) time.Duration {
+	var total time.Duration
+	for _, d := range durations {
+		total += d
+	}
+	return total / time.Duration(len(durations))
+}
+
+// busyWorker is what a worker is doing, if anything
+type busyWorker struct {
+	language string
+	since    time.Time
+}
+
+// setWorkerBusy records that worker id picked up a submission in language
+func (e *CodeExecutor) setWorkerBusy(id int, language string) {
+	e.workersMutex.Lock()
+	e.busyWorkers[id] = busyWorker{language: language, since: time.Now()}
+	e.workersMutex.Unlock()
+	metrics.WorkersBusy.Inc()
+}
+
+// setWorkerIdle records that worker id is free again and how long it was busy
+func (e *CodeExecutor) setWorkerIdle(id int) {
+	e.workersMutex.Lock()
+	busy, exists := e.busyWorkers[id]
+	delete(e.busyWorkers, id)
+	e.workersMutex.Unlock()
+
+	if exists {
+		e.stats.add(busy.language, time.Since(busy.since))
+		metrics.WorkersBusy.Dec()
+	}
+}
+
+// QueueEstimate is where a queued submission stands
+type QueueEstimate struct {
+	Position       int       // 1-based position in the queue
+	EstimatedStart time.Time // When a worker is expected to pick it up
+}
+
+// queueEstimates predicts when each queued submission will start, seen at
+// now, by playing the queue forward over the workers, assuming every run
+// takes as long as recent runs in its language
+func (e *CodeExecutor) queueEstimates(now time.Time) map[string]QueueEstimate {
+	queued := e.queue.snapshot()
+	if len(queued) == 0 {
+		return nil
+	}
+
+	// When each worker is expected to be free
+	free := make([]time.Time, e.config.Executor.ConcurrentExecutions)
+	for i := range free {
+		free[i] = now
+	}
+	e.workersMutex.Lock()
+	for id, busy := range e.busyWorkers {
+		if id < len(free) {
+			if done := busy.since.Add(e.stats.estimate(busy.language)); done.After(now) {
+				free[id] = done
+			}
+		}
+	}
+	e.workersMutex.Unlock()
+
+	estimates := make(map[string]QueueEstimate, len(queued))
+	for i, submission := range queued {
+		next := 0
+		for w := range free {
+			if free[w].Before(free[next]) {
+				next = w
+			}
+		}
+		estimates[submission.ID] = QueueEstimate{Position: i + 1, EstimatedStart: free[next]}
+		free[next] = free[next].Add(e.stats.estimate(e.languageLabel(submission.Language)))
+	}
+	return estimates
+}
+
+// QueuePosition returns the position and expected start of a queued
+// submission, or false if it is not waiting in the queue
+func (e *CodeExecutor) QueuePosition(id string) (QueueEstimate, bool) {
+	estimate, exists := e.queueEstimates(time.Now())[id]
+	return estimate, exists
+}
+
+// broadcastQueuePositions asks for the terminals of queued submissions to be
+// told where they now stand. It does not wait; calls made in quick
+// succession are coalesced by positionBroadcaster.
+func (e *CodeExecutor) broadcastQueuePositions() {
+	select {
+	case e.positionsChanged <- struct{}{}:
+	default:
+		// A broadcast is already pending and will see this change
+	}
+}
+
+// positionBroadcaster sends queue positions to terminals whenever the queue
+// has changed, at most once per positionBroadcastInterval however often it
+// changes. A terminal is only sent a position that differs from the last one
+// its submission was sent; new terminals are told theirs when they connect.
+func (e *CodeExecutor) positionBroadcaster() {
+	sent := make(map[string]int)
+	for range e.positionsChanged {
+		var estimates map[string]QueueEstimate
+		if e.watched() {
+			estimates = e.queueEstimates(time.Now())
+		}
+		for id, estimate := range estimates {
+			if sent[id] == estimate.Position || !e.hasTerminals(id) {
+				continue
+			}
+			e.sendToTerminals(id, models.NewQueuedStatusMessage(estimate.Position, estimate.EstimatedStart))
+			sent[id] = estimate.Position
+		}
+		for id := range sent {
+			if _, queued := estimates[id]; !queued {
+				delete(sent, id)
+			}
+		}
+		time.Sleep(positionBroadcastInterval)
+	}
+}
@@ -0,0 +1,186 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+func TestQueueEstimates(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// waiting is a queued submission
+	type waiting struct {
+		id       string
+		user     string
+		priority models.Priority
+		language string
+	}
+	// estimate is a wanted position and start, relative to now
+	type estimate struct {
+		position int
+		start    time.Duration
+	}
+	// running is what a busy worker runs, and since how long
+	type running struct {
+		language string
+		since    time.Duration
+	}
+	recent := map[string][]time.Duration{
+		"script":   {time.Second, 3 * time.Second}, // 2s on average
+		"compiled": {5 * time.Second},
+	}
+
+	tests := []struct {
+		name    string
+		workers int
+		busy    map[int]running // By worker ID
+		stats   map[string][]time.Duration
+		queue   []waiting
+		want    map[string]estimate
+	}{
+		{
+			name:    "empty queue",
+			workers: 1,
+			stats:   recent,
+		},
+		{
+			name:    "one worker",
+			workers: 1,
+			stats:   recent,
+			queue: []waiting{
+				{"a", "alice", models.PriorityNormal, "script"},
+				{"b", "alice", models.PriorityNormal, "compiled"},
+				{"c", "alice", models.PriorityNormal, "script"},
+			},
+			want: map[string]estimate{"a": {1, 0}, "b": {2, 2 * time.Second}, "c": {3, 7 * time.Second}},
+		},
+		{
+			name:    "priority classes",
+			workers: 1,
+			stats:   recent,
+			queue: []waiting{
+				{"low", "alice", models.PriorityLow, "script"},
+				{"normal", "alice", models.PriorityNormal, "script"},
+				{"default", "alice", "", "script"},
+				{"high", "alice", models.PriorityHigh, "compiled"},
+			},
+			want: map[string]estimate{
+				"high":    {1, 0},
+				"normal":  {2, 5 * time.Second},
+				"default": {3, 7 * time.Second},
+				"low":     {4, 9 * time.Second},
+			},
+		},
+		{
+			name:    "users take turns",
+			workers: 1,
+			stats:   recent,
+			queue: []waiting{
+				{"a1", "alice", models.PriorityNormal, "script"},
+				{"a2", "alice", models.PriorityNormal, "script"},
+				{"a3", "alice", models.PriorityNormal, "script"},
+				{"b1", "bob", models.PriorityNormal, "script"},
+				{"c1", "carol", models.PriorityNormal, "script"},
+			},
+			want: map[string]estimate{
+				"a1": {1, 0},
+				"b1": {2, 2 * time.Second},
+				"c1": {3, 4 * time.Second},
+				"a2": {4, 6 * time.Second},
+				"a3": {5, 8 * time.Second},
+			},
+		},
+		{
+			name:    "busy workers",
+			workers: 2,
+			busy:    map[int]running{0: {"compiled", time.Second}},
+			stats:   recent,
+			queue: []waiting{
+				{"a", "alice", models.PriorityNormal, "script"},
+				{"b", "bob", models.PriorityNormal, "script"},
+				{"c", "carol", models.PriorityNormal, "script"},
+			},
+			// Worker 0 is free in 4s, worker 1 takes a and b
+			want: map[string]estimate{"a": {1, 0}, "b": {2, 2 * time.Second}, "c": {3, 4 * time.Second}},
+		},
+		{
+			name:    "overdue worker",
+			workers: 1,
+			busy:    map[int]running{0: {"script", time.Minute}},
+			stats:   recent,
+			queue:   []waiting{{"a", "alice", models.PriorityNormal, "script"}},
+			want:    map[string]estimate{"a": {1, 0}},
+		},
+		{
+			name:    "language without runs uses all runs",
+			workers: 1,
+			stats:   map[string][]time.Duration{"script": {2 * time.Second}, "compiled": {4 * time.Second}},
+			queue: []waiting{
+				{"a", "alice", models.PriorityNormal, "unknown"},
+				{"b", "alice", models.PriorityNormal, "script"},
+			},
+			want: map[string]estimate{"a": {1, 0}, "b": {2, 3 * time.Second}},
+		},
+		{
+			name:    "no runs yet",
+			workers: 1,
+			queue: []waiting{
+				{"a", "alice", models.PriorityNormal, "Script"}, // Language names are case-insensitive
+				{"b", "alice", models.PriorityNormal, "script"},
+			},
+			want: map[string]estimate{"a": {1, 0}, "b": {2, defaultRunEstimate}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{Executor: config.ExecutorConfig{ConcurrentExecutions: tt.workers}}
+			e := &CodeExecutor{
+				config:      cfg,
+				languages:   testLanguages(),
+				queue:       newJobQueue(10),
+				stats:       newRunStats(),
+				busyWorkers: make(map[int]busyWorker),
+			}
+			for language, durations := range tt.stats {
+				for _, d := range durations {
+					e.stats.add(language, d)
+				}
+			}
+			for id, busy := range tt.busy {
+				e.busyWorkers[id] = busyWorker{language: busy.language, since: now.Add(-busy.since)}
+			}
+			for _, w := range tt.queue {
+				e.queue.push(&models.CodeSubmission{ID: w.id, UserID: w.user, Priority: w.priority, Language: w.language})
+			}
+
+			got := e.queueEstimates(now)
+			if len(got) != len(tt.want) {
+				t.Fatalf("%d estimates, want %d: %v", len(got), len(tt.want), got)
+			}
+			for id, want := range tt.want {
+				estimate := got[id]
+				if estimate.Position != want.position || estimate.EstimatedStart.Sub(now) != want.start {
+					t.Errorf("%s: position %d in %s, want position %d in %s",
+						id, estimate.Position, estimate.EstimatedStart.Sub(now), want.position, want.start)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStatsWindow(t *testing.T) {
+	stats := newRunStats()
+	for i := 0; i < statsWindow; i++ {
+		stats.add("script", time.Hour)
+	}
+	for i := 0; i < statsWindow; i++ {
+		stats.add("script", time.Second)
+	}
+	if got := stats.estimate("script"); got != time.Second {
+		t.Errorf("estimate = %s, want %s from the last %d runs", got, time.Second, statsWindow)
+	}
+}
@@ -4,13 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"os"
-	"os/exec"
+	"path"
 	"path/filepath"
-	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,82 +20,200 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/websocket"
 	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
+	"github.com/ishikabhoyar/monaco/new-backend/metrics"
 	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/ishikabhoyar/monaco/new-backend/store"
+	"github.com/ishikabhoyar/monaco/new-backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// terminalCloseDelay is how long a worker waits after a submission finishes
+// before taking the next, so its terminals can show the final messages
+const terminalCloseDelay = 5 * time.Second
+
 // CodeExecutor handles code execution for all languages
 type CodeExecutor struct {
-	config              *config.Config
-	execQueue           chan *models.CodeSubmission
-	submissions         map[string]*models.CodeSubmission
-	submissionsMutex    sync.RWMutex
-	terminalConnections map[string][]*websocket.Conn
+	config              *config.Config // Startup configuration; languages are read from the languages field
+	runtime             Runtime
+	languages           map[string]config.LanguageConfig
+	languagesMutex      sync.RWMutex
+	configLoader        func() (*config.Config, error)
+	versions            *versionCache
+	queue               *jobQueue
+	stats               *runStats
+	busyWorkers         map[int]busyWorker
+	workersMutex        sync.Mutex
+	store               store.SubmissionStore
+	jobs                map[string]*job
+	jobsMutex           sync.Mutex
+	terminalConnections map[string][]*terminal
 	terminalMutex       sync.RWMutex
+	positionsChanged    chan struct{} // Wakes positionBroadcaster; holds at most one pending broadcast
+	closeDelay          time.Duration // terminalCloseDelay, shortened by tests
 	inputChannels       map[string]chan string
 	inputMutex          sync.RWMutex
 }
 
-// NewCodeExecutor creates a new code executor with specified capacity
-func NewCodeExecutor(cfg *config.Config) *CodeExecutor {
+// NewCodeExecutor creates a new code executor with specified capacity that
+// keeps submissions in st
+func NewCodeExecutor(cfg *config.Config, st store.SubmissionStore) *CodeExecutor {
+	rt := NewDockerRuntime()
+	rt.MeasureUsage = cfg.Sandbox.MeasureUsage
+	return NewCodeExecutorWithRuntime(cfg, rt, st)
+}
+
+// NewCodeExecutorWithRuntime creates a code executor that runs submissions on rt
+func NewCodeExecutorWithRuntime(cfg *config.Config, rt Runtime, st store.SubmissionStore) *CodeExecutor {
 	executor := &CodeExecutor{
 		config:              cfg,
-		execQueue:           make(chan *models.CodeSubmission, cfg.Executor.QueueCapacity),
-		submissions:         make(map[string]*models.CodeSubmission),
-		terminalConnections: make(map[string][]*websocket.Conn),
+		runtime:             rt,
+		languages:           copyLanguages(cfg.Languages),
+		versions:            newVersionCache(),
+		queue:               newJobQueue(cfg.Executor.QueueCapacity),
+		stats:               newRunStats(),
+		busyWorkers:         make(map[int]busyWorker),
+		store:               st,
+		jobs:                make(map[string]*job),
+		terminalConnections: make(map[string][]*terminal),
+		positionsChanged:    make(chan struct{}, 1),
+		closeDelay:          terminalCloseDelay,
 		inputChannels:       make(map[string]chan string),
 	}
 
+	executor.failInterrupted()
+	go executor.sweep()
+	go executor.positionBroadcaster()
+	go executor.refreshVersions()
+
 	// Start worker goroutines
+	metrics.Workers.Set(float64(cfg.Executor.ConcurrentExecutions))
 	for i := 0; i < cfg.Executor.ConcurrentExecutions; i++ {
 		go executor.worker(i)
 	}
 
-	log.Printf("Started %d code execution workers", cfg.Executor.ConcurrentExecutions)
+	slog.Info("started code execution workers", "workers", cfg.Executor.ConcurrentExecutions)
 	return executor
 }
 
-// SubmitCode adds a code submission to the execution queue
-func (e *CodeExecutor) SubmitCode(submission *models.CodeSubmission) string {
-	// Generate ID if not provided
-	if submission.ID == "" {
-		submission.ID = uuid.New().String()
-	}
+// SubmitCode adds a code submission to the execution queue without waiting
+// for room in it and returns the ID it assigned. Any ID the submission
+// already has is replaced, so callers cannot overwrite another submission.
+// It returns ErrQueueFull if the queue is at capacity and ErrTooManyActive if
+// the submitter has too many submissions in progress; in both cases the
+// submission is not stored. The spans of its execution continue the trace in ctx.
+func (e *CodeExecutor) SubmitCode(ctx context.Context, submission *models.CodeSubmission) (string, error) {
+	submission.ID = uuid.New().String()
 
 	submission.Status = "queued"
 	submission.QueuedAt = time.Now()
 
+	// Track the submission first; this enforces the per-user limit
+	if err := e.addJob(ctx, submission); err != nil {
+		logging.ForSubmission(slog.Default(), submission).Warn("too many active submissions, rejected submission")
+		metrics.SubmissionsRejected.WithLabelValues("too_many_active").Inc()
+		return "", err
+	}
+	logger := e.submissionLogger(submission.ID)
+
 	// Store submission
-	e.submissionsMutex.Lock()
-	e.submissions[submission.ID] = submission
-	e.submissionsMutex.Unlock()
+	e.saveSubmission(submission)
 
 	// Send to execution queue
-	e.execQueue <- submission
+	if !e.queue.push(submission) {
+		e.finishJob(submission.ID)
+		if err := e.store.Delete(submission.ID); err != nil {
+			logger.Error("failed to delete rejected submission", logging.Err(err))
+		}
+		logger.Warn("queue full, rejected submission")
+		metrics.SubmissionsRejected.WithLabelValues("queue_full").Inc()
+		return "", ErrQueueFull
+	}
+	e.broadcastQueuePositions()
+
+	logger.Info("submission queued", "priority", submission.Priority, logging.Content("code", submission.Code))
+	return submission.ID, nil
+}
+
+// QueueDepth returns the number of submissions waiting for a worker
+func (e *CodeExecutor) QueueDepth() int {
+	return e.queue.len()
+}
 
-	log.Printf("Submission queued: %s, language: %s", submission.ID, submission.Language)
-	return submission.ID
+// QueueCapacity returns how many submissions can wait for a worker
+func (e *CodeExecutor) QueueCapacity() int {
+	return e.queue.capacity
 }
 
 // GetSubmission returns a submission by ID
 func (e *CodeExecutor) GetSubmission(id string) (*models.CodeSubmission, bool) {
-	e.submissionsMutex.RLock()
-	defer e.submissionsMutex.RUnlock()
-	submission, exists := e.submissions[id]
-	return submission, exists
+	submission, err := e.store.Get(id)
+	if err != nil {
+		if !errors.Is(err, store.ErrNotFound) {
+			slog.Error("failed to load submission", "submission", id, logging.Err(err))
+		}
+		return nil, false
+	}
+	return submission, true
+}
+
+// saveSubmission writes the current state of a submission to the store,
+// logging failures
+func (e *CodeExecutor) saveSubmission(submission *models.CodeSubmission) error {
+	err := e.store.Save(submission)
+	if err != nil {
+		logging.ForSubmission(slog.Default(), submission).Error("failed to save submission", logging.Err(err))
+	}
+	return err
 }
 
-// RegisterTerminalConnection registers a WebSocket connection for streaming output
-func (e *CodeExecutor) RegisterTerminalConnection(submissionID string, conn *websocket.Conn) {
+// failInterrupted marks submissions that were still queued or running when the
+// server last stopped as failed, since nothing will ever pick them up again
+func (e *CodeExecutor) failInterrupted() {
+	var interrupted []*models.CodeSubmission
+	err := e.store.ForEach(func(submission *models.CodeSubmission) error {
+		if submission.Status == "queued" || submission.Status == "running" {
+			interrupted = append(interrupted, submission)
+		}
+		return nil
+	})
+	if err != nil {
+		slog.Error("failed to scan submission store", logging.Err(err))
+	}
+
+	for _, submission := range interrupted {
+		submission.Status = "failed"
+		submission.Output = "Execution was interrupted by a server restart"
+		submission.CompletedAt = time.Now()
+		e.saveSubmission(submission)
+	}
+	if len(interrupted) > 0 {
+		slog.Warn("marked interrupted submissions as failed", "count", len(interrupted))
+	}
+}
+
+// RegisterTerminalConnection registers a WebSocket connection for streaming
+// output. Input and cancel messages from a readOnly connection are ignored.
+func (e *CodeExecutor) RegisterTerminalConnection(submissionID string, conn *websocket.Conn, readOnly bool) {
+	t := &terminal{conn: conn}
 	e.terminalMutex.Lock()
-	defer e.terminalMutex.Unlock()
+	e.terminalConnections[submissionID] = append(e.terminalConnections[submissionID], t)
+	total := len(e.terminalConnections[submissionID])
+	e.terminalMutex.Unlock()
+	metrics.WebSocketConnections.Inc()
 
-	e.terminalConnections[submissionID] = append(e.terminalConnections[submissionID], conn)
-	
-	log.Printf("WebSocket connection registered for submission %s (total: %d)",
-		submissionID, len(e.terminalConnections[submissionID]))
+	e.submissionLogger(submissionID).Info("WebSocket connection registered", "connections", total, "readOnly", readOnly)
+
+	// Tell a new terminal where its submission stands if it is still waiting
+	if estimate, queued := e.QueuePosition(submissionID); queued {
+		if err := t.send(models.NewQueuedStatusMessage(estimate.Position, estimate.EstimatedStart)); err != nil {
+			e.submissionLogger(submissionID).Warn("WebSocket write failed", logging.Err(err))
+		}
+	}
 
 	// Set up a reader to handle input from WebSocket
-	go e.handleTerminalInput(submissionID, conn)
+	go e.handleTerminalInput(submissionID, conn, readOnly)
 }
 
 // UnregisterTerminalConnection removes a WebSocket connection
@@ -101,32 +221,42 @@ func (e *CodeExecutor) UnregisterTerminalConnection(submissionID string, conn *w
 	e.terminalMutex.Lock()
 	defer e.terminalMutex.Unlock()
 
-	connections := e.terminalConnections[submissionID]
-	for i, c := range connections {
-		if c == conn {
-			// Remove the connection
-			e.terminalConnections[submissionID] = append(connections[:i], connections[i+1:]...)
-			break
+	// Build a new slice, as sendToTerminals may still be iterating the old one
+	var remaining []*terminal
+	for _, t := range e.terminalConnections[submissionID] {
+		if t.conn == conn {
+			metrics.WebSocketConnections.Dec()
+			continue
 		}
+		remaining = append(remaining, t)
 	}
 
 	// Clean up if no more connections
-	if len(e.terminalConnections[submissionID]) == 0 {
+	if len(remaining) == 0 {
 		delete(e.terminalConnections, submissionID)
+	} else {
+		e.terminalConnections[submissionID] = remaining
 	}
 
-	log.Printf("WebSocket connection unregistered for submission %s", submissionID)
+	slog.Info("WebSocket connection unregistered", "submission", submissionID)
 }
 
 // handleTerminalInput reads input from the WebSocket and forwards it to the running process
-func (e *CodeExecutor) handleTerminalInput(submissionID string, conn *websocket.Conn) {
+func (e *CodeExecutor) handleTerminalInput(submissionID string, conn *websocket.Conn, readOnly bool) {
 	for {
 		_, message, err := conn.ReadMessage()
+		logger := e.submissionLogger(submissionID)
 		if err != nil {
-			log.Printf("Error reading WebSocket message: %v", err)
+			logger.Debug("WebSocket read ended", logging.Err(err))
 			break
 		}
 
+		// Viewers may watch but not type into or cancel someone else's program
+		if readOnly {
+			logger.Warn("ignoring message from read-only terminal")
+			continue
+		}
+
 		// Try to parse the message as JSON first
 		var inputMessage struct {
 			Type    string `json:"type"`
@@ -134,9 +264,18 @@ func (e *CodeExecutor) handleTerminalInput(submissionID string, conn *websocket.
 		}
 
 		inputText := string(message)
-		if err := json.Unmarshal(message, &inputMessage); err == nil && inputMessage.Type == "input" {
-			// It's a structured input message
-			inputText = inputMessage.Content
+		if err := json.Unmarshal(message, &inputMessage); err == nil {
+			switch inputMessage.Type {
+			case "input":
+				// It's a structured input message
+				inputText = inputMessage.Content
+			case "cancel":
+				if err := e.Cancel(submissionID); err != nil {
+					logger.Warn("failed to cancel submission", logging.Err(err))
+					e.sendToTerminals(submissionID, models.NewErrorMessage("cancel_failed", err.Error()))
+				}
+				continue
+			}
 		}
 
 		// Now get the input channel
@@ -147,12 +286,12 @@ func (e *CodeExecutor) handleTerminalInput(submissionID string, conn *websocket.
 		if exists {
 			select {
 			case inputChan <- inputText:
-				log.Printf("Input sent to process: %s", inputText)
+				logger.Debug("input forwarded to process", logging.Content("input", inputText))
 			default:
-				log.Printf("Failed to send input: channel full or closed")
+				logger.Warn("failed to forward input: channel full or closed")
 			}
 		} else {
-			log.Printf("No input channel for submission %s", submissionID)
+			logger.Warn("input received while no process is running")
 		}
 	}
 
@@ -160,6 +299,20 @@ func (e *CodeExecutor) handleTerminalInput(submissionID string, conn *websocket.
 	e.UnregisterTerminalConnection(submissionID, conn)
 }
 
+// hasTerminals reports whether any WebSocket connection watches a submission
+func (e *CodeExecutor) hasTerminals(submissionID string) bool {
+	e.terminalMutex.RLock()
+	defer e.terminalMutex.RUnlock()
+	return len(e.terminalConnections[submissionID]) > 0
+}
+
+// watched reports whether any WebSocket connection is open
+func (e *CodeExecutor) watched() bool {
+	e.terminalMutex.RLock()
+	defer e.terminalMutex.RUnlock()
+	return len(e.terminalConnections) > 0
+}
+
 // sendToTerminals sends output to all registered WebSocket connections
 func (e *CodeExecutor) sendToTerminals(submissionID string, message models.WebSocketMessage) {
 	e.terminalMutex.RLock()
@@ -170,10 +323,10 @@ func (e *CodeExecutor) sendToTerminals(submissionID string, message models.WebSo
 		return
 	}
 
-	for _, conn := range connections {
-		err := conn.WriteJSON(message)
+	for _, t := range connections {
+		err := t.send(message)
 		if err != nil {
-			log.Printf("WebSocket write error: %v", err)
+			slog.Warn("WebSocket write failed", "submission", submissionID, logging.Err(err))
 			// Consider unregistering the connection on error
 		}
 	}
@@ -181,40 +334,73 @@ func (e *CodeExecutor) sendToTerminals(submissionID string, message models.WebSo
 
 // worker processes code execution jobs from the queue
 func (e *CodeExecutor) worker(id int) {
-	log.Printf("Worker %d started", id)
+	workerLogger := slog.With("worker", id)
+	workerLogger.Debug("worker started")
+
+	for {
+		submission := e.queue.pop()
+		e.broadcastQueuePositions()
+
+		job := e.startJob(submission.ID, id)
+		if job == nil {
+			// Cancelled while it was queued
+			continue
+		}
+		logger := job.logger
+		logger.Info("processing submission")
+		e.setWorkerBusy(id, e.languageLabel(submission.Language))
 
-	for submission := range e.execQueue {
-		log.Printf("Worker %d processing submission %s (%s)", id, submission.ID, submission.Language)
-		
 		// Update status to running
 		submission.Status = "running"
 		submission.StartedAt = time.Now()
+		e.saveSubmission(submission)
 		e.sendToTerminals(submission.ID, models.NewStatusMessage("running", "", ""))
 
 		// Execute the code according to language
-		e.executeCode(submission)
+		ctx, span := tracing.Start(job.ctx, "execute", tracing.Submission(submission),
+			trace.WithAttributes(attribute.Int("monaco.worker", id)))
+		e.executeCode(logging.NewContext(ctx, logger), submission)
+		// Only a Cancel that interrupted the run changes its result; one
+		// arriving after it ended, before finishJob, is too late
+		interrupted := job.ctx.Err() != nil
+		e.finishJob(submission.ID)
+		if interrupted {
+			submission.Status = "cancelled"
+			e.sendToTerminals(submission.ID, models.NewSystemMessage("Execution cancelled"))
+		}
 
 		// Update completion time
 		submission.CompletedAt = time.Now()
 		executionTime := submission.CompletedAt.Sub(submission.StartedAt).Seconds()
-		submission.ExecutionTime = executionTime
+		_, saveSpan := tracing.Start(ctx, "save result")
+		if err := e.saveSubmission(submission); err != nil {
+			tracing.Fail(saveSpan, err)
+		}
+		saveSpan.End()
+		span.SetAttributes(attribute.String("monaco.submission.status", submission.Status))
+		span.End()
+		e.recordMetrics(submission)
 
 		// Send completion status
-		e.sendToTerminals(submission.ID, models.NewStatusMessage(submission.Status, "", ""))
-		
+		e.sendToTerminals(submission.ID, models.NewFinalStatusMessage(submission))
+
 		// Send a notification that terminal will close soon
-		e.sendToTerminals(submission.ID, models.NewSystemMessage("Connection will close in 5 seconds"))
-		
+		e.sendToTerminals(submission.ID, models.NewSystemMessage(
+			fmt.Sprintf("Connection will close in %d seconds", int(e.closeDelay/time.Second))))
+
 		// Add delay to keep the connection open longer
-		time.Sleep(5 * time.Second)
-		
-		log.Printf("Worker %d completed submission %s in %.2f seconds", id, submission.ID, executionTime)
+		time.Sleep(e.closeDelay)
+
+		logger.Info("completed submission", "status", submission.Status, "seconds", executionTime)
+		e.setWorkerIdle(id)
 	}
 }
 
-// executeCode orchestrates the execution of code for different languages
-func (e *CodeExecutor) executeCode(submission *models.CodeSubmission) {
-	langConfig, exists := e.config.Languages[strings.ToLower(submission.Language)]
+// executeCode runs a submission through the pipeline described by its
+// LanguageConfig. Everything it starts is killed when ctx is cancelled.
+func (e *CodeExecutor) executeCode(ctx context.Context, submission *models.CodeSubmission) {
+	// Take a copy so a concurrent reload cannot change this submission's language
+	langConfig, exists := e.Language(submission.Language)
 	if !exists {
 		submission.Status = "failed"
 		submission.Output = "Unsupported language: " + submission.Language
@@ -222,324 +408,238 @@ func (e *CodeExecutor) executeCode(submission *models.CodeSubmission) {
 	}
 
 	// Create a temporary directory for this submission
-	tempDir, err := os.MkdirTemp("", fmt.Sprintf("%s-code-%s-", submission.Language, submission.ID))
+	_, span := tracing.Start(ctx, "create workspace")
+	tempDir, err := os.MkdirTemp("", fmt.Sprintf("%s%s-code-%s-", tempDirPrefix, strings.ToLower(submission.Language), submission.ID))
 	if err != nil {
+		tracing.Fail(span, err)
+		span.End()
 		submission.Status = "failed"
 		submission.Output = "Failed to create execution environment: " + err.Error()
 		return
 	}
-	defer os.RemoveAll(tempDir)
-
-	// Choose execution strategy based on language
-	switch strings.ToLower(submission.Language) {
-	case "python":
-		e.executePython(submission, tempDir, langConfig)
-	case "java":
-		e.executeJava(submission, tempDir, langConfig)
-	case "c":
-		e.executeC(submission, tempDir, langConfig)
-	case "cpp":
-		e.executeCpp(submission, tempDir, langConfig)
-	case "javascript":
-		e.executeJavaScript(submission, tempDir, langConfig)
-	case "golang":
-		e.executeGolang(submission, tempDir, langConfig)
-	default:
-		submission.Status = "failed"
-		submission.Output = "Unsupported language: " + submission.Language
-	}
-}
+	span.End()
+	defer func() {
+		_, span := tracing.Start(ctx, "remove workspace")
+		os.RemoveAll(tempDir)
+		span.End()
+	}()
 
-// executePython executes Python code
-func (e *CodeExecutor) executePython(submission *models.CodeSubmission, tempDir string, langConfig config.LanguageConfig) {
-    // Write code to file
-    codeFile := filepath.Join(tempDir, "code"+langConfig.FileExt)
-    if err := os.WriteFile(codeFile, []byte(submission.Code), 0644); err != nil {
-        submission.Status = "failed"
-        submission.Output = "Failed to write code file: " + err.Error()
-        return
-    }
-
-    // Setup Docker run command with unbuffered Python output
-    cmd := exec.Command(
-        "docker", "run", "--rm", "-i",
-        "--network=none",
-        "--memory="+langConfig.MemoryLimit,
-        "--cpu-quota="+fmt.Sprintf("%d", int(float64(100000)*0.1)), // 10% CPU
-        "--pids-limit=20",
-        "-v", tempDir+":/code",
-        "-e", "PYTHONUNBUFFERED=1", // Force Python to be unbuffered
-        langConfig.Image,
-        "python", "-u", "/code/code.py", // Add -u flag for unbuffered I/O
-    )
-
-    // Execute with increased timeout for interactive programs
-    e.executeWithIO(cmd, submission, time.Duration(langConfig.TimeoutSec)*time.Second)
-}
+	spec, compileTime, err := e.buildProgram(ctx, submission.Code, langConfig, tempDir)
+	submission.CompileTime = compileTime.Seconds()
+	if compileTime > 0 {
+		metrics.CompileDuration.WithLabelValues(e.languageLabel(submission.Language)).Observe(compileTime.Seconds())
+	}
+	var compileErr *CompileError
+	if errors.As(err, &compileErr) {
+		e.sendToTerminals(submission.ID, models.NewOutputMessage(compileErr.Output, true))
+	}
 
-// executeJava executes Java code
-func (e *CodeExecutor) executeJava(submission *models.CodeSubmission, tempDir string, langConfig config.LanguageConfig) {
-	// Extract class name from code
-	className := extractJavaClassName(submission.Code)
-	
-	// Write code to file
-	codeFile := filepath.Join(tempDir, className+langConfig.FileExt)
-	if err := os.WriteFile(codeFile, []byte(submission.Code), 0644); err != nil {
-		submission.Status = "failed"
-		submission.Output = "Failed to write code file: " + err.Error()
+	// Judge against test cases, or run interactively
+	if len(submission.TestCases) > 0 {
+		e.judge(ctx, submission, spec, err, langConfig)
 		return
 	}
 
-	// Compile Java code
-	compileCmd := exec.Command(
-		"docker", "run", "--rm",
-		"-v", tempDir+":/code",
-		langConfig.Image,
-		"javac", "/code/"+className+".java",
-	)
-	
-	compileOutput, compileErr := compileCmd.CombinedOutput()
-	if compileErr != nil {
+	if err != nil {
 		submission.Status = "failed"
-		submission.Output = "Compilation error:\n" + string(compileOutput)
-		e.sendToTerminals(submission.ID, models.NewOutputMessage(string(compileOutput), true))
+		submission.Output = err.Error()
 		return
 	}
-	
-	// Setup Docker run command for execution
-	cmd := exec.Command(
-		"docker", "run", "--rm", "-i",
-		"--network=none",
-		"--memory="+langConfig.MemoryLimit,
-		"--cpu-quota="+fmt.Sprintf("%d", int(float64(100000)*0.5)), // 50% CPU
-		"--pids-limit=20",
-		"-v", tempDir+":/code",
-		langConfig.Image,
-		"java", "-XX:+TieredCompilation", "-XX:TieredStopAtLevel=1",
-		"-Xms64m", "-Xmx256m",
-		"-cp", "/code", className,
-	)
-
-	// Execute the code with input handling
-	e.executeWithIO(cmd, submission, time.Duration(langConfig.TimeoutSec)*time.Second)
+	e.executeWithIO(ctx, spec, submission, time.Duration(langConfig.TimeoutSec)*time.Second)
 }
 
-// executeC executes C code
-func (e *CodeExecutor) executeC(submission *models.CodeSubmission, tempDir string, langConfig config.LanguageConfig) {
-    // Write code to file
-    codeFile := filepath.Join(tempDir, "code"+langConfig.FileExt)
-    if err := os.WriteFile(codeFile, []byte(submission.Code), 0644); err != nil {
-        submission.Status = "failed"
-        submission.Output = "Failed to write code file: " + err.Error()
-        return
-    }
-
-    // Create a wrapper script that will include setbuf to disable buffering
-    wrapperCode := `#include <stdio.h>
-
-// Forward declaration of user's main function
-int user_main();
-
-int main() {
-    // Disable buffering completely for stdout
-    setbuf(stdout, NULL);
-    
-    // Call the user's code
-    return user_main();
+// CompileError is returned by buildProgram when the compile step fails
+type CompileError struct {
+	Output string
 }
 
-// User's code begins here
-`
-    
-    // Modify the user's code to be a function called from our wrapper
-    modifiedCode := submission.Code
-    // Replace main function with our wrapper
-    mainRegex := regexp.MustCompile(`int\s+main\s*\([^)]*\)\s*{`)
-    if mainRegex.MatchString(modifiedCode) {
-        // Rename user's main to user_main
-        modifiedCode = mainRegex.ReplaceAllString(modifiedCode, "int user_main() {")
-        
-        // Combine wrapper with modified user code
-        finalCode := wrapperCode + modifiedCode
-        
-        // Write the final code with wrapper to file
-        if err := os.WriteFile(codeFile, []byte(finalCode), 0644); err != nil {
-            submission.Status = "failed"
-            submission.Output = "Failed to write code file: " + err.Error()
-            return
-        }
-    } else {
-        // If no main function found, create a minimal program that includes the user code
-        finalCode := `#include <stdio.h>
-
-int main() {
-    // Disable buffering completely for stdout
-    setbuf(stdout, NULL);
-    
-    // Execute the user's code
-    ` + submission.Code + `
-    
-    return 0;
-}
-`
-        // Write the final code to file
-        if err := os.WriteFile(codeFile, []byte(finalCode), 0644); err != nil {
-            submission.Status = "failed"
-            submission.Output = "Failed to write code file: " + err.Error()
-            return
-        }
-    }
-
-    // Compile C code
-    compileCmd := exec.Command(
-        "docker", "run", "--rm",
-        "-v", tempDir+":/code",
-        langConfig.Image,
-        "gcc", "-o", "/code/program", "/code/code.c",
-    )
-    
-    compileOutput, compileErr := compileCmd.CombinedOutput()
-    if compileErr != nil {
-        submission.Status = "failed"
-        submission.Output = "Compilation error:\n" + string(compileOutput)
-        e.sendToTerminals(submission.ID, models.NewOutputMessage(string(compileOutput), true))
-        return
-    }
-    
-    // Setup Docker run command
-    cmd := exec.Command(
-        "docker", "run", "--rm", "-i",
-        "--network=none",
-        "--memory="+langConfig.MemoryLimit,
-        "--cpu-quota="+fmt.Sprintf("%d", int(float64(100000)*0.1)), // 10% CPU
-        "--pids-limit=20",
-        "-v", tempDir+":/code",
-        langConfig.Image,
-        "/code/program",
-    )
-
-    // Execute the code with input handling
-    e.executeWithIO(cmd, submission, time.Duration(langConfig.TimeoutSec)*time.Second)
+func (c *CompileError) Error() string {
+	return "Compilation error:\n" + c.Output
 }
 
-// executeCpp executes C++ code
-func (e *CodeExecutor) executeCpp(submission *models.CodeSubmission, tempDir string, langConfig config.LanguageConfig) {
-	// Write code to file
-	codeFile := filepath.Join(tempDir, "code"+langConfig.FileExt)
-	if err := os.WriteFile(codeFile, []byte(submission.Code), 0644); err != nil {
-		submission.Status = "failed"
-		submission.Output = "Failed to write code file: " + err.Error()
-		return
+// buildProgram writes code into dir, prepared and compiled as described by
+// langConfig, and returns the spec that runs the resulting program. The
+// artifact is built once and can be run any number of times. The returned
+// duration is the time spent in the compile step.
+func (e *CodeExecutor) buildProgram(parent context.Context, code string, langConfig config.LanguageConfig, dir string) (Spec, time.Duration, error) {
+	// Prepare the source and the placeholders used by the command templates
+	vars := map[string]string{"dir": SandboxDir}
+	if langConfig.SourceHook != "" {
+		hook, exists := sourceHooks[langConfig.SourceHook]
+		if !exists {
+			return Spec{}, 0, errors.New("Unknown source hook: " + langConfig.SourceHook)
+		}
+		code = hook.prepare(code, vars)
 	}
 
-	// Compile C++ code
-	compileCmd := exec.Command(
-		"docker", "run", "--rm",
-		"-v", tempDir+":/code",
-		langConfig.Image,
-		"g++", "-o", "/code/program", "/code/code.cpp",
-	)
-	
-	compileOutput, compileErr := compileCmd.CombinedOutput()
-	if compileErr != nil {
-		submission.Status = "failed"
-		submission.Output = "Compilation error:\n" + string(compileOutput)
-		e.sendToTerminals(submission.ID, models.NewOutputMessage(string(compileOutput), true))
-		return
+	fileName := expandTemplate(langConfig.SourceFile, vars)
+	if fileName == "" {
+		fileName = "code" + langConfig.FileExt
 	}
-	
-	// Setup Docker run command
-	cmd := exec.Command(
-		"docker", "run", "--rm", "-i",
-		"--network=none",
-		"--memory="+langConfig.MemoryLimit,
-		"--cpu-quota="+fmt.Sprintf("%d", int(float64(100000)*0.1)), // 10% CPU
-		"--pids-limit=20",
-		"-v", tempDir+":/code",
-		langConfig.Image,
-		"/code/program",
-	)
-
-	// Execute the code with input handling
-	e.executeWithIO(cmd, submission, time.Duration(langConfig.TimeoutSec)*time.Second)
-}
+	vars["file"] = fileName
+	vars["source"] = path.Join(SandboxDir, fileName)
 
-// executeJavaScript executes JavaScript code
-func (e *CodeExecutor) executeJavaScript(submission *models.CodeSubmission, tempDir string, langConfig config.LanguageConfig) {
 	// Write code to file
-	codeFile := filepath.Join(tempDir, "code"+langConfig.FileExt)
-	if err := os.WriteFile(codeFile, []byte(submission.Code), 0644); err != nil {
-		submission.Status = "failed"
-		submission.Output = "Failed to write code file: " + err.Error()
-		return
+	codeFile := filepath.Join(dir, fileName)
+	if err := os.WriteFile(codeFile, []byte(code), 0644); err != nil {
+		return Spec{}, 0, errors.New("Failed to write code file: " + err.Error())
+	}
+
+	spec := Spec{
+		Image:   langConfig.Image,
+		Dir:     dir,
+		WorkDir: expandTemplate(langConfig.WorkDir, vars),
+		Env:     expandTemplates(langConfig.Env, vars),
+	}
+
+	// Compile if the language needs it
+	var compileTime time.Duration
+	if len(langConfig.CompileCmd) > 0 {
+		compileTimeout := e.config.Executor.DefaultTimeout
+		if langConfig.CompileTimeoutSec > 0 {
+			compileTimeout = time.Duration(langConfig.CompileTimeoutSec) * time.Second
+		}
+		ctx, span := tracing.Start(parent, "compile", trace.WithAttributes(attribute.String("monaco.image", spec.Image)))
+		defer span.End()
+		ctx, cancel := context.WithTimeout(ctx, compileTimeout)
+		defer cancel()
+
+		compileSpec := spec
+		compileSpec.Cmd = expandTemplates(langConfig.CompileCmd, vars)
+		compileSpec.Limits = e.compileLimits(langConfig)
+		start := time.Now()
+		output, err := e.runtime.Compile(ctx, compileSpec)
+		compileTime = time.Since(start)
+		if ctx.Err() == context.DeadlineExceeded {
+			tracing.Fail(span, ctx.Err())
+			return Spec{}, compileTime, &CompileError{Output: string(output) + "\nCompilation timed out after " + compileTimeout.String()}
+		}
+		if err != nil {
+			tracing.Fail(span, err)
+			return Spec{}, compileTime, &CompileError{Output: string(output)}
+		}
 	}
 
-	// Setup Docker run command
-	cmd := exec.Command(
-		"docker", "run", "--rm", "-i",
-		"--network=none",
-		"--memory="+langConfig.MemoryLimit,
-		"--cpu-quota="+fmt.Sprintf("%d", int(float64(100000)*0.1)), // 10% CPU
-		"--pids-limit=20",
-		"-v", tempDir+":/code",
-		langConfig.Image,
-		"node", "/code/code.js",
-	)
-
-	// Execute the code with input handling
-	e.executeWithIO(cmd, submission, time.Duration(langConfig.TimeoutSec)*time.Second)
+	spec.Cmd = expandTemplates(langConfig.RunCmd, vars)
+	spec.Limits = e.runLimits(langConfig)
+	return spec, compileTime, nil
 }
 
-// executeGolang executes Go code
-func (e *CodeExecutor) executeGolang(submission *models.CodeSubmission, tempDir string, langConfig config.LanguageConfig) {
-	// Write code to file
-	codeFile := filepath.Join(tempDir, "code"+langConfig.FileExt)
-	if err := os.WriteFile(codeFile, []byte(submission.Code), 0644); err != nil {
-		submission.Status = "failed"
-		submission.Output = "Failed to write code file: " + err.Error()
-		return
+// expandTemplate replaces {name} placeholders in s with values from vars
+func expandTemplate(s string, vars map[string]string) string {
+	return placeholderReplacer(vars).Replace(s)
+}
+
+// expandTemplates applies expandTemplate to every element of list
+func expandTemplates(list []string, vars map[string]string) []string {
+	replacer := placeholderReplacer(vars)
+	expanded := make([]string, len(list))
+	for i, s := range list {
+		expanded[i] = replacer.Replace(s)
+	}
+	return expanded
+}
+
+// placeholderReplacer substitutes every placeholder of vars in a single pass,
+// in sorted order, so a value that itself contains a placeholder, such as a
+// directory named "{file}", is inserted verbatim
+func placeholderReplacer(vars map[string]string) *strings.Replacer {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 
-	// Setup Docker run command to compile and run in one step
-	cmd := exec.Command(
-		"docker", "run", "--rm", "-i",
-		"--network=none",
-		"--memory="+langConfig.MemoryLimit,
-		"--cpu-quota="+fmt.Sprintf("%d", int(float64(100000)*0.1)), // 10% CPU
-		"--pids-limit=20",
-		"-v", tempDir+":/code",
-		"-w", "/code",
-		langConfig.Image,
-		"go", "run", "/code/code.go",
-	)
-
-	// Execute the code with input handling
-	e.executeWithIO(cmd, submission, time.Duration(langConfig.TimeoutSec)*time.Second)
+	pairs := make([]string, 0, 2*len(names))
+	for _, name := range names {
+		pairs = append(pairs, "{"+name+"}", vars[name])
+	}
+	return strings.NewReplacer(pairs...)
 }
 
-// executeWithIO runs a command with input/output handling through WebSockets
-func (e *CodeExecutor) executeWithIO(cmd *exec.Cmd, submission *models.CodeSubmission, timeout time.Duration) {
-	// Create pipes for stdin, stdout and stderr
-	stdin, err := cmd.StdinPipe()
+// runLimits returns the sandbox limits for running a program in the given language
+func (e *CodeExecutor) runLimits(langConfig config.LanguageConfig) Limits {
+	cpus, err := strconv.ParseFloat(langConfig.CPULimit, 64)
 	if err != nil {
-		submission.Status = "failed"
-		submission.Output = "Failed to create stdin pipe: " + err.Error()
-		return
+		cpus = 0
 	}
 
-	stdout, err := cmd.StdoutPipe()
-	if err != nil {
-		submission.Status = "failed"
-		submission.Output = "Failed to create stdout pipe: " + err.Error()
-		return
+	return Limits{
+		Memory:          langConfig.MemoryLimit,
+		MemorySwap:      e.config.Sandbox.MemorySwapLimit,
+		CPUs:            cpus,
+		PidsLimit:       e.config.Sandbox.PidsLimit,
+		NetworkDisabled: e.config.Sandbox.NetworkDisabled,
 	}
+}
 
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		submission.Status = "failed"
-		submission.Output = "Failed to create stderr pipe: " + err.Error()
+// compileLimits returns the sandbox limits for compiling a program in the
+// given language. Compilers run user-controlled code too (build scripts,
+// generators, templates), so they are isolated like the program itself.
+func (e *CodeExecutor) compileLimits(langConfig config.LanguageConfig) Limits {
+	limits := e.runLimits(langConfig)
+	limits.Memory = e.config.Sandbox.CompileMemoryLimit
+	if cpus, err := strconv.ParseFloat(e.config.Sandbox.CompileCPULimit, 64); err == nil {
+		limits.CPUs = cpus
+	}
+	return limits
+}
+
+// waitResult carries the outcome of Process.Wait across a channel
+type waitResult struct {
+	status ExitStatus
+	err    error
+}
+
+// signalNames maps the Linux signals a program commonly dies of to their names
+var signalNames = map[int]string{
+	1:  "SIGHUP",
+	2:  "SIGINT",
+	3:  "SIGQUIT",
+	4:  "SIGILL",
+	5:  "SIGTRAP",
+	6:  "SIGABRT",
+	7:  "SIGBUS",
+	8:  "SIGFPE",
+	9:  "SIGKILL",
+	11: "SIGSEGV",
+	13: "SIGPIPE",
+	14: "SIGALRM",
+	15: "SIGTERM",
+	24: "SIGXCPU",
+	25: "SIGXFSZ",
+	31: "SIGSYS",
+}
+
+// exitInfo describes status for clients
+func exitInfo(status ExitStatus, timedOut bool) *models.ExitInfo {
+	exit := &models.ExitInfo{
+		ExitCode:  status.ExitCode,
+		OOMKilled: status.OOMKilled,
+		TimedOut:  timedOut,
+	}
+	if status.Signal != 0 {
+		exit.Signal = signalNames[status.Signal]
+		if exit.Signal == "" {
+			exit.Signal = fmt.Sprintf("SIG%d", status.Signal)
+		}
+	}
+	return exit
+}
+
+// reportExit records how the program of a submission ended and tells its terminals
+func (e *CodeExecutor) reportExit(submission *models.CodeSubmission, result waitResult, timedOut bool) {
+	if result.err != nil {
+		// The process state is unknown
 		return
 	}
+	submission.Exit = exitInfo(result.status, timedOut)
+	e.sendToTerminals(submission.ID, models.NewExitMessage(*submission.Exit))
+}
+
+// executeWithIO runs a sandboxed process with input/output handling through WebSockets
+func (e *CodeExecutor) executeWithIO(parent context.Context, spec Spec, submission *models.CodeSubmission, timeout time.Duration) {
+	logger := logging.FromContext(parent)
 
 	// Create an input channel for this submission
 	inputChan := make(chan string, 10)
@@ -555,65 +655,60 @@ func (e *CodeExecutor) executeWithIO(cmd *exec.Cmd, submission *models.CodeSubmi
 		close(inputChan)
 	}()
 
-	// Start the command
-	if err := cmd.Start(); err != nil {
+	ctx, span := tracing.Start(parent, "run", trace.WithAttributes(attribute.String("monaco.image", spec.Image)))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	// Start the process
+	start := time.Now()
+	process, err := e.runtime.Run(ctx, spec)
+	if err != nil {
+		tracing.Fail(span, err)
 		submission.Status = "failed"
 		submission.Output = "Failed to start process: " + err.Error()
 		return
 	}
+	stdin := process.Stdin()
 
 	// Output buffer to collect all output
 	var outputBuffer bytes.Buffer
+	var outputMutex sync.Mutex
+	var readers sync.WaitGroup
 
 	// Send initial input if provided
 	if submission.Input != "" {
 		io.WriteString(stdin, submission.Input+"\n")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
-	defer cancel()
-
-	// Handle stdout in a goroutine
-	go func() {
+	// streamOutput copies one output stream to the buffer and the terminals
+	streamOutput := func(stream io.Reader, isError bool) {
+		defer readers.Done()
 		buffer := make([]byte, 1024)
 		for {
-			n, err := stdout.Read(buffer)
+			n, err := stream.Read(buffer)
 			if n > 0 {
 				data := buffer[:n]
+				outputMutex.Lock()
 				outputBuffer.Write(data)
-				
+				outputMutex.Unlock()
+
 				// Send real-time output to terminals
-				e.sendToTerminals(submission.ID, models.NewOutputMessage(string(data), false))
+				e.sendToTerminals(submission.ID, models.NewOutputMessage(string(data), isError))
 			}
 			if err != nil {
 				if err != io.EOF {
-					log.Printf("Stdout read error: %v", err)
+					logger.Warn("output read failed", logging.Err(err))
 				}
 				break
 			}
 		}
-	}()
+	}
 
-	// Handle stderr in a goroutine
-	go func() {
-		buffer := make([]byte, 1024)
-		for {
-			n, err := stderr.Read(buffer)
-			if n > 0 {
-				data := buffer[:n]
-				outputBuffer.Write(data)
-				
-				// Send real-time error output to terminals
-				e.sendToTerminals(submission.ID, models.NewOutputMessage(string(data), true))
-			}
-			if err != nil {
-				if err != io.EOF {
-					log.Printf("Stderr read error: %v", err)
-				}
-				break
-			}
-		}
-	}()
+	// Handle stdout and stderr in goroutines
+	readers.Add(2)
+	go streamOutput(process.Stdout(), false)
+	go streamOutput(process.Stderr(), true)
 
 	// Listen for input from WebSocket
 	go func() {
@@ -623,11 +718,11 @@ func (e *CodeExecutor) executeWithIO(cmd *exec.Cmd, submission *models.CodeSubmi
 				if !ok {
 					return
 				}
-				log.Printf("Received input from WebSocket: %s", input)
+				logger.Debug("writing input to process", logging.Content("input", input))
 				// Write input with a single newline - don't add extra newlines
 				_, err := stdin.Write([]byte(input + "\n"))
 				if err != nil {
-					log.Printf("Error writing to stdin: %v", err)
+					logger.Warn("writing to stdin failed", logging.Err(err))
 					e.sendToTerminals(submission.ID, models.NewErrorMessage("input_error", "Failed to send input to process"))
 				}
 			case <-ctx.Done():
@@ -636,10 +731,19 @@ func (e *CodeExecutor) executeWithIO(cmd *exec.Cmd, submission *models.CodeSubmi
 		}
 	}()
 
-	// Wait for command to complete or timeout
-	done := make(chan error)
+	// Wait for the output to drain and the process to exit
+	done := make(chan waitResult, 1)
 	go func() {
-		done <- cmd.Wait()
+		readers.Wait()
+		status, err := process.Wait()
+		elapsed := time.Since(start)
+		submission.RunTime = elapsed.Seconds()
+		submission.ExecutionTime = wallTime(status.Usage, elapsed).Seconds()
+		submission.CPUTime = status.Usage.CPUTime.Seconds()
+		submission.PeakMemory = status.Usage.PeakMemory
+		describeUsage(submission)
+
+		done <- waitResult{status, err}
 	}()
 
 	// Wait for completion or timeout
@@ -647,20 +751,36 @@ func (e *CodeExecutor) executeWithIO(cmd *exec.Cmd, submission *models.CodeSubmi
 	case <-ctx.Done():
 		// Process timed out
 		if ctx.Err() == context.DeadlineExceeded {
-			log.Printf("Process timed out for submission %s", submission.ID)
-			submission.Status = "failed"
-			submission.Output = outputBuffer.String() + "\nExecution timed out after " + timeout.String()
+			logger.Info("process timed out", "timeout", timeout.String())
+			span.AddEvent("timed out")
 			e.sendToTerminals(submission.ID, models.NewErrorMessage("timeout", "Execution timed out after "+timeout.String()))
-			
+
 			// Attempt to kill the process
-			if err := cmd.Process.Kill(); err != nil {
-				log.Printf("Failed to kill process: %v", err)
+			if err := process.Kill(); err != nil {
+				logger.Error("failed to kill process", logging.Err(err))
 			}
+			e.reportExit(submission, <-done, true)
+
+			submission.Status = "failed"
+			submission.Output = outputBuffer.String() + "\nExecution timed out after " + timeout.String()
+			return
 		}
-	case err := <-done:
+
+		// Cancelled; the worker records the final status
+		if err := process.Kill(); err != nil {
+			logger.Error("failed to kill process", logging.Err(err))
+		}
+		e.reportExit(submission, <-done, false)
+	case result := <-done:
 		// Process completed
-		if err != nil {
-			log.Printf("Process error: %v", err)
+		e.reportExit(submission, result, false)
+		if result.err != nil {
+			logger.Error("process failed", logging.Err(result.err))
+			tracing.Fail(span, result.err)
+			submission.Status = "failed"
+		} else if result.status.ExitCode != 0 {
+			logger.Info("process exited with non-zero code",
+				"exitCode", result.status.ExitCode, "signal", result.status.Signal, "oomKilled", result.status.OOMKilled)
 			submission.Status = "failed"
 			// Don't overwrite output, as stderr has already been captured
 		} else {
@@ -671,25 +791,3 @@ func (e *CodeExecutor) executeWithIO(cmd *exec.Cmd, submission *models.CodeSubmi
 	// Store the complete output
 	submission.Output = outputBuffer.String()
 }
-
-// Helper function to extract Java class name
-func extractJavaClassName(code string) string {
-	// Default class name as fallback
-	defaultClass := "Solution"
-
-	// Look for public class
-	re := regexp.MustCompile(`public\s+class\s+(\w+)`)
-	matches := re.FindStringSubmatch(code)
-	if len(matches) > 1 {
-		return matches[1]
-	}
-
-	// Look for any class if no public class
-	re = regexp.MustCompile(`class\s+(\w+)`)
-	matches = re.FindStringSubmatch(code)
-	if len(matches) > 1 {
-		return matches[1]
-	}
-
-	return defaultClass
-}
\ No newline at end of file
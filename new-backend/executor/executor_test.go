@@ -0,0 +1,585 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/ishikabhoyar/monaco/new-backend/store"
+)
+
+// testLanguages are the languages of test executors: an interpreted one that
+// times out after a second and a compiled one
+func testLanguages() map[string]config.LanguageConfig {
+	return map[string]config.LanguageConfig{
+		"script": {
+			Name:        "Script",
+			Image:       "script:latest",
+			MemoryLimit: "64m",
+			CPULimit:    "0.5",
+			TimeoutSec:  1,
+			RunCmd:      []string{"run", "{source}"},
+			FileExt:     ".txt",
+		},
+		"compiled": {
+			Name:        "Compiled",
+			Image:       "compiled:latest",
+			MemoryLimit: "64m",
+			CPULimit:    "0.5",
+			TimeoutSec:  1,
+			CompileCmd:  []string{"cc", "-o", "{dir}/program", "{source}"},
+			RunCmd:      []string{"{dir}/program"},
+			FileExt:     ".c",
+		},
+	}
+}
+
+// newTestExecutor creates an executor with one worker that runs on rt.
+// configure, if not nil, may change the configuration first.
+func newTestExecutor(t *testing.T, rt *FakeRuntime, configure func(cfg *config.Config)) *CodeExecutor {
+	t.Helper()
+	t.Setenv("TMPDIR", t.TempDir())
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Executor.ConcurrentExecutions = 1
+	cfg.Languages = testLanguages()
+	if configure != nil {
+		configure(cfg)
+	}
+
+	e := NewCodeExecutorWithRuntime(cfg, rt, store.NewMemoryStore(0))
+	e.closeDelay = 0
+	return e
+}
+
+// submit queues a submission and fails the test if it is refused
+func submit(t *testing.T, e *CodeExecutor, submission *models.CodeSubmission) string {
+	t.Helper()
+	id, err := e.SubmitCode(context.Background(), submission)
+	if err != nil {
+		t.Fatalf("SubmitCode: %v", err)
+	}
+	return id
+}
+
+// waitFinished waits for a submission to reach a final status
+func waitFinished(t *testing.T, e *CodeExecutor, id string) *models.CodeSubmission {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		if submission, exists := e.GetSubmission(id); exists && isFinished(submission.Status) {
+			return submission
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("submission %s did not finish", id)
+	return nil
+}
+
+// echoLine is a RunFunc that prints the first line of its input
+func echoLine(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(stdout, line)
+	return err
+}
+
+// newEchoRuntime returns a fake runtime whose programs print their first input line
+func newEchoRuntime() *FakeRuntime {
+	rt := NewFakeRuntime()
+	rt.RunFunc = echoLine
+	return rt
+}
+
+// blockingRun returns a RunFunc that reports the first line of each run's
+// input on started and then waits for release to be closed before echoing it
+func blockingRun(started chan<- string, release <-chan struct{}) func(context.Context, Spec, io.Reader, io.Writer, io.Writer) error {
+	return func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+		line, _ := bufio.NewReader(stdin).ReadString('\n')
+		started <- strings.TrimSpace(line)
+		select {
+		case <-release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		_, err := io.WriteString(stdout, line)
+		return err
+	}
+}
+
+// terminalMessage is a WebSocket message as a client decodes it
+type terminalMessage struct {
+	Type    string          `json:"type"`
+	Content json.RawMessage `json:"content"`
+}
+
+// dialTerminal opens a terminal WebSocket on submission id
+func dialTerminal(t *testing.T, e *CodeExecutor, id string) *websocket.Conn {
+	t.Helper()
+	var upgrader websocket.Upgrader
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Errorf("upgrade: %v", err)
+			return
+		}
+		e.RegisterTerminalConnection(id, conn, false)
+	}))
+	t.Cleanup(server.Close)
+
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	return conn
+}
+
+// readUntilFinal reads terminal messages up to the final status message
+func readUntilFinal(t *testing.T, conn *websocket.Conn) []terminalMessage {
+	t.Helper()
+	var messages []terminalMessage
+	for {
+		var message terminalMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("read: %v (after %d messages)", err, len(messages))
+		}
+		messages = append(messages, message)
+		if message.Type == "status" {
+			var status models.StatusUpdateMessage
+			json.Unmarshal(message.Content, &status)
+			if isFinished(status.Status) {
+				return messages
+			}
+		}
+	}
+}
+
+func TestSubmitCodeRunsProgram(t *testing.T) {
+	e := newTestExecutor(t, newEchoRuntime(), nil)
+
+	id := submit(t, e, &models.CodeSubmission{Language: "script", Code: "echo", Input: "hello"})
+	submission := waitFinished(t, e, id)
+
+	if submission.Status != "completed" {
+		t.Fatalf("status = %q, want completed (output %q)", submission.Status, submission.Output)
+	}
+	if submission.Output != "hello\n" {
+		t.Errorf("output = %q, want %q", submission.Output, "hello\n")
+	}
+	if submission.Exit == nil || submission.Exit.ExitCode != 0 || submission.Exit.TimedOut {
+		t.Errorf("exit = %+v, want a clean exit", submission.Exit)
+	}
+}
+
+func TestSubmitCodeAssignsID(t *testing.T) {
+	e := newTestExecutor(t, newEchoRuntime(), nil)
+
+	first := submit(t, e, &models.CodeSubmission{Language: "script", Code: "echo"})
+	waitFinished(t, e, first)
+	second := submit(t, e, &models.CodeSubmission{ID: first, Language: "script", Code: "other"})
+
+	if second == first {
+		t.Fatalf("SubmitCode kept the caller's ID %q", first)
+	}
+	if submission, _ := e.GetSubmission(first); submission.Code != "echo" {
+		t.Errorf("first submission was overwritten with code %q", submission.Code)
+	}
+}
+
+func TestExitReporting(t *testing.T) {
+	tests := []struct {
+		name   string
+		exit   ExitStatus
+		status string
+		want   models.ExitInfo
+	}{
+		{"success", ExitStatus{}, "completed", models.ExitInfo{}},
+		{"exit code", ExitStatus{ExitCode: 3}, "failed", models.ExitInfo{ExitCode: 3}},
+		{"signal", exitStatus(139), "failed", models.ExitInfo{ExitCode: 139, Signal: "SIGSEGV"}},
+		{"unnamed signal", exitStatus(128 + 40), "failed", models.ExitInfo{ExitCode: 168, Signal: "SIG40"}},
+		{"out of memory", ExitStatus{ExitCode: 137, Signal: 9, OOMKilled: true}, "failed",
+			models.ExitInfo{ExitCode: 137, Signal: "SIGKILL", OOMKilled: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := NewFakeRuntime()
+			rt.RunFunc = func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				return &FakeExit{Status: tt.exit}
+			}
+			e := newTestExecutor(t, rt, nil)
+
+			submission := waitFinished(t, e, submit(t, e, &models.CodeSubmission{Language: "script", Code: "exit"}))
+			if submission.Status != tt.status {
+				t.Errorf("status = %q, want %q", submission.Status, tt.status)
+			}
+			if submission.Exit == nil || *submission.Exit != tt.want {
+				t.Errorf("exit = %+v, want %+v", submission.Exit, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeoutKillsProgram(t *testing.T) {
+	rt := NewFakeRuntime()
+	rt.RunFunc = func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+		io.WriteString(stdout, "partial\n")
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	e := newTestExecutor(t, rt, nil)
+
+	start := time.Now()
+	submission := waitFinished(t, e, submit(t, e, &models.CodeSubmission{Language: "script", Code: "loop"}))
+
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("finished after %s, before the 1s time limit", elapsed)
+	}
+	if submission.Status != "failed" {
+		t.Errorf("status = %q, want failed", submission.Status)
+	}
+	if !strings.HasPrefix(submission.Output, "partial\n") || !strings.Contains(submission.Output, "timed out") {
+		t.Errorf("output = %q, want the partial output and a timeout note", submission.Output)
+	}
+	if submission.Exit == nil || !submission.Exit.TimedOut || submission.Exit.Signal != "SIGKILL" {
+		t.Errorf("exit = %+v, want killed for timing out", submission.Exit)
+	}
+}
+
+func TestTerminalStreamsOutputAndInput(t *testing.T) {
+	started := make(chan struct{})
+	rt := NewFakeRuntime()
+	rt.RunFunc = func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+		close(started)
+		line, err := bufio.NewReader(stdin).ReadString('\n')
+		if err != nil {
+			return err
+		}
+		io.WriteString(stdout, "got "+line)
+		io.WriteString(stderr, "warning\n")
+		return &FakeExit{Status: ExitStatus{ExitCode: 2}}
+	}
+	e := newTestExecutor(t, rt, nil)
+
+	id := submit(t, e, &models.CodeSubmission{Language: "script", Code: "read"})
+	<-started
+	conn := dialTerminal(t, e, id)
+	if err := conn.WriteJSON(map[string]string{"type": "input", "content": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr string
+	var exit *models.ExitInfo
+	for _, message := range readUntilFinal(t, conn) {
+		switch message.Type {
+		case "output":
+			var output models.OutputMessage
+			json.Unmarshal(message.Content, &output)
+			if output.IsError {
+				stderr += output.Text
+			} else {
+				stdout += output.Text
+			}
+		case "exit":
+			exit = &models.ExitInfo{}
+			json.Unmarshal(message.Content, exit)
+		}
+	}
+
+	if stdout != "got abc\n" {
+		t.Errorf("streamed stdout = %q, want %q", stdout, "got abc\n")
+	}
+	if stderr != "warning\n" {
+		t.Errorf("streamed stderr = %q, want %q", stderr, "warning\n")
+	}
+	if exit == nil || exit.ExitCode != 2 {
+		t.Errorf("exit message = %+v, want exit code 2", exit)
+	}
+	if submission := waitFinished(t, e, id); submission.Output != "got abc\nwarning\n" {
+		t.Errorf("stored output = %q", submission.Output)
+	}
+}
+
+func TestTerminalWritesAreSerialized(t *testing.T) {
+	e := newTestExecutor(t, NewFakeRuntime(), nil)
+	conn := dialTerminal(t, e, "watched")
+	for deadline := time.Now().Add(5 * time.Second); !e.hasTerminals("watched"); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("terminal was not registered")
+		}
+	}
+
+	// A websocket.Conn panics on concurrent writes, so this only passes if
+	// sendToTerminals serializes them
+	const writers, messages = 8, 50
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < messages; i++ {
+				e.sendToTerminals("watched", models.NewOutputMessage("x", false))
+			}
+		}()
+	}
+
+	for i := 0; i < writers*messages; i++ {
+		var message terminalMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("read %d: %v", i, err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestQueueing(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	rt := NewFakeRuntime()
+	rt.RunFunc = blockingRun(started, release)
+	e := newTestExecutor(t, rt, func(cfg *config.Config) {
+		cfg.Executor.QueueCapacity = 2
+	})
+
+	first := submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "first"})
+	if got := <-started; got != "first" {
+		t.Fatalf("worker started %q, want first", got)
+	}
+
+	// The only worker is busy, so the next two wait in order
+	second := submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "second"})
+	third := submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "third"})
+	for want, id := range []string{second, third} {
+		estimate, queued := e.QueuePosition(id)
+		if !queued || estimate.Position != want+1 {
+			t.Errorf("position of submission %d = %d (queued %v), want %d", want+2, estimate.Position, queued, want+1)
+		}
+	}
+	if submission, _ := e.GetSubmission(second); submission.Status != "queued" {
+		t.Errorf("status while waiting = %q, want queued", submission.Status)
+	}
+
+	// The queue is full
+	_, err := e.SubmitCode(context.Background(), &models.CodeSubmission{Language: "script", Code: "x", Input: "fourth"})
+	if !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("SubmitCode on a full queue = %v, want ErrQueueFull", err)
+	}
+	if depth := e.QueueDepth(); depth != 2 {
+		t.Errorf("queue depth = %d, want 2", depth)
+	}
+
+	close(release)
+	for _, want := range []string{"second", "third"} {
+		if got := <-started; got != want {
+			t.Errorf("worker started %q, want %q", got, want)
+		}
+	}
+	for _, id := range []string{first, second, third} {
+		if submission := waitFinished(t, e, id); submission.Status != "completed" {
+			t.Errorf("status = %q, want completed", submission.Status)
+		}
+	}
+}
+
+func TestCancelQueuedSubmission(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	rt := NewFakeRuntime()
+	rt.RunFunc = blockingRun(started, release)
+	e := newTestExecutor(t, rt, nil)
+	defer close(release)
+
+	submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "running"})
+	<-started
+	queued := submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "queued"})
+	last := submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "last"})
+
+	// The last submission's terminal hears that it moved up
+	conn := dialTerminal(t, e, last)
+	if err := e.Cancel(queued); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	for {
+		var message terminalMessage
+		if err := conn.ReadJSON(&message); err != nil {
+			t.Fatalf("no position update: %v", err)
+		}
+		var status models.StatusUpdateMessage
+		json.Unmarshal(message.Content, &status)
+		if message.Type == "status" && status.QueuePosition == 1 {
+			break
+		}
+	}
+
+	if submission, _ := e.GetSubmission(queued); submission.Status != "cancelled" {
+		t.Errorf("status = %q, want cancelled", submission.Status)
+	}
+	if depth := e.QueueDepth(); depth != 1 {
+		t.Errorf("queue depth = %d, want 1", depth)
+	}
+	if err := e.Cancel(queued); !errors.Is(err, ErrAlreadyFinished) {
+		t.Errorf("second Cancel = %v, want ErrAlreadyFinished", err)
+	}
+	if err := e.Cancel("unknown"); !errors.Is(err, store.ErrNotFound) {
+		t.Errorf("Cancel of an unknown submission = %v, want store.ErrNotFound", err)
+	}
+}
+
+func TestCancelRunningSubmission(t *testing.T) {
+	started := make(chan string, 10)
+	release := make(chan struct{})
+	rt := NewFakeRuntime()
+	rt.RunFunc = blockingRun(started, release)
+	e := newTestExecutor(t, rt, nil)
+	defer close(release)
+
+	running := submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "running"})
+	<-started
+	if err := e.Cancel(running); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if submission := waitFinished(t, e, running); submission.Status != "cancelled" {
+		t.Errorf("status = %q, want cancelled", submission.Status)
+	}
+
+	// Cancelling a run that has ended leaves its result alone
+	finished := submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "finished"})
+	<-started
+	release <- struct{}{}
+	if submission := waitFinished(t, e, finished); submission.Status != "completed" {
+		t.Fatalf("status = %q, want completed", submission.Status)
+	}
+	if err := e.Cancel(finished); !errors.Is(err, ErrAlreadyFinished) {
+		t.Errorf("Cancel after the run = %v, want ErrAlreadyFinished", err)
+	}
+	if submission, _ := e.GetSubmission(finished); submission.Status != "completed" {
+		t.Errorf("status after Cancel = %q, want completed", submission.Status)
+	}
+}
+
+func TestConcurrentSubmissionsPerUser(t *testing.T) {
+	started := make(chan string, 100)
+	release := make(chan struct{})
+	rt := NewFakeRuntime()
+	rt.RunFunc = blockingRun(started, release)
+	e := newTestExecutor(t, rt, func(cfg *config.Config) {
+		cfg.RateLimit.MaxConcurrentPerUser = 1
+	})
+	defer close(release)
+
+	submit(t, e, &models.CodeSubmission{Language: "script", Code: "x", Input: "x", UserID: "alice"})
+	<-started
+	_, err := e.SubmitCode(context.Background(), &models.CodeSubmission{Language: "script", Code: "x", Input: "x", UserID: "alice"})
+	if !errors.Is(err, ErrTooManyActive) {
+		t.Errorf("second submission of a user = %v, want ErrTooManyActive", err)
+	}
+
+	// Racing submissions of one user must not get past the limit together
+	var accepted sync.WaitGroup
+	results := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		accepted.Add(1)
+		go func() {
+			defer accepted.Done()
+			_, err := e.SubmitCode(context.Background(), &models.CodeSubmission{Language: "script", Code: "x", Input: "x", UserID: "bob"})
+			results <- err
+		}()
+	}
+	accepted.Wait()
+	close(results)
+	succeeded := 0
+	for err := range results {
+		if err == nil {
+			succeeded++
+		} else if !errors.Is(err, ErrTooManyActive) {
+			t.Errorf("SubmitCode = %v", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d concurrent submissions accepted, want 1", succeeded)
+	}
+}
+
+func TestCompileStepIsSandboxed(t *testing.T) {
+	rt := newEchoRuntime()
+	e := newTestExecutor(t, rt, nil)
+
+	submission := waitFinished(t, e, submit(t, e, &models.CodeSubmission{Language: "compiled", Code: "int main;", Input: "in"}))
+	if submission.Status != "completed" {
+		t.Fatalf("status = %q, want completed (output %q)", submission.Status, submission.Output)
+	}
+
+	specs := rt.Specs()
+	if len(specs) != 2 {
+		t.Fatalf("runtime got %d specs, want a compile and a run", len(specs))
+	}
+	compile, run := specs[0], specs[1]
+	if want := []string{"cc", "-o", "/code/program", "/code/code.c"}; strings.Join(compile.Cmd, " ") != strings.Join(want, " ") {
+		t.Errorf("compile command = %q, want %q", compile.Cmd, want)
+	}
+	sandbox := e.config.Sandbox
+	if !compile.Limits.NetworkDisabled || compile.Limits.Memory != sandbox.CompileMemoryLimit ||
+		compile.Limits.CPUs != 1 || compile.Limits.PidsLimit != sandbox.PidsLimit {
+		t.Errorf("compile limits = %+v, want the sandbox's compile limits without network", compile.Limits)
+	}
+	if !run.Limits.NetworkDisabled || run.Limits.Memory != "64m" || run.Limits.CPUs != 0.5 {
+		t.Errorf("run limits = %+v, want the language's limits without network", run.Limits)
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	rt := NewFakeRuntime()
+	rt.CompileFunc = func(ctx context.Context, spec Spec) ([]byte, error) {
+		return []byte("code.c:1: error"), &FakeExit{Status: ExitStatus{ExitCode: 1}}
+	}
+	e := newTestExecutor(t, rt, nil)
+
+	submission := waitFinished(t, e, submit(t, e, &models.CodeSubmission{Language: "compiled", Code: "broken"}))
+	if submission.Status != "failed" || submission.Output != "Compilation error:\ncode.c:1: error" {
+		t.Errorf("status = %q, output = %q, want a failed compilation", submission.Status, submission.Output)
+	}
+	if n := len(rt.Specs()); n != 1 {
+		t.Errorf("runtime got %d specs, want only the compile step", n)
+	}
+}
+
+func TestExpandTemplate(t *testing.T) {
+	vars := map[string]string{"dir": "/code/{file}", "file": "main.c", "source": "/code/{file}/main.c"}
+
+	tests := []struct {
+		template string
+		want     string
+	}{
+		{"{dir}/program", "/code/{file}/program"},
+		{"{source}", "/code/{file}/main.c"},
+		{"-o {dir}/{file}.out", "-o /code/{file}/main.c.out"},
+		{"{unknown}", "{unknown}"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		// Map iteration order varies, so repeat to catch order dependence
+		for i := 0; i < 20; i++ {
+			if got := expandTemplate(tt.template, vars); got != tt.want {
+				t.Fatalf("expandTemplate(%q) = %q, want %q", tt.template, got, tt.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// FakeRuntime is an in-process Runtime that never touches Docker. It lets the
+// queueing, timeout and streaming logic of CodeExecutor run on machines without
+// a Docker daemon. Behaviour is scripted through CompileFunc and RunFunc.
+type FakeRuntime struct {
+	// CompileFunc handles compile steps; nil means every compile succeeds silently
+	CompileFunc func(ctx context.Context, spec Spec) ([]byte, error)
+	// RunFunc plays the role of the sandboxed program; nil echoes stdin to stdout.
+	// ctx is cancelled when the process is killed. Returning a *FakeExit sets
+	// the exit status; any other error exits with code 1. Unless the FakeExit
+	// says otherwise, the time RunFunc took is reported as the wall time.
+	RunFunc func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error
+	// PingErr, if set, is returned by Ping
+	PingErr error
+	// MissingImages lists images ImageExists reports as absent
+	MissingImages []string
+
+	mu    sync.Mutex
+	specs []Spec
+}
+
+// FakeExit is returned by a RunFunc to choose how the fake process exits
+type FakeExit struct {
+	Status ExitStatus
+}
+
+func (f *FakeExit) Error() string {
+	return fmt.Sprintf("exit status %d", f.Status.ExitCode)
+}
+
+// NewFakeRuntime creates a fake runtime that echoes stdin to stdout
+func NewFakeRuntime() *FakeRuntime {
+	return &FakeRuntime{}
+}
+
+// Specs returns every spec passed to Compile or Run, in call order
+func (f *FakeRuntime) Specs() []Spec {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Spec(nil), f.specs...)
+}
+
+func (f *FakeRuntime) record(spec Spec) {
+	f.mu.Lock()
+	f.specs = append(f.specs, spec)
+	f.mu.Unlock()
+}
+
+// Compile calls CompileFunc
+func (f *FakeRuntime) Compile(ctx context.Context, spec Spec) ([]byte, error) {
+	f.record(spec)
+	if f.CompileFunc == nil {
+		return nil, nil
+	}
+	return f.CompileFunc(ctx, spec)
+}
+
+// Ping fails with PingErr if it is set
+func (f *FakeRuntime) Ping(ctx context.Context) (string, error) {
+	if f.PingErr != nil {
+		return "", f.PingErr
+	}
+	return "fake", nil
+}
+
+// ImageExists reports every image not in MissingImages as present
+func (f *FakeRuntime) ImageExists(ctx context.Context, image string) (bool, error) {
+	for _, missing := range f.MissingImages {
+		if missing == image {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// Run calls RunFunc in a goroutine wired to in-memory pipes
+func (f *FakeRuntime) Run(ctx context.Context, spec Spec) (Process, error) {
+	f.record(spec)
+
+	run := f.RunFunc
+	if run == nil {
+		run = func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+			_, err := io.Copy(stdout, stdin)
+			return err
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	stdinR, stdinW := io.Pipe()
+	stdoutR, stdoutW := io.Pipe()
+	stderrR, stderrW := io.Pipe()
+
+	p := &fakeProcess{
+		cancel: cancel,
+		stdin:  stdinW,
+		stdout: stdoutR,
+		stderr: stderrR,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		start := time.Now()
+		err := run(runCtx, spec, stdinR, stdoutW, stderrW)
+
+		var exit *FakeExit
+		switch {
+		case errors.As(err, &exit):
+			p.status = exit.Status
+		case runCtx.Err() != nil:
+			// Killed, like a container receiving SIGKILL
+			p.status = exitStatus(137)
+		case err != nil:
+			p.status = ExitStatus{ExitCode: 1}
+		}
+		if p.status.Usage.WallTime == 0 {
+			p.status.Usage.WallTime = time.Since(start)
+		}
+		stdinR.Close()
+		stdoutW.Close()
+		stderrW.Close()
+		cancel()
+		close(p.done)
+	}()
+
+	// Closing the pipes unblocks a RunFunc stuck on I/O when it gets killed
+	go func() {
+		<-runCtx.Done()
+		stdinR.CloseWithError(runCtx.Err())
+		stdoutW.CloseWithError(runCtx.Err())
+		stderrW.CloseWithError(runCtx.Err())
+	}()
+
+	return p, nil
+}
+
+// fakeProcess is a RunFunc invocation in progress
+type fakeProcess struct {
+	cancel context.CancelFunc
+	stdin  *io.PipeWriter
+	stdout *io.PipeReader
+	stderr *io.PipeReader
+	done   chan struct{}
+	status ExitStatus
+}
+
+func (p *fakeProcess) Stdin() io.WriteCloser { return p.stdin }
+func (p *fakeProcess) Stdout() io.Reader     { return p.stdout }
+func (p *fakeProcess) Stderr() io.Reader     { return p.stderr }
+
+// Wait blocks until RunFunc returns
+func (p *fakeProcess) Wait() (ExitStatus, error) {
+	<-p.done
+	return p.status, nil
+}
+
+// Kill cancels the context passed to RunFunc
+func (p *fakeProcess) Kill() error {
+	p.cancel()
+	return nil
+}
@@ -0,0 +1,147 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+// Health check outcomes
+const (
+	CheckOK   = "ok"
+	CheckFail = "fail"
+)
+
+// HealthCheck is the outcome of one readiness check
+type HealthCheck struct {
+	Status string `json:"status"` // CheckOK or CheckFail
+	Detail string `json:"detail"`
+}
+
+func checkOK(format string, args ...interface{}) HealthCheck {
+	return HealthCheck{Status: CheckOK, Detail: fmt.Sprintf(format, args...)}
+}
+
+func checkFail(format string, args ...interface{}) HealthCheck {
+	return HealthCheck{Status: CheckFail, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Readiness reports whether the executor can take submissions: the sandbox
+// backend is reachable, every configured language image is present, the temp
+// directory has room, the queue is not nearly full and not every worker is
+// stuck. It returns each check by name and whether all of them passed.
+func (e *CodeExecutor) Readiness(ctx context.Context) (map[string]HealthCheck, bool) {
+	ctx, cancel := context.WithTimeout(ctx, e.config.Health.CheckTimeout)
+	defer cancel()
+
+	checks := map[string]HealthCheck{
+		"disk":    e.checkDisk(),
+		"queue":   e.checkQueue(),
+		"workers": e.checkWorkers(),
+	}
+	if version, err := e.runtime.Ping(ctx); err != nil {
+		checks["docker"] = checkFail("%v", err)
+		checks["images"] = checkFail("not checked: Docker is unreachable")
+	} else {
+		checks["docker"] = checkOK("server version %s", version)
+		checks["images"] = e.checkImages(ctx)
+	}
+
+	ready := true
+	for _, check := range checks {
+		if check.Status != CheckOK {
+			ready = false
+		}
+	}
+	return checks, ready
+}
+
+// checkImages looks for the image of every configured language
+func (e *CodeExecutor) checkImages(ctx context.Context) HealthCheck {
+	unique := make(map[string]bool)
+	for _, langConfig := range e.Languages() {
+		unique[langConfig.Image] = true
+	}
+	images := make([]string, 0, len(unique))
+	for image := range unique {
+		images = append(images, image)
+	}
+	sort.Strings(images)
+
+	var missing []string
+	for _, image := range images {
+		exists, err := e.runtime.ImageExists(ctx, image)
+		if err != nil {
+			return checkFail("%v", err)
+		}
+		if !exists {
+			missing = append(missing, image)
+		}
+	}
+	if len(missing) > 0 {
+		return checkFail("missing %s", strings.Join(missing, ", "))
+	}
+	return checkOK("%d images present", len(images))
+}
+
+// checkDisk compares the free space in the temp directory, where submissions
+// are written and compiled, with the configured minimum
+func (e *CodeExecutor) checkDisk() HealthCheck {
+	minFree := e.config.Health.MinFreeDisk
+	if minFree == "0" {
+		return checkOK("not checked")
+	}
+	required, err := config.ParseMemory(minFree)
+	if err != nil {
+		return checkFail("%v", err)
+	}
+
+	dir := os.TempDir()
+	free, err := freeDiskSpace(dir)
+	if errors.Is(err, errors.ErrUnsupported) {
+		return checkOK("not measured on this platform")
+	}
+	if err != nil {
+		return checkFail("%s: %v", dir, err)
+	}
+	if free < required {
+		return checkFail("%s: %d bytes free, %d required", dir, free, required)
+	}
+	return checkOK("%s: %d bytes free", dir, free)
+}
+
+// checkQueue fails once the queue is filled beyond the configured share
+func (e *CodeExecutor) checkQueue() HealthCheck {
+	depth, capacity := e.queue.len(), e.queue.capacity
+	if float64(depth) >= e.config.Health.MaxQueueUsage*float64(capacity) {
+		return checkFail("%d of %d queued", depth, capacity)
+	}
+	return checkOK("%d of %d queued", depth, capacity)
+}
+
+// checkWorkers fails when every worker has been busy with the same submission
+// for longer than any submission should take
+func (e *CodeExecutor) checkWorkers() HealthCheck {
+	workers := e.config.Executor.ConcurrentExecutions
+	stuckAfter := e.config.Health.StuckAfter
+
+	e.workersMutex.Lock()
+	busy, stuck := len(e.busyWorkers), 0
+	for _, worker := range e.busyWorkers {
+		if time.Since(worker.since) > stuckAfter {
+			stuck++
+		}
+	}
+	e.workersMutex.Unlock()
+
+	if stuck >= workers {
+		return checkFail("all %d workers busy for over %s", workers, stuckAfter)
+	}
+	return checkOK("%d of %d busy, %d for over %s", busy, workers, stuck, stuckAfter)
+}
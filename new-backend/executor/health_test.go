@@ -0,0 +1,163 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// occupyWorker submits a program that keeps the only worker of e busy until
+// the test ends
+func occupyWorker(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+	t.Helper()
+	started, release := make(chan string, 10), make(chan struct{})
+	rt.RunFunc = blockingRun(started, release)
+	t.Cleanup(func() { close(release) })
+
+	submit(t, e, &models.CodeSubmission{Language: "script", Code: "block", Input: "busy\n"})
+	select {
+	case <-started:
+	case <-time.After(10 * time.Second):
+		t.Fatal("the blocking program did not start")
+	}
+}
+
+func TestReadiness(t *testing.T) {
+	tests := []struct {
+		name      string
+		configure func(cfg *config.Config)
+		prepare   func(t *testing.T, e *CodeExecutor, rt *FakeRuntime)
+		wantFail  map[string]string // Failing checks and part of their detail
+		wantOK    map[string]string // Some passing checks and part of their detail
+	}{
+		{
+			name: "ready",
+			wantOK: map[string]string{
+				"docker":  "server version fake",
+				"images":  "2 images present",
+				"disk":    "bytes free",
+				"queue":   "0 of 1000 queued",
+				"workers": "0 of 1 busy, 0 for over 10m0s",
+			},
+		},
+		{
+			name: "docker down",
+			prepare: func(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+				rt.PingErr = errors.New("Cannot connect to the Docker daemon")
+			},
+			wantFail: map[string]string{
+				"docker": "Cannot connect to the Docker daemon",
+				"images": "not checked: Docker is unreachable",
+			},
+		},
+		{
+			name: "missing image",
+			prepare: func(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+				rt.MissingImages = []string{"compiled:latest", "unused:latest"}
+			},
+			wantFail: map[string]string{"images": "missing compiled:latest"},
+		},
+		{
+			name: "low disk",
+			configure: func(cfg *config.Config) {
+				cfg.Health.MinFreeDisk = "1000000000g"
+			},
+			prepare: func(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+				if _, err := freeDiskSpace(os.TempDir()); errors.Is(err, errors.ErrUnsupported) {
+					t.Skip("free disk space is not measured on this platform")
+				}
+			},
+			wantFail: map[string]string{"disk": "required"},
+		},
+		{
+			name: "disk check disabled",
+			configure: func(cfg *config.Config) {
+				cfg.Health.MinFreeDisk = "0"
+			},
+			wantOK: map[string]string{"disk": "not checked"},
+		},
+		{
+			name: "full queue",
+			configure: func(cfg *config.Config) {
+				cfg.Executor.QueueCapacity = 4
+				cfg.Health.MaxQueueUsage = 0.5
+			},
+			prepare: func(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+				occupyWorker(t, e, rt)
+				for i := 0; i < 2; i++ {
+					submit(t, e, &models.CodeSubmission{Language: "script", Code: "queued", Input: "waiting\n"})
+				}
+			},
+			wantFail: map[string]string{"queue": "2 of 4 queued"},
+			wantOK:   map[string]string{"workers": "1 of 1 busy, 0 for over"},
+		},
+		{
+			name: "queue below the limit",
+			configure: func(cfg *config.Config) {
+				cfg.Executor.QueueCapacity = 4
+				cfg.Health.MaxQueueUsage = 0.5
+			},
+			prepare: func(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+				occupyWorker(t, e, rt)
+				submit(t, e, &models.CodeSubmission{Language: "script", Code: "queued", Input: "waiting\n"})
+			},
+			wantOK: map[string]string{"queue": "1 of 4 queued"},
+		},
+		{
+			name: "stuck worker",
+			configure: func(cfg *config.Config) {
+				cfg.Health.StuckAfter = 10 * time.Millisecond
+			},
+			prepare: func(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+				occupyWorker(t, e, rt)
+				time.Sleep(20 * time.Millisecond)
+			},
+			wantFail: map[string]string{"workers": "all 1 workers busy for over 10ms"},
+		},
+		{
+			name: "busy worker",
+			prepare: func(t *testing.T, e *CodeExecutor, rt *FakeRuntime) {
+				occupyWorker(t, e, rt)
+			},
+			wantOK: map[string]string{"workers": "1 of 1 busy, 0 for over 10m0s"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := NewFakeRuntime()
+			e := newTestExecutor(t, rt, tt.configure)
+			if tt.prepare != nil {
+				tt.prepare(t, e, rt)
+			}
+
+			checks, ready := e.Readiness(context.Background())
+			if want := len(tt.wantFail) == 0; ready != want {
+				t.Errorf("ready = %v, want %v: %+v", ready, want, checks)
+			}
+			for _, name := range []string{"docker", "images", "disk", "queue", "workers"} {
+				check, exists := checks[name]
+				if !exists {
+					t.Errorf("no %s check", name)
+					continue
+				}
+				wantStatus, detail := CheckOK, tt.wantOK[name]
+				if failure, fails := tt.wantFail[name]; fails {
+					wantStatus, detail = CheckFail, failure
+				}
+				if check.Status != wantStatus {
+					t.Errorf("%s check is %s (%s), want %s", name, check.Status, check.Detail, wantStatus)
+				}
+				if !strings.Contains(check.Detail, detail) {
+					t.Errorf("%s check detail = %q, want it to contain %q", name, check.Detail, detail)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// interactor drives an interactive problem. For each test case it runs as
+//
+//	<run command> input.txt answer.txt
+//
+// in its own sandbox while the solution runs in another, with the solution's
+// stdout connected to the interactor's stdin and the other way round. The
+// interactor decides the verdict with the same exit codes as a checker; what
+// it writes to stderr is returned as a comment, and a number between 0 and 1
+// on its first line gives a wrong answer partial credit.
+type interactor struct {
+	*auxProgram
+}
+
+// newInteractor builds an interactor program through the normal language pipeline
+func (e *CodeExecutor) newInteractor(ctx context.Context, submissionID string, program *models.Program) (*interactor, error) {
+	aux, err := e.buildAuxProgram(ctx, "interactor", submissionID, program)
+	if err != nil {
+		return nil, err
+	}
+	return &interactor{aux}, nil
+}
+
+// runInteractive runs the solution against the interactor for one test case,
+// streaming everything the two exchange to the submission's terminals
+func (e *CodeExecutor) runInteractive(parent context.Context, submissionID string, index int, spec Spec, inter *interactor, testCase models.TestCase, langConfig config.LanguageConfig) models.TestCaseResult {
+	result := models.TestCaseResult{ID: testCase.ID}
+	spec, timeout := testCaseLimits(spec, testCase, langConfig)
+
+	interSpec, err := inter.command(
+		auxFile{"input.txt", testCase.Input},
+		auxFile{"answer.txt", testCase.ExpectedOutput},
+	)
+	if err != nil {
+		result.Verdict = models.VerdictJudgeError
+		result.CheckerOutput = "Failed to write interactor input: " + err.Error()
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(parent, timeout+startupAllowance)
+	defer cancel()
+
+	start := time.Now()
+	solution, err := e.runtime.Run(ctx, spec)
+	if err != nil {
+		result.Verdict = models.VerdictRuntimeError
+		result.Error = err.Error()
+		return result
+	}
+	interProcess, err := e.runtime.Run(ctx, interSpec)
+	if err != nil {
+		solution.Kill()
+		solution.Wait()
+		result.Verdict = models.VerdictJudgeError
+		result.CheckerOutput = "Interactor failed to run: " + err.Error()
+		return result
+	}
+
+	solutionOut := &cappedBuffer{limit: maxJudgeOutput}
+	solutionErr := &cappedBuffer{limit: maxJudgeOutput}
+	interErr := &cappedBuffer{limit: maxJudgeOutput}
+
+	var streams sync.WaitGroup
+	streams.Add(4)
+	go func() {
+		defer streams.Done()
+		e.pipeTranscript(submissionID, index, "solution", solution.Stdout(), interProcess.Stdin(), solutionOut)
+	}()
+	go func() {
+		defer streams.Done()
+		e.pipeTranscript(submissionID, index, "interactor", interProcess.Stdout(), solution.Stdin(), io.Discard)
+	}()
+	go func() {
+		defer streams.Done()
+		io.Copy(solutionErr, solution.Stderr())
+	}()
+	go func() {
+		defer streams.Done()
+		io.Copy(interErr, interProcess.Stderr())
+	}()
+	streams.Wait()
+
+	solutionStatus, solutionWaitErr := solution.Wait()
+	interStatus, interWaitErr := interProcess.Wait()
+	elapsed := time.Since(start)
+	timedOut := overTimeLimit(solutionStatus.Usage, elapsed, timeout, ctx.Err() == context.DeadlineExceeded)
+	recordUsage(&result, solutionStatus.Usage, elapsed)
+	if solutionWaitErr == nil {
+		result.Exit = exitInfo(solutionStatus, timedOut)
+	}
+	result.Output = solutionOut.String()
+	result.Error = solutionErr.String()
+
+	fraction, comment := partialScore(interErr.String())
+	result.CheckerOutput = truncate(comment)
+
+	switch {
+	case timedOut:
+		result.Verdict = models.VerdictTimeLimitExceeded
+	case interWaitErr == nil && (interStatus.ExitCode == checkerWrongAnswer || interStatus.ExitCode == checkerPresentationError):
+		// A solution that broke the protocol usually dies of a closed pipe;
+		// the interactor's judgement is the more useful one
+		result.Verdict = models.VerdictWrongAnswer
+		result.Score = fraction * testCasePoints(testCase)
+	case solutionStatus.OOMKilled:
+		result.Verdict = models.VerdictMemoryLimitExceeded
+	case solutionWaitErr != nil || solutionStatus.ExitCode != 0:
+		result.Verdict = models.VerdictRuntimeError
+		if solutionWaitErr != nil {
+			result.Error = solutionWaitErr.Error()
+		}
+	case interWaitErr != nil || interStatus.ExitCode != checkerAccepted:
+		result.Verdict = models.VerdictJudgeError
+		result.CheckerOutput = truncate(strings.TrimSpace(interErr.String()))
+	default:
+		result.Verdict = models.VerdictAccepted
+		result.Score = testCasePoints(testCase)
+	}
+
+	return result
+}
+
+// pipeTranscript copies src to dst until src ends, keeping a copy in record
+// and streaming each chunk to the terminals as a transcript message. Once dst
+// stops accepting data the rest of src is still drained so the writer never
+// blocks; dst is closed at the end so its reader sees end of input.
+func (e *CodeExecutor) pipeTranscript(submissionID string, index int, from string, src io.Reader, dst io.WriteCloser, record io.Writer) {
+	defer dst.Close()
+
+	buffer := make([]byte, 4096)
+	dstOpen := true
+	for {
+		n, err := src.Read(buffer)
+		if n > 0 {
+			data := buffer[:n]
+			record.Write(data)
+			e.sendToTerminals(submissionID, models.NewTranscriptMessage(index, from, string(data)))
+			if dstOpen {
+				if _, err := dst.Write(data); err != nil {
+					dstOpen = false
+				}
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package executor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// doubler is a solution that answers a number with its double
+func doubler(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+	line, err := bufio.NewReader(stdin).ReadString('\n')
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(stdout, 2*n)
+	return err
+}
+
+// askingInteractor sends the test input to the solution and judges its reply
+// against the answer file
+func askingInteractor(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+	args := spec.Cmd[len(spec.Cmd)-2:]
+	input, answer := sandboxFile(spec, args[0]), sandboxFile(spec, args[1])
+	io.WriteString(stdout, input)
+
+	reply, err := bufio.NewReader(stdin).ReadString('\n')
+	switch {
+	case err != nil:
+		io.WriteString(stderr, "no reply")
+		return &FakeExit{Status: exitStatus(checkerPresentationError)}
+	case reply != answer:
+		fmt.Fprintf(stderr, "0.5\nexpected %s, got %s", strings.TrimSpace(answer), strings.TrimSpace(reply))
+		return &FakeExit{Status: exitStatus(checkerWrongAnswer)}
+	}
+	return nil
+}
+
+func TestInteractor(t *testing.T) {
+	tests := []struct {
+		name        string
+		solution    runFunc
+		interactor  runFunc
+		timeLimitMs int
+		wantVerdict models.Verdict
+		wantScore   float64
+		wantOutput  string // What the solution sent to the interactor
+		wantComment string
+	}{
+		{
+			name:        "accepted",
+			solution:    doubler,
+			interactor:  askingInteractor,
+			wantVerdict: models.VerdictAccepted,
+			wantScore:   2,
+			wantOutput:  "6\n",
+		},
+		{
+			name: "wrong answer with partial credit",
+			solution: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				bufio.NewReader(stdin).ReadString('\n')
+				_, err := io.WriteString(stdout, "7\n")
+				return err
+			},
+			interactor:  askingInteractor,
+			wantVerdict: models.VerdictWrongAnswer,
+			wantScore:   1,
+			wantOutput:  "7\n",
+			wantComment: "expected 6, got 7",
+		},
+		{
+			name: "solution breaks the protocol",
+			solution: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				return &FakeExit{Status: exitStatus(1)}
+			},
+			interactor:  askingInteractor,
+			wantVerdict: models.VerdictWrongAnswer,
+			wantComment: "no reply",
+		},
+		{
+			name: "solution crashes",
+			solution: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				io.WriteString(stderr, "segmentation fault")
+				return &FakeExit{Status: exitStatus(139)}
+			},
+			interactor: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				return nil
+			},
+			wantVerdict: models.VerdictRuntimeError,
+		},
+		{
+			name:     "interactor fails",
+			solution: doubler,
+			interactor: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				io.WriteString(stdout, "3\n")
+				io.Copy(io.Discard, stdin)
+				io.WriteString(stderr, "index out of range")
+				return &FakeExit{Status: exitStatus(3)}
+			},
+			wantVerdict: models.VerdictJudgeError,
+			wantOutput:  "6\n",
+			wantComment: "index out of range",
+		},
+		{
+			name: "solution keeps writing after the interactor is done",
+			solution: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				line := strings.Repeat("x", 1023) + "\n"
+				for i := 0; i < 256; i++ {
+					if _, err := io.WriteString(stdout, line); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+			interactor: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				return nil
+			},
+			wantVerdict: models.VerdictAccepted,
+			wantScore:   2,
+			wantOutput:  strings.Repeat(strings.Repeat("x", 1023)+"\n", 256),
+		},
+		{
+			name: "solution never answers",
+			solution: func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+			// The interactor waiting for a reply is killed along with it
+			interactor:  askingInteractor,
+			timeLimitMs: 100,
+			wantVerdict: models.VerdictTimeLimitExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := NewFakeRuntime()
+			rt.RunFunc = runByCode(map[string]runFunc{
+				"solution":   tt.solution,
+				"interactor": tt.interactor,
+			})
+			e := newTestExecutor(t, rt, nil)
+
+			start := time.Now()
+			id := submit(t, e, &models.CodeSubmission{
+				Language:   "script",
+				Code:       "solution",
+				Interactor: &models.Program{Language: "script", Code: "interactor"},
+				TestCases:  []models.TestCase{{Input: "3\n", ExpectedOutput: "6\n", Points: 2, TimeLimitMs: tt.timeLimitMs}},
+			})
+			submission := waitFinished(t, e, id)
+			if len(submission.TestResults) != 1 {
+				t.Fatalf("status %q with %d results, want 1: %s", submission.Status, len(submission.TestResults), submission.Output)
+			}
+			result := submission.TestResults[0]
+
+			if result.Verdict != tt.wantVerdict {
+				t.Errorf("verdict = %q, want %q", result.Verdict, tt.wantVerdict)
+			}
+			if result.Score != tt.wantScore {
+				t.Errorf("score = %v, want %v", result.Score, tt.wantScore)
+			}
+			if result.Output != tt.wantOutput {
+				t.Errorf("solution output = %.40q (%d bytes), want %.40q (%d bytes)", result.Output, len(result.Output), tt.wantOutput, len(tt.wantOutput))
+			}
+			if result.CheckerOutput != tt.wantComment {
+				t.Errorf("interactor comment = %q, want %q", result.CheckerOutput, tt.wantComment)
+			}
+			if limit := time.Duration(tt.timeLimitMs)*time.Millisecond + startupAllowance; tt.timeLimitMs > 0 && time.Since(start) > limit+time.Second {
+				t.Errorf("took %s, want the solution killed after %s", time.Since(start), limit)
+			}
+		})
+	}
+}
+
+func TestInteractorTranscript(t *testing.T) {
+	// Neither side talks before the test's terminal is connected
+	started := make(chan struct{})
+	waitFor := func(program runFunc) runFunc {
+		return func(ctx context.Context, spec Spec, stdin io.Reader, stdout, stderr io.Writer) error {
+			<-started
+			return program(ctx, spec, stdin, stdout, stderr)
+		}
+	}
+	rt := NewFakeRuntime()
+	rt.RunFunc = runByCode(map[string]runFunc{
+		"solution":   waitFor(doubler),
+		"interactor": waitFor(askingInteractor),
+	})
+	e := newTestExecutor(t, rt, nil)
+
+	id := submit(t, e, &models.CodeSubmission{
+		Language:   "script",
+		Code:       "solution",
+		Interactor: &models.Program{Language: "script", Code: "interactor"},
+		TestCases:  []models.TestCase{{Input: "21\n", ExpectedOutput: "42\n"}},
+	})
+	conn := dialTerminal(t, e, id)
+	close(started)
+
+	var transcript []string
+	for _, message := range readUntilFinal(t, conn) {
+		if message.Type == "transcript" {
+			var content models.TranscriptMessage
+			if err := json.Unmarshal(message.Content, &content); err != nil {
+				t.Fatal(err)
+			}
+			transcript = append(transcript, content.From+": "+content.Text)
+		}
+	}
+	want := []string{"interactor: 21\n", "solution: 42\n"}
+	if !reflect.DeepEqual(transcript, want) {
+		t.Errorf("transcript = %q, want %q", transcript, want)
+	}
+}
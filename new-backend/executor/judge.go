@@ -0,0 +1,305 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/judge"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/ishikabhoyar/monaco/new-backend/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxJudgeOutput caps how much of each stream is kept from a single test run
+const maxJudgeOutput = 1 << 20
+
+// startupAllowance is added to a test run's time limit before it is killed,
+// to cover creating and starting its sandbox. Whether the limit was exceeded
+// is decided from the time the program itself ran, see overTimeLimit.
+const startupAllowance = 2 * time.Second
+
+// judge runs the program built for a submission against each of its test
+// cases and records a verdict per case plus the aggregate verdict and score
+func (e *CodeExecutor) judge(ctx context.Context, submission *models.CodeSubmission, spec Spec, buildErr error, langConfig config.LanguageConfig) {
+	var compileErr *CompileError
+	if buildErr != nil && !errors.As(buildErr, &compileErr) {
+		submission.Status = "failed"
+		submission.Output = buildErr.Error()
+		return
+	}
+
+	// Pick how each test case is run, setting up helpers first so a bad one fails fast
+	var runCase func(ctx context.Context, index int, testCase models.TestCase) models.TestCaseResult
+	switch {
+	case compileErr != nil:
+		runCase = func(ctx context.Context, index int, testCase models.TestCase) models.TestCaseResult {
+			return models.TestCaseResult{
+				ID:      testCase.ID,
+				Verdict: models.VerdictCompilationError,
+				Error:   compileErr.Output,
+			}
+		}
+
+	case submission.Interactor != nil:
+		interactor, err := e.newInteractor(ctx, submission.ID, submission.Interactor)
+		if err != nil {
+			submission.Status = "failed"
+			submission.Output = err.Error()
+			return
+		}
+		defer interactor.close()
+		runCase = func(ctx context.Context, index int, testCase models.TestCase) models.TestCaseResult {
+			return e.runInteractive(ctx, submission.ID, index, spec, interactor, testCase, langConfig)
+		}
+
+	case submission.Checker != nil:
+		checker, err := e.newProgramChecker(ctx, submission.ID, submission.Checker)
+		if err != nil {
+			submission.Status = "failed"
+			submission.Output = err.Error()
+			return
+		}
+		defer checker.close()
+		runCase = func(ctx context.Context, index int, testCase models.TestCase) models.TestCaseResult {
+			return e.runTestCase(ctx, spec, testCase, checker, langConfig)
+		}
+
+	default:
+		checkers := make([]answerChecker, len(submission.TestCases))
+		for i, testCase := range submission.TestCases {
+			comparator, err := newComparator(testCase)
+			if err != nil {
+				submission.Status = "failed"
+				submission.Output = fmt.Sprintf("Test case %d: %v", i+1, err)
+				return
+			}
+			checkers[i] = comparatorChecker{comparator}
+		}
+		runCase = func(ctx context.Context, index int, testCase models.TestCase) models.TestCaseResult {
+			return e.runTestCase(ctx, spec, testCase, checkers[index], langConfig)
+		}
+	}
+
+	results := make([]models.TestCaseResult, len(submission.TestCases))
+	for i, testCase := range submission.TestCases {
+		caseCtx, span := tracing.Start(ctx, "test case", trace.WithAttributes(attribute.Int("monaco.test_case.index", i)))
+		results[i] = runCase(caseCtx, i, testCase)
+		span.SetAttributes(attribute.String("monaco.test_case.verdict", string(results[i].Verdict)))
+		span.End()
+		if ctx.Err() != nil {
+			// Cancelled; keep the cases judged so far and let the worker record the status
+			submission.TestResults = results[:i]
+			return
+		}
+		submission.RunTime += results[i].ExecutionTime
+		submission.ExecutionTime += results[i].ExecutionTime
+		submission.CPUTime += results[i].CPUTime
+		if results[i].PeakMemory > submission.PeakMemory {
+			submission.PeakMemory = results[i].PeakMemory
+		}
+		e.sendToTerminals(submission.ID, models.NewTestResultMessage(i, results[i]))
+	}
+
+	submission.TestResults = results
+	describeUsage(submission)
+	submission.Verdict, submission.Score, submission.MaxScore = summarize(submission.TestCases, results)
+	submission.Status = "completed"
+	if compileErr != nil {
+		submission.Output = compileErr.Error()
+	}
+}
+
+// testCaseLimits applies a test case's limits to the spec that runs the
+// solution and returns the time limit for the run. A test case can only
+// tighten the language's limits; looser or unusable ones are ignored.
+func testCaseLimits(spec Spec, testCase models.TestCase, langConfig config.LanguageConfig) (Spec, time.Duration) {
+	timeout := time.Duration(langConfig.TimeoutSec) * time.Second
+	if limit := time.Duration(testCase.TimeLimitMs) * time.Millisecond; limit > 0 && limit < timeout {
+		timeout = limit
+	}
+	if testCase.MemoryLimit != "" {
+		memory, err := config.ParseMemory(testCase.MemoryLimit)
+		maxMemory, maxErr := config.ParseMemory(langConfig.MemoryLimit)
+		if err == nil && maxErr == nil && memory >= config.MinMemoryBytes && memory <= maxMemory {
+			spec.Limits.Memory = testCase.MemoryLimit
+		}
+	}
+	// The artifact is shared by every test case; keep runs from tampering with it
+	spec.ReadOnly = true
+	return spec, timeout
+}
+
+// runTestCase runs the program once with the test case's input and limits
+// and has checker judge its output
+func (e *CodeExecutor) runTestCase(ctx context.Context, spec Spec, testCase models.TestCase, checker answerChecker, langConfig config.LanguageConfig) models.TestCaseResult {
+	spec, timeout := testCaseLimits(spec, testCase, langConfig)
+
+	run := e.runProgram(ctx, spec, testCase.Input, timeout)
+	result := models.TestCaseResult{
+		ID:     testCase.ID,
+		Output: run.stdout,
+		Error:  run.stderr,
+	}
+	recordUsage(&result, run.status.Usage, run.elapsed)
+	if run.err == nil {
+		result.Exit = exitInfo(run.status, run.timedOut)
+	}
+
+	switch {
+	case run.timedOut:
+		result.Verdict = models.VerdictTimeLimitExceeded
+	case run.status.OOMKilled:
+		result.Verdict = models.VerdictMemoryLimitExceeded
+	case run.err != nil || run.status.ExitCode != 0:
+		result.Verdict = models.VerdictRuntimeError
+		if run.err != nil {
+			result.Error = run.err.Error()
+		}
+	default:
+		check := checker.check(ctx, testCase, run.stdout)
+		result.Verdict = check.verdict
+		result.Hint = check.hint
+		result.CheckerOutput = check.message
+		result.Score = check.fraction * testCasePoints(testCase)
+	}
+
+	return result
+}
+
+// runOutcome is what happened during a single run of a program
+type runOutcome struct {
+	stdout   string
+	stderr   string
+	status   ExitStatus
+	err      error
+	timedOut bool
+	elapsed  time.Duration
+}
+
+// runProgram runs spec to completion with input on stdin, keeping at most
+// maxJudgeOutput bytes of each output stream. The program is killed
+// startupAllowance after its time limit.
+func (e *CodeExecutor) runProgram(parent context.Context, spec Spec, input string, timeout time.Duration) runOutcome {
+	ctx, span := tracing.Start(parent, "run", trace.WithAttributes(attribute.String("monaco.image", spec.Image)))
+	defer span.End()
+	ctx, cancel := context.WithTimeout(ctx, timeout+startupAllowance)
+	defer cancel()
+
+	start := time.Now()
+	process, err := e.runtime.Run(ctx, spec)
+	if err != nil {
+		tracing.Fail(span, err)
+		return runOutcome{err: err}
+	}
+
+	// Feed the input without blocking on programs that never read it
+	go func() {
+		io.Copy(process.Stdin(), strings.NewReader(input))
+		process.Stdin().Close()
+	}()
+
+	stdout := &cappedBuffer{limit: maxJudgeOutput}
+	stderr := &cappedBuffer{limit: maxJudgeOutput}
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go func() {
+		defer readers.Done()
+		io.Copy(stdout, process.Stdout())
+	}()
+	go func() {
+		defer readers.Done()
+		io.Copy(stderr, process.Stderr())
+	}()
+	readers.Wait()
+
+	status, err := process.Wait()
+	elapsed := time.Since(start)
+	return runOutcome{
+		stdout:   stdout.String(),
+		stderr:   stderr.String(),
+		status:   status,
+		err:      err,
+		timedOut: overTimeLimit(status.Usage, elapsed, timeout, ctx.Err() == context.DeadlineExceeded),
+		elapsed:  elapsed,
+	}
+}
+
+// answerChecker decides whether the output of a test run is correct
+type answerChecker interface {
+	check(ctx context.Context, testCase models.TestCase, output string) checkResult
+}
+
+// checkResult is an answerChecker's decision about one output
+type checkResult struct {
+	verdict  models.Verdict
+	fraction float64 // Share of the test case's points earned
+	hint     *models.DiffHint
+	message  string // Comment from a checker program
+}
+
+// comparatorChecker judges output with one of the built-in comparators
+type comparatorChecker struct {
+	comparator judge.Comparator
+}
+
+func (c comparatorChecker) check(ctx context.Context, testCase models.TestCase, output string) checkResult {
+	if hint := c.comparator.Compare(testCase.ExpectedOutput, output); hint != nil {
+		return checkResult{verdict: models.VerdictWrongAnswer, hint: hint}
+	}
+	return checkResult{verdict: models.VerdictAccepted, fraction: 1}
+}
+
+// newComparator returns the comparator selected by a test case
+func newComparator(testCase models.TestCase) (judge.Comparator, error) {
+	options := judge.Options{AbsEpsilon: testCase.AbsEpsilon, RelEpsilon: testCase.RelEpsilon}
+	return judge.NewComparator(testCase.Comparator, options, testCase.ExpectedOutput)
+}
+
+// summarize returns the overall verdict, which is the first verdict that is
+// not Accepted, and the points earned out of the points available
+func summarize(testCases []models.TestCase, results []models.TestCaseResult) (models.Verdict, float64, float64) {
+	verdict := models.VerdictAccepted
+	var score, maxScore float64
+
+	for i, result := range results {
+		maxScore += testCasePoints(testCases[i])
+		score += result.Score
+		if result.Verdict != models.VerdictAccepted && verdict == models.VerdictAccepted {
+			verdict = result.Verdict
+		}
+	}
+
+	return verdict, score, maxScore
+}
+
+// testCasePoints returns the weight of a test case
+func testCasePoints(testCase models.TestCase) float64 {
+	if testCase.Points == 0 {
+		return 1
+	}
+	return testCase.Points
+}
+
+// cappedBuffer keeps the first limit bytes written to it and discards the rest
+type cappedBuffer struct {
+	strings.Builder
+	limit int
+}
+
+func (c *cappedBuffer) Write(p []byte) (int, error) {
+	if room := c.limit - c.Len(); room > 0 {
+		if len(p) > room {
+			c.Builder.Write(p[:room])
+		} else {
+			c.Builder.Write(p)
+		}
+	}
+	return len(p), nil
+}
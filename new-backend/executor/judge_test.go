@@ -0,0 +1,149 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+func TestSummarize(t *testing.T) {
+	accepted := func(score float64) models.TestCaseResult {
+		return models.TestCaseResult{Verdict: models.VerdictAccepted, Score: score}
+	}
+	failed := func(verdict models.Verdict, score float64) models.TestCaseResult {
+		return models.TestCaseResult{Verdict: verdict, Score: score}
+	}
+
+	tests := []struct {
+		name         string
+		testCases    []models.TestCase
+		results      []models.TestCaseResult
+		wantVerdict  models.Verdict
+		wantScore    float64
+		wantMaxScore float64
+	}{
+		{
+			name:        "no test cases",
+			wantVerdict: models.VerdictAccepted,
+		},
+		{
+			name:         "all accepted with default points",
+			testCases:    []models.TestCase{{}, {}, {}},
+			results:      []models.TestCaseResult{accepted(1), accepted(1), accepted(1)},
+			wantVerdict:  models.VerdictAccepted,
+			wantScore:    3,
+			wantMaxScore: 3,
+		},
+		{
+			name:         "weighted points",
+			testCases:    []models.TestCase{{Points: 10}, {}, {Points: 2.5}},
+			results:      []models.TestCaseResult{accepted(10), accepted(1), accepted(2.5)},
+			wantVerdict:  models.VerdictAccepted,
+			wantScore:    13.5,
+			wantMaxScore: 13.5,
+		},
+		{
+			name:      "first failure decides the verdict",
+			testCases: []models.TestCase{{}, {}, {}, {}},
+			results: []models.TestCaseResult{
+				accepted(1),
+				failed(models.VerdictTimeLimitExceeded, 0),
+				failed(models.VerdictWrongAnswer, 0),
+				accepted(1),
+			},
+			wantVerdict:  models.VerdictTimeLimitExceeded,
+			wantScore:    2,
+			wantMaxScore: 4,
+		},
+		{
+			name:      "partial credit from a checker",
+			testCases: []models.TestCase{{Points: 4}, {Points: 6}},
+			results: []models.TestCaseResult{
+				accepted(4),
+				failed(models.VerdictWrongAnswer, 3),
+			},
+			wantVerdict:  models.VerdictWrongAnswer,
+			wantScore:    7,
+			wantMaxScore: 10,
+		},
+		{
+			name:         "nothing accepted",
+			testCases:    []models.TestCase{{}, {}},
+			results:      []models.TestCaseResult{failed(models.VerdictRuntimeError, 0), failed(models.VerdictWrongAnswer, 0)},
+			wantVerdict:  models.VerdictRuntimeError,
+			wantMaxScore: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, score, maxScore := summarize(tt.testCases, tt.results)
+			if verdict != tt.wantVerdict {
+				t.Errorf("verdict = %q, want %q", verdict, tt.wantVerdict)
+			}
+			if score != tt.wantScore || maxScore != tt.wantMaxScore {
+				t.Errorf("score = %v/%v, want %v/%v", score, maxScore, tt.wantScore, tt.wantMaxScore)
+			}
+		})
+	}
+}
+
+func TestOverTimeLimit(t *testing.T) {
+	const limit = time.Second
+
+	tests := []struct {
+		name    string
+		usage   Usage
+		elapsed time.Duration
+		killed  bool
+		want    bool
+	}{
+		{"fast", Usage{WallTime: 200 * time.Millisecond}, 1500 * time.Millisecond, false, false},
+		{"slow sandbox startup", Usage{WallTime: 900 * time.Millisecond}, 2500 * time.Millisecond, false, false},
+		{"wall time over", Usage{WallTime: 1100 * time.Millisecond}, 1200 * time.Millisecond, false, true},
+		{"cpu time over", Usage{WallTime: 800 * time.Millisecond, CPUTime: 1200 * time.Millisecond}, time.Second, false, true},
+		{"unmeasured uses elapsed", Usage{}, 1200 * time.Millisecond, false, true},
+		{"unmeasured within", Usage{}, 800 * time.Millisecond, false, false},
+		{"killed", Usage{}, 500 * time.Millisecond, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := overTimeLimit(tt.usage, tt.elapsed, limit, tt.killed); got != tt.want {
+				t.Errorf("overTimeLimit = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTestCaseLimits(t *testing.T) {
+	langConfig := config.LanguageConfig{MemoryLimit: "100m", TimeoutSec: 5}
+
+	tests := []struct {
+		name        string
+		testCase    models.TestCase
+		wantMemory  string
+		wantTimeout time.Duration
+	}{
+		{"language limits", models.TestCase{}, "100m", 5 * time.Second},
+		{"tighter limits", models.TestCase{TimeLimitMs: 1500, MemoryLimit: "64m"}, "64m", 1500 * time.Millisecond},
+		{"looser time limit", models.TestCase{TimeLimitMs: 3600000}, "100m", 5 * time.Second},
+		{"looser memory limit", models.TestCase{MemoryLimit: "64g"}, "100m", 5 * time.Second},
+		{"memory limit below minimum", models.TestCase{MemoryLimit: "1m"}, "100m", 5 * time.Second},
+		{"malformed memory limit", models.TestCase{MemoryLimit: "lots"}, "100m", 5 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec, timeout := testCaseLimits(Spec{Limits: Limits{Memory: "100m"}}, tt.testCase, langConfig)
+			if spec.Limits.Memory != tt.wantMemory || timeout != tt.wantTimeout {
+				t.Errorf("limits = %s, %s; want %s, %s", spec.Limits.Memory, timeout, tt.wantMemory, tt.wantTimeout)
+			}
+			if !spec.ReadOnly {
+				t.Error("test case runs are not read-only")
+			}
+		})
+	}
+}
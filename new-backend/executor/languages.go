@@ -0,0 +1,83 @@
+package executor
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+// Language returns the current configuration for a language
+func (e *CodeExecutor) Language(name string) (config.LanguageConfig, bool) {
+	e.languagesMutex.RLock()
+	defer e.languagesMutex.RUnlock()
+	langConfig, exists := e.languages[strings.ToLower(name)]
+	return langConfig, exists
+}
+
+// languageLabel returns the key under which a submitted language name is
+// configured, or "unsupported". Language matches names case-insensitively, so
+// metrics and statistics use this instead of the submitted name to keep
+// "Python" and "python" together and clients from creating labels.
+func (e *CodeExecutor) languageLabel(name string) string {
+	key := strings.ToLower(name)
+	if _, exists := e.Language(key); !exists {
+		return "unsupported"
+	}
+	return key
+}
+
+// Languages returns a snapshot of the current language map
+func (e *CodeExecutor) Languages() map[string]config.LanguageConfig {
+	e.languagesMutex.RLock()
+	defer e.languagesMutex.RUnlock()
+	return copyLanguages(e.languages)
+}
+
+// SetConfigLoader sets the function Reload uses to read fresh configuration
+func (e *CodeExecutor) SetConfigLoader(loader func() (*config.Config, error)) {
+	e.languagesMutex.Lock()
+	defer e.languagesMutex.Unlock()
+	e.configLoader = loader
+}
+
+// Reload reads the configuration again and atomically swaps in its language
+// map. Submissions already executing keep the LanguageConfig they started
+// with. On error the current languages stay in effect. Language versions are
+// probed again in the background.
+func (e *CodeExecutor) Reload() error {
+	e.languagesMutex.RLock()
+	loader := e.configLoader
+	e.languagesMutex.RUnlock()
+
+	if loader == nil {
+		return errors.New("configuration reload is not available")
+	}
+
+	cfg, err := loader()
+	if err != nil {
+		return fmt.Errorf("failed to reload configuration: %w", err)
+	}
+	if err := ValidateLanguages(cfg.Languages); err != nil {
+		return fmt.Errorf("failed to reload configuration: %w", err)
+	}
+
+	e.languagesMutex.Lock()
+	e.languages = copyLanguages(cfg.Languages)
+	e.languagesMutex.Unlock()
+
+	slog.Info("reloaded language configuration", "languages", len(cfg.Languages))
+	go e.refreshVersions()
+	return nil
+}
+
+// copyLanguages returns a shallow copy of a language map
+func copyLanguages(languages map[string]config.LanguageConfig) map[string]config.LanguageConfig {
+	copied := make(map[string]config.LanguageConfig, len(languages))
+	for key, langConfig := range languages {
+		copied[key] = langConfig
+	}
+	return copied
+}
@@ -0,0 +1,107 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// scriptConfig is a config file defining the script language with the given
+// image, followed by extra YAML that may add to it or configure more languages
+func scriptConfig(image, extra string) string {
+	return `
+languages:
+  script:
+    name: Script
+    image: ` + image + `
+    memoryLimit: 64m
+    cpuLimit: "0.5"
+    timeoutSec: 1
+    runCmd: [run2, "{source}"]
+    fileExt: .txt
+` + extra
+}
+
+func TestReload(t *testing.T) {
+	rt := newEchoRuntime()
+	e := newTestExecutor(t, rt, nil)
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	e.SetConfigLoader(func() (*config.Config, error) {
+		return config.Load(path)
+	})
+
+	// reload writes the config file and reloads it
+	reload := func(content string) error {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return e.Reload()
+	}
+
+	if err := reload(scriptConfig("script:2", "  compiled:\n    enabled: false\n")); err != nil {
+		t.Fatalf("Reload() = %v", err)
+	}
+	script, exists := e.Language("script")
+	if !exists || script.Image != "script:2" {
+		t.Fatalf("script language after the reload = %+v, want image script:2", script)
+	}
+	if _, exists := e.Language("compiled"); exists {
+		t.Error("the compiled language is still configured after the reload")
+	}
+	if _, exists := e.Language("python"); !exists {
+		t.Error("the built-in python language is missing after the reload")
+	}
+
+	// New submissions run with the new configuration
+	id := submit(t, e, &models.CodeSubmission{Language: "script", Code: "echo", Input: "hello\n"})
+	if submission := waitFinished(t, e, id); submission.Status != "completed" {
+		t.Fatalf("status %q after the reload: %s", submission.Status, submission.Output)
+	}
+	// The reload also probes the versions of the built-in languages
+	var runs []Spec
+	for _, spec := range rt.Specs() {
+		if !spec.Probe {
+			runs = append(runs, spec)
+		}
+	}
+	if len(runs) != 1 || runs[0].Image != "script:2" || runs[0].Cmd[0] != "run2" {
+		t.Errorf("ran %+v, want run2 in script:2", runs)
+	}
+
+	// A configuration that fails validation leaves the current one in effect
+	before := e.Languages()
+	failures := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"config file", scriptConfig("script:3", "    bogus: [\n"), "failed to reload configuration"},
+		{"config validation", strings.Replace(scriptConfig("script:3", ""), "64m", "64mb", 1), `malformed memory size "64mb"`},
+		{"language validation", scriptConfig("script:3", "    sourceHook: nonexistent\n"), `unknown source hook "nonexistent"`},
+	}
+	for _, failure := range failures {
+		err := reload(failure.content)
+		if err == nil || !strings.Contains(err.Error(), failure.wantErr) {
+			t.Errorf("%s: Reload() = %v, want an error containing %q", failure.name, err, failure.wantErr)
+		}
+		if after := e.Languages(); !reflect.DeepEqual(after, before) {
+			t.Errorf("%s: languages changed by a failed reload", failure.name)
+		}
+	}
+}
+
+func TestReloadWithoutLoader(t *testing.T) {
+	e := newTestExecutor(t, NewFakeRuntime(), nil)
+	if err := e.Reload(); err == nil {
+		t.Error("Reload() without a config loader succeeded")
+	}
+	if languages := e.Languages(); !reflect.DeepEqual(languages, testLanguages()) {
+		t.Errorf("languages = %v, want the test languages", languages)
+	}
+}
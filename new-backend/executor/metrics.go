@@ -0,0 +1,29 @@
+package executor
+
+import (
+	"github.com/ishikabhoyar/monaco/new-backend/metrics"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// recordMetrics counts a finished submission, its run time and its timeouts
+func (e *CodeExecutor) recordMetrics(submission *models.CodeSubmission) {
+	language := e.languageLabel(submission.Language)
+
+	metrics.Submissions.WithLabelValues(language, submission.Status).Inc()
+	if submission.ExecutionTime > 0 {
+		metrics.RunDuration.WithLabelValues(language).Observe(submission.ExecutionTime)
+	}
+
+	timeouts := 0
+	if submission.Exit != nil && submission.Exit.TimedOut {
+		timeouts++
+	}
+	for _, result := range submission.TestResults {
+		if result.Exit != nil && result.Exit.TimedOut {
+			timeouts++
+		}
+	}
+	if timeouts > 0 {
+		metrics.Timeouts.WithLabelValues(language).Add(float64(timeouts))
+	}
+}
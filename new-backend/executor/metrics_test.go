@@ -0,0 +1,47 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/ishikabhoyar/monaco/new-backend/metrics"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestLanguageLabel(t *testing.T) {
+	e := newTestExecutor(t, NewFakeRuntime(), nil)
+
+	for name, want := range map[string]string{
+		"script":   "script",
+		"Script":   "script",
+		"SCRIPT":   "script",
+		"compiled": "compiled",
+		"cobol":    "unsupported",
+		"":         "unsupported",
+	} {
+		if got := e.languageLabel(name); got != want {
+			t.Errorf("languageLabel(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestMetricsUseConfiguredLanguage(t *testing.T) {
+	e := newTestExecutor(t, newEchoRuntime(), nil)
+	completed := metrics.Submissions.WithLabelValues("script", "completed")
+	before := testutil.ToFloat64(completed)
+	series := testutil.CollectAndCount(metrics.Submissions)
+
+	for _, language := range []string{"script", "Script", "SCRIPT"} {
+		submission := waitFinished(t, e, submit(t, e, &models.CodeSubmission{Language: language, Code: "x", Input: "x"}))
+		if submission.Status != "completed" {
+			t.Fatalf("%s: status = %q, want completed", language, submission.Status)
+		}
+	}
+
+	if got := testutil.ToFloat64(completed) - before; got != 3 {
+		t.Errorf("completed script submissions = %v, want 3", got)
+	}
+	if got := testutil.CollectAndCount(metrics.Submissions); got != series {
+		t.Errorf("submission series = %d, want %d: other spellings got their own labels", got, series)
+	}
+}
@@ -0,0 +1,187 @@
+package executor
+
+import (
+	"sync"
+
+	"github.com/ishikabhoyar/monaco/new-backend/metrics"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// priorityOrder lists the priority classes, served strictly in this order
+var priorityOrder = []models.Priority{models.PriorityHigh, models.PriorityNormal, models.PriorityLow}
+
+// jobQueue holds the submissions waiting for a worker. Higher priority
+// classes are always served first; within a class users take turns, so one
+// user queueing many submissions delays only their own. Unlike a channel it
+// can report positions and drop submissions that are cancelled while they wait.
+type jobQueue struct {
+	mutex    sync.Mutex
+	nonEmpty *sync.Cond
+	classes  map[models.Priority]*fairQueue
+	size     int
+	capacity int
+}
+
+// fairQueue is one priority class: a FIFO per user, served round-robin
+type fairQueue struct {
+	users map[string][]*models.CodeSubmission
+	turns []string // Users with waiting submissions, next to be served first
+}
+
+// newJobQueue creates a queue that holds at most capacity submissions
+func newJobQueue(capacity int) *jobQueue {
+	q := &jobQueue{
+		classes:  make(map[models.Priority]*fairQueue),
+		capacity: capacity,
+	}
+	for _, priority := range priorityOrder {
+		q.classes[priority] = &fairQueue{users: make(map[string][]*models.CodeSubmission)}
+	}
+	q.nonEmpty = sync.NewCond(&q.mutex)
+	return q
+}
+
+// push adds a submission behind the others of its user and priority,
+// reporting false if the queue is full
+func (q *jobQueue) push(submission *models.CodeSubmission) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.size >= q.capacity {
+		return false
+	}
+	q.class(submission.Priority).push(submission)
+	q.size++
+	metrics.QueueDepth.Set(float64(q.size))
+	q.nonEmpty.Signal()
+	return true
+}
+
+// pop removes and returns the next submission to run, waiting for one if the
+// queue is empty
+func (q *jobQueue) pop() *models.CodeSubmission {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for {
+		for _, priority := range priorityOrder {
+			if submission := q.classes[priority].pop(); submission != nil {
+				q.size--
+				metrics.QueueDepth.Set(float64(q.size))
+				return submission
+			}
+		}
+		q.nonEmpty.Wait()
+	}
+}
+
+// remove drops the submission with the given ID, reporting whether it was queued
+func (q *jobQueue) remove(id string) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	for _, class := range q.classes {
+		if class.remove(id) {
+			q.size--
+			metrics.QueueDepth.Set(float64(q.size))
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot returns the waiting submissions in the order they will be served
+// if nothing else is queued
+func (q *jobQueue) snapshot() []*models.CodeSubmission {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	order := make([]*models.CodeSubmission, 0, q.size)
+	for _, priority := range priorityOrder {
+		order = q.classes[priority].appendOrder(order)
+	}
+	return order
+}
+
+// len returns the number of waiting submissions
+func (q *jobQueue) len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.size
+}
+
+// class returns the queue for a priority, treating unknown ones as normal
+func (q *jobQueue) class(priority models.Priority) *fairQueue {
+	if class, exists := q.classes[priority]; exists {
+		return class
+	}
+	return q.classes[models.PriorityNormal]
+}
+
+func (f *fairQueue) push(submission *models.CodeSubmission) {
+	user := submission.UserID
+	if len(f.users[user]) == 0 {
+		f.turns = append(f.turns, user)
+	}
+	f.users[user] = append(f.users[user], submission)
+}
+
+// pop takes the oldest submission of the user whose turn it is and moves
+// that user to the back of the line
+func (f *fairQueue) pop() *models.CodeSubmission {
+	if len(f.turns) == 0 {
+		return nil
+	}
+	user := f.turns[0]
+	f.turns = f.turns[1:]
+
+	waiting := f.users[user]
+	submission := waiting[0]
+	if len(waiting) == 1 {
+		delete(f.users, user)
+	} else {
+		f.users[user] = waiting[1:]
+		f.turns = append(f.turns, user)
+	}
+	return submission
+}
+
+func (f *fairQueue) remove(id string) bool {
+	for user, waiting := range f.users {
+		for i, submission := range waiting {
+			if submission.ID != id {
+				continue
+			}
+			if len(waiting) > 1 {
+				f.users[user] = append(waiting[:i], waiting[i+1:]...)
+				return true
+			}
+			delete(f.users, user)
+			for t, u := range f.turns {
+				if u == user {
+					f.turns = append(f.turns[:t], f.turns[t+1:]...)
+					break
+				}
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// appendOrder appends the submissions in the order pop would return them:
+// the first of every user in turn, then the second of every user, and so on
+func (f *fairQueue) appendOrder(order []*models.CodeSubmission) []*models.CodeSubmission {
+	for round := 0; ; round++ {
+		served := false
+		for _, user := range f.turns {
+			if waiting := f.users[user]; round < len(waiting) {
+				order = append(order, waiting[round])
+				served = true
+			}
+		}
+		if !served {
+			return order
+		}
+	}
+}
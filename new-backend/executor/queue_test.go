@@ -0,0 +1,194 @@
+package executor
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// queued is a submission as the tests push it
+type queued struct {
+	id       string
+	user     string
+	priority models.Priority
+}
+
+func newQueueWith(t *testing.T, capacity int, submissions []queued) *jobQueue {
+	t.Helper()
+	q := newJobQueue(capacity)
+	for _, s := range submissions {
+		if !q.push(&models.CodeSubmission{ID: s.id, UserID: s.user, Priority: s.priority}) {
+			t.Fatalf("push(%s) rejected", s.id)
+		}
+	}
+	return q
+}
+
+// drain pops every waiting submission and returns their IDs in order
+func drain(q *jobQueue) []string {
+	var ids []string
+	for q.len() > 0 {
+		ids = append(ids, q.pop().ID)
+	}
+	return ids
+}
+
+func ids(submissions []*models.CodeSubmission) []string {
+	var ids []string
+	for _, submission := range submissions {
+		ids = append(ids, submission.ID)
+	}
+	return ids
+}
+
+func TestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		submissions []queued
+		want        []string
+	}{
+		{
+			name: "first in first out",
+			submissions: []queued{
+				{"a1", "alice", models.PriorityNormal},
+				{"a2", "alice", models.PriorityNormal},
+				{"a3", "alice", models.PriorityNormal},
+			},
+			want: []string{"a1", "a2", "a3"},
+		},
+		{
+			name: "priorities",
+			submissions: []queued{
+				{"low", "alice", models.PriorityLow},
+				{"normal", "alice", models.PriorityNormal},
+				{"high", "alice", models.PriorityHigh},
+				{"unset", "alice", ""},
+				{"unknown", "alice", "urgent"},
+			},
+			want: []string{"high", "normal", "unset", "unknown", "low"},
+		},
+		{
+			name: "users take turns",
+			submissions: []queued{
+				{"a1", "alice", models.PriorityNormal},
+				{"a2", "alice", models.PriorityNormal},
+				{"a3", "alice", models.PriorityNormal},
+				{"b1", "bob", models.PriorityNormal},
+				{"c1", "carol", models.PriorityNormal},
+				{"b2", "bob", models.PriorityNormal},
+			},
+			want: []string{"a1", "b1", "c1", "a2", "b2", "a3"},
+		},
+		{
+			name: "turns within each priority",
+			submissions: []queued{
+				{"a-low", "alice", models.PriorityLow},
+				{"a1", "alice", models.PriorityNormal},
+				{"a2", "alice", models.PriorityNormal},
+				{"b-low", "bob", models.PriorityLow},
+				{"b1", "bob", models.PriorityNormal},
+				{"c-high", "carol", models.PriorityHigh},
+			},
+			want: []string{"c-high", "a1", "b1", "a2", "a-low", "b-low"},
+		},
+		{
+			name: "anonymous submissions share a turn",
+			submissions: []queued{
+				{"anon1", "", models.PriorityNormal},
+				{"anon2", "", models.PriorityNormal},
+				{"a1", "alice", models.PriorityNormal},
+			},
+			want: []string{"anon1", "a1", "anon2"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := newQueueWith(t, 10, tt.submissions)
+			if got := ids(q.snapshot()); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("snapshot = %v, want %v", got, tt.want)
+			}
+			if got := drain(q); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pop order = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueFull(t *testing.T) {
+	q := newQueueWith(t, 2, []queued{
+		{"a1", "alice", models.PriorityLow},
+		{"b1", "bob", models.PriorityLow},
+	})
+
+	if q.push(&models.CodeSubmission{ID: "c1", UserID: "carol", Priority: models.PriorityHigh}) {
+		t.Fatal("push to a full queue succeeded")
+	}
+	if q.len() != 2 {
+		t.Fatalf("len = %d, want 2", q.len())
+	}
+
+	q.pop()
+	if !q.push(&models.CodeSubmission{ID: "c1", UserID: "carol", Priority: models.PriorityHigh}) {
+		t.Fatal("push after a pop was rejected")
+	}
+	if got, want := drain(q), []string{"c1", "b1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
+
+func TestQueueRemove(t *testing.T) {
+	q := newQueueWith(t, 10, []queued{
+		{"a1", "alice", models.PriorityNormal},
+		{"a2", "alice", models.PriorityNormal},
+		{"b1", "bob", models.PriorityNormal},
+		{"c1", "carol", models.PriorityHigh},
+		{"b2", "bob", models.PriorityNormal},
+	})
+
+	for _, id := range []string{"a2", "c1", "b1", "b2"} {
+		if !q.remove(id) {
+			t.Errorf("remove(%s) = false, want true", id)
+		}
+	}
+	if q.remove("b1") {
+		t.Error("removing a submission twice succeeded")
+	}
+	if q.remove("missing") {
+		t.Error("removing an unknown submission succeeded")
+	}
+	if q.len() != 1 {
+		t.Errorf("len = %d, want 1", q.len())
+	}
+
+	// Bob's turn is gone with his submissions, so he queues behind alice again
+	q.push(&models.CodeSubmission{ID: "b3", UserID: "bob"})
+	q.push(&models.CodeSubmission{ID: "a3", UserID: "alice"})
+	if got, want := drain(q), []string{"a1", "b3", "a3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("pop order = %v, want %v", got, want)
+	}
+}
+
+func TestQueuePopWaits(t *testing.T) {
+	q := newJobQueue(1)
+	popped := make(chan *models.CodeSubmission)
+	go func() { popped <- q.pop() }()
+
+	select {
+	case submission := <-popped:
+		t.Fatalf("pop on an empty queue returned %s", submission.ID)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	q.push(&models.CodeSubmission{ID: "a1", UserID: "alice"})
+	select {
+	case submission := <-popped:
+		if submission.ID != "a1" {
+			t.Errorf("pop = %s, want a1", submission.ID)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pop did not wake up after a push")
+	}
+}
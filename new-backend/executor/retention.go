@@ -0,0 +1,147 @@
+package executor
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// tempDirPrefix starts the name of every temporary directory the executor
+// creates, so ones left behind by a crash can be recognized
+const tempDirPrefix = "monaco-"
+
+// orphanAge is how old a temporary directory must be before it is considered
+// abandoned. It is far longer than any run, so directories still in use by
+// this or another server on the same host are left alone.
+const orphanAge = time.Hour
+
+// sweep enforces the retention policy and removes abandoned temporary
+// directories, once at startup and then periodically
+func (e *CodeExecutor) sweep() {
+	ticker := time.NewTicker(e.config.Store.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		now := time.Now()
+		e.enforceRetention(now)
+		removeOrphanedTempDirs(os.TempDir(), now.Add(-orphanAge))
+		<-ticker.C
+	}
+}
+
+// retained is what the retention policy needs to know about a submission
+type retained struct {
+	id          string
+	finished    bool
+	completedAt time.Time
+	outputBytes int64
+}
+
+// enforceRetention deletes finished submissions that are older than the
+// configured maximum age at now, then the oldest finished ones until the
+// store is within the count and output limits
+func (e *CodeExecutor) enforceRetention(now time.Time) {
+	policy := e.config.Store
+	var maxOutput int64
+	if policy.MaxOutput != "" && policy.MaxOutput != "0" {
+		maxOutput, _ = config.ParseMemory(policy.MaxOutput)
+	}
+
+	var all []retained
+	err := e.store.ForEach(func(submission *models.CodeSubmission) error {
+		all = append(all, retained{
+			id:          submission.ID,
+			finished:    isFinished(submission.Status),
+			completedAt: submission.CompletedAt,
+			outputBytes: outputSize(submission),
+		})
+		return nil
+	})
+	if err != nil {
+		slog.Error("retention: failed to scan submission store", logging.Err(err))
+		return
+	}
+
+	// Oldest first, so the loop below deletes in order of age
+	sort.Slice(all, func(i, j int) bool { return all[i].completedAt.Before(all[j].completedAt) })
+
+	count := len(all)
+	var totalOutput int64
+	for _, r := range all {
+		totalOutput += r.outputBytes
+	}
+
+	deleted := 0
+	for _, r := range all {
+		if !r.finished {
+			continue
+		}
+		expired := policy.MaxAge > 0 && now.Sub(r.completedAt) > policy.MaxAge
+		overCount := policy.MaxCount > 0 && count > policy.MaxCount
+		overOutput := maxOutput > 0 && totalOutput > maxOutput
+		if !expired && !overCount && !overOutput {
+			// Everything after this is newer, so nothing else needs to go
+			break
+		}
+
+		if err := e.store.Delete(r.id); err != nil {
+			slog.Error("retention: failed to delete submission", "submission", r.id, logging.Err(err))
+			continue
+		}
+		count--
+		totalOutput -= r.outputBytes
+		deleted++
+	}
+
+	if deleted > 0 {
+		slog.Info("retention: deleted submissions", "deleted", deleted, "kept", count, "outputBytes", totalOutput)
+	}
+}
+
+// isFinished reports whether a submission will not change any more
+func isFinished(status string) bool {
+	return status == "completed" || status == "failed" || status == "cancelled"
+}
+
+// outputSize returns how many bytes of output a submission stores
+func outputSize(submission *models.CodeSubmission) int64 {
+	size := int64(len(submission.Output))
+	for _, result := range submission.TestResults {
+		size += int64(len(result.Output) + len(result.Error) + len(result.CheckerOutput))
+	}
+	return size
+}
+
+// removeOrphanedTempDirs deletes temporary directories in dir created by the
+// executor that were last modified before cutoff
+func removeOrphanedTempDirs(dir string, cutoff time.Time) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		slog.Error("failed to list temporary directory", "dir", dir, logging.Err(err))
+		return
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), tempDirPrefix) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(cutoff) {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if err := os.RemoveAll(path); err != nil {
+			slog.Error("failed to remove orphaned directory", "dir", path, logging.Err(err))
+			continue
+		}
+		slog.Info("removed orphaned directory", "dir", path)
+	}
+}
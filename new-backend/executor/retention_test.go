@@ -0,0 +1,185 @@
+package executor
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"github.com/ishikabhoyar/monaco/new-backend/store"
+)
+
+func TestEnforceRetention(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	// stored is a submission in the store before the sweep
+	type stored struct {
+		id     string
+		status string
+		age    time.Duration // Since it completed
+		output int           // Bytes of output
+	}
+	finished := func(id string, age time.Duration) stored { return stored{id, "completed", age, 0} }
+
+	tests := []struct {
+		name        string
+		policy      config.StoreConfig
+		submissions []stored
+		wantKept    []string
+	}{
+		{
+			name:        "no limits",
+			submissions: []stored{finished("a", 1000*time.Hour), finished("b", time.Hour)},
+			wantKept:    []string{"a", "b"},
+		},
+		{
+			name:   "max age",
+			policy: config.StoreConfig{MaxAge: 24 * time.Hour},
+			submissions: []stored{
+				finished("expired", 25*time.Hour),
+				{"failed", "failed", 48 * time.Hour, 0},
+				{"cancelled", "cancelled", 30 * time.Hour, 0},
+				finished("recent", 23*time.Hour),
+				{"running", "running", 0, 0},
+				{"queued", "queued", 0, 0},
+			},
+			wantKept: []string{"queued", "recent", "running"},
+		},
+		{
+			name:   "max count deletes the oldest",
+			policy: config.StoreConfig{MaxCount: 2},
+			submissions: []stored{
+				finished("newest", time.Minute),
+				finished("oldest", 3*time.Hour),
+				finished("older", 2*time.Hour),
+				finished("newer", time.Hour),
+			},
+			wantKept: []string{"newer", "newest"},
+		},
+		{
+			name:   "max count keeps unfinished submissions",
+			policy: config.StoreConfig{MaxCount: 2},
+			submissions: []stored{
+				{"queued", "queued", 0, 0},
+				{"running", "running", 0, 0},
+				{"queued too", "queued", 0, 0},
+				finished("done", time.Minute),
+			},
+			wantKept: []string{"queued", "queued too", "running"},
+		},
+		{
+			name:   "max output",
+			policy: config.StoreConfig{MaxOutput: "1k"},
+			submissions: []stored{
+				{"old", "completed", 3 * time.Hour, 600},
+				{"middle", "completed", 2 * time.Hour, 600},
+				{"new", "completed", time.Hour, 300},
+			},
+			wantKept: []string{"middle", "new"},
+		},
+		{
+			name:   "age and count",
+			policy: config.StoreConfig{MaxAge: 24 * time.Hour, MaxCount: 2},
+			submissions: []stored{
+				finished("expired", 48*time.Hour),
+				finished("a", 3*time.Hour),
+				finished("b", 2*time.Hour),
+				finished("c", time.Hour),
+			},
+			wantKept: []string{"b", "c"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := store.NewMemoryStore(0)
+			defer st.Close()
+			e := &CodeExecutor{config: &config.Config{Store: tt.policy}, store: st}
+
+			for _, s := range tt.submissions {
+				submission := &models.CodeSubmission{ID: s.id, Status: s.status, Output: strings.Repeat("x", s.output)}
+				if isFinished(s.status) {
+					submission.CompletedAt = now.Add(-s.age)
+				}
+				st.Save(submission)
+			}
+
+			e.enforceRetention(now)
+
+			var kept []string
+			st.ForEach(func(submission *models.CodeSubmission) error {
+				kept = append(kept, submission.ID)
+				return nil
+			})
+			sort.Strings(kept)
+			if !reflect.DeepEqual(kept, tt.wantKept) {
+				t.Errorf("kept %v, want %v", kept, tt.wantKept)
+			}
+		})
+	}
+}
+
+func TestOutputSize(t *testing.T) {
+	submission := &models.CodeSubmission{
+		Output: "12345",
+		TestResults: []models.TestCaseResult{
+			{Output: "12", Error: "3"},
+			{CheckerOutput: "1234"},
+		},
+	}
+	if got := outputSize(submission); got != 12 {
+		t.Errorf("outputSize = %d, want 12", got)
+	}
+}
+
+func TestRemoveOrphanedTempDirs(t *testing.T) {
+	now := time.Now()
+	dir := t.TempDir()
+
+	// create makes a directory, or a file if dir is false, last modified age ago
+	create := func(name string, isDir bool, age time.Duration) {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		var err error
+		if isDir {
+			err = os.MkdirAll(filepath.Join(path, "nested"), 0755)
+		} else {
+			err = os.WriteFile(path, []byte("x"), 0644)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	create(tempDirPrefix+"script-code-old", true, 2*orphanAge)
+	create(tempDirPrefix+"checker-code-old", true, orphanAge+time.Minute)
+	create(tempDirPrefix+"script-code-running", true, time.Minute)
+	create("other-old", true, 2*orphanAge)
+	create(tempDirPrefix+"file", false, 2*orphanAge)
+
+	removeOrphanedTempDirs(dir, now.Add(-orphanAge))
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var left []string
+	for _, entry := range entries {
+		left = append(left, entry.Name())
+	}
+	want := []string{tempDirPrefix + "file", tempDirPrefix + "script-code-running", "other-old"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(left, want) {
+		t.Errorf("left %v, want %v", left, want)
+	}
+
+	// A missing directory is logged, not fatal
+	removeOrphanedTempDirs(filepath.Join(dir, "missing"), now)
+}
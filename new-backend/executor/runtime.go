@@ -0,0 +1,89 @@
+package executor
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// SandboxDir is where a submission's working directory is mounted inside the sandbox
+const SandboxDir = "/code"
+
+// Limits holds the resource limits applied to a sandboxed process.
+// Zero values mean "no limit".
+type Limits struct {
+	Memory          string  // Memory limit in Docker notation, e.g. "100m"
+	MemorySwap      string  // Memory+swap limit in Docker notation
+	CPUs            float64 // Fraction of a single CPU, e.g. 0.5
+	PidsLimit       int64
+	NetworkDisabled bool
+}
+
+// Spec describes a single process to start inside a sandbox
+type Spec struct {
+	Image    string
+	Cmd      []string
+	Dir      string // Host directory mounted at SandboxDir
+	ReadOnly bool   // Mount Dir read-only
+	WorkDir  string // Working directory inside the sandbox
+	Env      []string
+	Limits   Limits
+	Probe    bool // A toolchain version probe rather than a compile step, for metrics
+}
+
+// ExitStatus describes how a sandboxed process ended
+type ExitStatus struct {
+	ExitCode  int
+	Signal    int  // Signal that terminated the process, 0 if it exited by itself
+	OOMKilled bool // The sandbox ran out of memory
+	Usage     Usage
+}
+
+// signalExitBase is added to the number of the signal that killed a process
+// to form its exit code, following the shell convention Docker reports with
+const signalExitBase = 128
+
+// exitStatus returns the status for a process that ended with code, telling
+// a death by signal from a normal exit
+func exitStatus(code int) ExitStatus {
+	status := ExitStatus{ExitCode: code}
+	if code > signalExitBase && code < signalExitBase+65 {
+		status.Signal = code - signalExitBase
+	}
+	return status
+}
+
+// Usage is what a sandboxed process consumed. Zero fields were not measured.
+type Usage struct {
+	PeakMemory int64         // Peak memory of the sandbox in bytes
+	CPUTime    time.Duration // User plus system CPU time
+	WallTime   time.Duration // From process start to exit, without sandbox setup
+}
+
+// Process is a sandboxed process started by a Runtime
+type Process interface {
+	// Stdin returns the writer connected to the process's standard input
+	Stdin() io.WriteCloser
+	// Stdout returns the reader connected to the process's standard output
+	Stdout() io.Reader
+	// Stderr returns the reader connected to the process's standard error
+	Stderr() io.Reader
+	// Wait blocks until the process exits. A non-zero exit code is reported in
+	// the ExitStatus; the error is only set if the outcome could not be determined.
+	Wait() (ExitStatus, error)
+	// Kill terminates the process and its sandbox
+	Kill() error
+}
+
+// Runtime abstracts the sandbox used to compile and run submissions
+type Runtime interface {
+	// Compile runs spec to completion and returns its combined output
+	Compile(ctx context.Context, spec Spec) ([]byte, error)
+	// Run starts spec with its standard streams attached and returns without
+	// waiting for it to finish. The process is killed when ctx is done.
+	Run(ctx context.Context, spec Spec) (Process, error)
+	// Ping checks that the sandbox backend is reachable and returns its version
+	Ping(ctx context.Context) (string, error)
+	// ImageExists reports whether image is available without pulling it
+	ImageExists(ctx context.Context, image string) (bool, error)
+}
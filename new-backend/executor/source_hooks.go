@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+// SourceHook prepares submitted code before it is written to the sandbox.
+// It returns the code to write and may add placeholders to vars for use in
+// the language's SourceFile, CompileCmd and RunCmd templates.
+type SourceHook func(code string, vars map[string]string) string
+
+// registeredHook is a source hook and the placeholders it adds to vars
+type registeredHook struct {
+	prepare      SourceHook
+	placeholders []string
+}
+
+// sourceHooks maps LanguageConfig.SourceHook names to their implementation
+var sourceHooks = map[string]registeredHook{
+	"c-unbuffered-main": {prepare: wrapCMain},
+	"java-class-name":   {prepare: javaClassName, placeholders: []string{"class"}},
+}
+
+// ValidateLanguages checks that every language only refers to registered
+// source hooks and only uses placeholders that its hook defines
+func ValidateLanguages(languages map[string]config.LanguageConfig) error {
+	keys := make([]string, 0, len(languages))
+	for key := range languages {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs []string
+	for _, key := range keys {
+		language := languages[key]
+		if language.SourceHook == "" {
+			continue
+		}
+		hook, exists := sourceHooks[language.SourceHook]
+		if !exists {
+			errs = append(errs, fmt.Sprintf("languages.%s.sourceHook: unknown source hook %q", key, language.SourceHook))
+			continue
+		}
+		for _, err := range language.CheckPlaceholders(hook.placeholders) {
+			errs = append(errs, fmt.Sprintf("languages.%s.%s", key, err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(errs, "\n  "))
+	}
+	return nil
+}
+
+// cMainRegex matches the opening of a C main function
+var cMainRegex = regexp.MustCompile(`int\s+main\s*\([^)]*\)\s*{`)
+
+// wrapCMain renames the user's main to user_main and calls it from a wrapper
+// that disables stdout buffering, so output reaches the terminal immediately
+func wrapCMain(code string, vars map[string]string) string {
+	// Create a wrapper that will include setbuf to disable buffering
+	wrapperCode := `#include <stdio.h>
+
+// Forward declaration of user's main function
+int user_main();
+
+int main() {
+    // Disable buffering completely for stdout
+    setbuf(stdout, NULL);
+
+    // Call the user's code
+    return user_main();
+}
+
+// User's code begins here
+`
+
+	if cMainRegex.MatchString(code) {
+		// Rename user's main to user_main and combine with the wrapper
+		return wrapperCode + cMainRegex.ReplaceAllString(code, "int user_main() {")
+	}
+
+	// If no main function found, create a minimal program that includes the user code
+	return `#include <stdio.h>
+
+int main() {
+    // Disable buffering completely for stdout
+    setbuf(stdout, NULL);
+
+    // Execute the user's code
+    ` + code + `
+
+    return 0;
+}
+`
+}
+
+// javaClassName exposes the submission's main class as the {class} placeholder
+func javaClassName(code string, vars map[string]string) string {
+	vars["class"] = extractJavaClassName(code)
+	return code
+}
+
+// Helper function to extract Java class name
+func extractJavaClassName(code string) string {
+	// Default class name as fallback
+	defaultClass := "Solution"
+
+	// Look for public class
+	re := regexp.MustCompile(`public\s+class\s+(\w+)`)
+	matches := re.FindStringSubmatch(code)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+
+	// Look for any class if no public class
+	re = regexp.MustCompile(`class\s+(\w+)`)
+	matches = re.FindStringSubmatch(code)
+	if len(matches) > 1 {
+		return matches[1]
+	}
+
+	return defaultClass
+}
@@ -0,0 +1,54 @@
+package executor
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+func TestValidateLanguages(t *testing.T) {
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ValidateLanguages(cfg.Languages); err != nil {
+		t.Fatalf("built-in languages: %v", err)
+	}
+
+	java := cfg.Languages["java"]
+	tests := []struct {
+		name    string
+		edit    func(l *config.LanguageConfig)
+		wantErr string // Empty if the language is valid
+	}{
+		{"hook placeholder", func(l *config.LanguageConfig) {}, ""},
+		{"no hook", func(l *config.LanguageConfig) {
+			l.SourceHook = ""
+			l.SourceFile = "Main.java"
+			l.RunCmd = []string{"java", "Main"}
+		}, ""},
+		{"unknown hook", func(l *config.LanguageConfig) { l.SourceHook = "kotlin-main" },
+			`languages.java.sourceHook: unknown source hook "kotlin-main"`},
+		{"typo", func(l *config.LanguageConfig) { l.RunCmd = []string{"java", "-cp", "{dir}", "{clas}"} },
+			`languages.java.runCmd: unknown placeholder {clas} in "{clas}"`},
+		{"placeholder of another hook", func(l *config.LanguageConfig) { l.SourceHook = "c-unbuffered-main" },
+			`languages.java.sourceFile: unknown placeholder {class} in "{class}.java"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			language := java
+			language.RunCmd = append([]string(nil), java.RunCmd...)
+			tt.edit(&language)
+
+			err := ValidateLanguages(map[string]config.LanguageConfig{"java": language})
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("ValidateLanguages() = %v, want nil", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("ValidateLanguages() = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
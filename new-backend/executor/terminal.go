@@ -0,0 +1,31 @@
+package executor
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// terminalWriteTimeout bounds a single write, so a client that stopped
+// reading cannot hold up the workers sending to it
+const terminalWriteTimeout = 10 * time.Second
+
+// terminal is a WebSocket connection watching a submission. Messages come
+// from workers, HTTP handlers and the queue broadcaster alike, but a
+// websocket.Conn supports only one writer at a time, so all writes go
+// through send.
+type terminal struct {
+	conn  *websocket.Conn
+	mutex sync.Mutex // Serializes writes
+}
+
+// send writes message to the connection, waiting for any write in progress
+func (t *terminal) send(message models.WebSocketMessage) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.conn.SetWriteDeadline(time.Now().Add(terminalWriteTimeout))
+	return t.conn.WriteJSON(message)
+}
@@ -0,0 +1,154 @@
+package executor
+
+import (
+	"archive/tar"
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// usageFile is where usageScript leaves the usage report in the container.
+// It is copied out once the container has stopped, so no host directory is
+// shared with the program.
+const usageFile = "/tmp/monaco-usage"
+
+// maxUsageReport bounds how much of a usage report is read
+const maxUsageReport = 64 << 10
+
+// usageScript runs the command given as its arguments and then writes the
+// container's cgroup accounting to usageFile. The cgroup lives only as long
+// as the container runs, so it has to be read from inside. The program must
+// not be able to forge the report: every other process in the container is
+// killed and waited for first, the report only replaces a regular file, and
+// it is written with shell builtins alone in case the program replaced the
+// image's tools. Both the cgroup v2 files and their v1 equivalents are tried.
+const usageScript = `"$@"
+status=$?
+{
+	kill -9 -1
+	others() {
+		for p in /proc/[0-9]*; do
+			[ "$p" = "/proc/$$" ] && continue
+			while read -r key state _; do
+				if [ "$key" = State: ]; then
+					[ "$state" = Z ] || return 0
+					break
+				fi
+			done <"$p/status"
+		done
+		return 1
+	}
+	while others; do :; done
+	if [ ! -L ` + usageFile + ` ] && { [ ! -e ` + usageFile + ` ] || [ -f ` + usageFile + ` ]; } && cd /sys/fs/cgroup; then
+		for f in memory.peak cpu.stat memory/memory.max_usage_in_bytes cpuacct/cpuacct.stat; do
+			[ -r "$f" ] || continue
+			echo "# $f"
+			while IFS= read -r line; do echo "$line"; done <"$f"
+		done >` + usageFile + `
+	fi
+} 2>/dev/null
+exit $status`
+
+// userHZ is the unit of the cgroup v1 cpuacct.stat counters
+const userHZ = 100
+
+// measureCmd wraps cmd so that its resource usage is reported
+func measureCmd(cmd []string) []string {
+	return append([]string{"sh", "-c", usageScript, "sh"}, cmd...)
+}
+
+// usageFromArchive extracts the report written by usageScript from the tar
+// archive `docker cp` makes of usageFile. Anything but a regular file is
+// ignored, so a link the program left in its place is never followed.
+func usageFromArchive(archive io.Reader) Usage {
+	files := tar.NewReader(archive)
+	header, err := files.Next()
+	if err != nil || header.Typeflag != tar.TypeReg {
+		return Usage{}
+	}
+	return readUsage(io.LimitReader(files, maxUsageReport))
+}
+
+// readUsage parses a report written by usageScript. A missing, partial or
+// malformed report leaves the corresponding fields zero.
+func readUsage(report io.Reader) Usage {
+	var usage Usage
+
+	var section string
+	var v1User, v1System int64
+	scanner := bufio.NewScanner(report)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "# ") {
+			section = strings.TrimPrefix(line, "# ")
+			continue
+		}
+
+		fields := strings.Fields(line)
+		switch section {
+		case "memory.peak", "memory/memory.max_usage_in_bytes":
+			if len(fields) == 1 {
+				usage.PeakMemory, _ = strconv.ParseInt(fields[0], 10, 64)
+			}
+		case "cpu.stat":
+			if len(fields) == 2 && (fields[0] == "user_usec" || fields[0] == "system_usec") {
+				usec, _ := strconv.ParseInt(fields[1], 10, 64)
+				usage.CPUTime += time.Duration(usec) * time.Microsecond
+			}
+		case "cpuacct/cpuacct.stat":
+			if len(fields) == 2 {
+				ticks, _ := strconv.ParseInt(fields[1], 10, 64)
+				switch fields[0] {
+				case "user":
+					v1User = ticks
+				case "system":
+					v1System = ticks
+				}
+			}
+		}
+	}
+
+	if usage.CPUTime == 0 && v1User+v1System > 0 {
+		usage.CPUTime = time.Duration(v1User+v1System) * time.Second / userHZ
+	}
+	return usage
+}
+
+// wallTime returns the wall time measured by the runtime, or elapsed, the
+// time seen from outside the sandbox, if the runtime did not measure it
+func wallTime(usage Usage, elapsed time.Duration) time.Duration {
+	if usage.WallTime > 0 {
+		return usage.WallTime
+	}
+	return elapsed
+}
+
+// overTimeLimit reports whether a run went over its time limit: it was killed
+// at its deadline, or the wall or CPU time measured inside the sandbox is
+// above the limit. Sandbox startup only counts if the runtime did not measure
+// the wall time itself.
+func overTimeLimit(usage Usage, elapsed, limit time.Duration, killed bool) bool {
+	return killed || wallTime(usage, elapsed) > limit || usage.CPUTime > limit
+}
+
+// recordUsage stores what a test run consumed in its result
+func recordUsage(result *models.TestCaseResult, usage Usage, elapsed time.Duration) {
+	result.ExecutionTime = wallTime(usage, elapsed).Seconds()
+	result.CPUTime = usage.CPUTime.Seconds()
+	result.PeakMemory = usage.PeakMemory
+}
+
+// describeUsage fills in the human readable usage fields of a submission
+func describeUsage(submission *models.CodeSubmission) {
+	if submission.PeakMemory > 0 {
+		submission.Memory = fmt.Sprintf("%.1f MB", float64(submission.PeakMemory)/(1<<20))
+	}
+	if submission.CPUTime > 0 {
+		submission.CPU = fmt.Sprintf("%.3fs", submission.CPUTime)
+	}
+}
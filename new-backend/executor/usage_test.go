@@ -0,0 +1,85 @@
+package executor
+
+import (
+	"archive/tar"
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		report string
+		want   Usage
+	}{
+		{"cgroup v2", "# memory.peak\n1048576\n# cpu.stat\nusage_usec 900\nuser_usec 600\nsystem_usec 300\nnr_periods 0\n",
+			Usage{PeakMemory: 1 << 20, CPUTime: 900 * time.Microsecond}},
+		{"cgroup v1", "# memory/memory.max_usage_in_bytes\n2048\n# cpuacct/cpuacct.stat\nuser 30\nsystem 20\n",
+			Usage{PeakMemory: 2048, CPUTime: 500 * time.Millisecond}},
+		{"cgroup v2 CPU time wins over v1", "# cpu.stat\nuser_usec 1000\n# cpuacct/cpuacct.stat\nuser 100\n",
+			Usage{CPUTime: time.Millisecond}},
+		{"missing", "", Usage{}},
+		{"no memory file", "# cpu.stat\nuser_usec 1000\n", Usage{CPUTime: time.Millisecond}},
+		{"truncated", "# memory.peak\n", Usage{}},
+		{"no section", "1048576\nuser_usec 600\n", Usage{}},
+		{"unknown section", "# memory.current\n1048576\n", Usage{}},
+		{"malformed numbers", "# memory.peak\nlots\n# cpu.stat\nuser_usec soon\nsystem_usec 300\n",
+			Usage{CPUTime: 300 * time.Microsecond}},
+		{"extra fields", "# memory.peak\n1024 bytes\n# cpuacct/cpuacct.stat\nuser 1 2\n", Usage{}},
+		{"binary", "\x00\xff# memory.peak\n\x00", Usage{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := readUsage(strings.NewReader(tt.report)); got != tt.want {
+				t.Errorf("readUsage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUsageFromArchive(t *testing.T) {
+	// archive returns a tar archive holding one entry, as `docker cp` makes
+	archive := func(t *testing.T, header tar.Header, content string) *bytes.Buffer {
+		t.Helper()
+		var buf bytes.Buffer
+		w := tar.NewWriter(&buf)
+		header.Name = "monaco-usage"
+		header.Size = int64(len(content))
+		if err := w.WriteHeader(&header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		return &buf
+	}
+	report := "# memory.peak\n4096\n"
+
+	if got := usageFromArchive(archive(t, tar.Header{Typeflag: tar.TypeReg, Mode: 0644}, report)); got.PeakMemory != 4096 {
+		t.Errorf("regular file: peak memory = %d, want 4096", got.PeakMemory)
+	}
+	if got := usageFromArchive(archive(t, tar.Header{Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}, "")); got != (Usage{}) {
+		t.Errorf("symlink: usage = %+v, want none", got)
+	}
+	if got := usageFromArchive(archive(t, tar.Header{Typeflag: tar.TypeDir, Mode: 0755}, "")); got != (Usage{}) {
+		t.Errorf("directory: usage = %+v, want none", got)
+	}
+	if got := usageFromArchive(strings.NewReader("")); got != (Usage{}) {
+		t.Errorf("empty archive: usage = %+v, want none", got)
+	}
+	if got := usageFromArchive(strings.NewReader("not a tar archive")); got != (Usage{}) {
+		t.Errorf("malformed archive: usage = %+v, want none", got)
+	}
+
+	// Only the first maxUsageReport bytes are read
+	padded := strings.Repeat("\n", maxUsageReport) + report
+	if got := usageFromArchive(archive(t, tar.Header{Typeflag: tar.TypeReg, Mode: 0644}, padded)); got != (Usage{}) {
+		t.Errorf("oversized report: usage = %+v, want none", got)
+	}
+}
@@ -0,0 +1,179 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// versionProbeTimeout bounds a single version probe. Docker pulls a missing
+// image before running it, so this is generous.
+const versionProbeTimeout = 5 * time.Minute
+
+// maxVersionLength caps the version string taken from a probe's output
+const maxVersionLength = 100
+
+// versionCache holds the toolchain versions reported by each language's
+// VersionCmd, keyed by versionKey so a reloaded language with a different
+// image or command is not shown a stale version
+type versionCache struct {
+	mutex        sync.RWMutex
+	versions     map[string]string
+	refreshMutex sync.Mutex // Guards refreshing and pending
+	refreshing   bool       // A refresh is probing
+	pending      bool       // Another refresh was requested meanwhile
+}
+
+func newVersionCache() *versionCache {
+	return &versionCache{versions: make(map[string]string)}
+}
+
+// versionKey identifies what a version was probed with
+func versionKey(langConfig config.LanguageConfig) string {
+	return langConfig.Image + "\x00" + strings.Join(langConfig.VersionCmd, "\x00")
+}
+
+// get returns the probed version of a language, or "" if it is not known
+func (c *versionCache) get(langConfig config.LanguageConfig) string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.versions[versionKey(langConfig)]
+}
+
+// replace swaps in a new set of versions
+func (c *versionCache) replace(versions map[string]string) {
+	c.mutex.Lock()
+	c.versions = versions
+	c.mutex.Unlock()
+}
+
+// startRefresh reports whether the caller should refresh, or whether a
+// refresh is already running and has been asked to go once more
+func (c *versionCache) startRefresh() bool {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	if c.refreshing {
+		c.pending = true
+		return false
+	}
+	c.refreshing = true
+	return true
+}
+
+// finishRefresh reports whether another refresh was requested while the
+// last one was running
+func (c *versionCache) finishRefresh() bool {
+	c.refreshMutex.Lock()
+	defer c.refreshMutex.Unlock()
+
+	if c.pending {
+		c.pending = false
+		return true
+	}
+	c.refreshing = false
+	return false
+}
+
+// refreshVersions runs the VersionCmd of every configured language in its
+// image and replaces the cached versions with the results. Languages without
+// a VersionCmd, and those whose probe fails, have no version. At most one
+// refresh probes at a time; requests made meanwhile are coalesced into a
+// single further refresh, which sees the latest languages.
+func (e *CodeExecutor) refreshVersions() {
+	if !e.versions.startRefresh() {
+		return
+	}
+	for {
+		e.probeVersions()
+		if !e.versions.finishRefresh() {
+			return
+		}
+	}
+}
+
+// probeVersions probes every configured language once
+func (e *CodeExecutor) probeVersions() {
+	languages := e.Languages()
+	versions := make(map[string]string, len(languages))
+	var mutex sync.Mutex
+	var probes sync.WaitGroup
+	for key, langConfig := range languages {
+		if len(langConfig.VersionCmd) == 0 {
+			continue
+		}
+		probes.Add(1)
+		go func(key string, langConfig config.LanguageConfig) {
+			defer probes.Done()
+			version, err := e.probeVersion(langConfig)
+			if err != nil {
+				slog.Warn("language version probe failed", "language", key, "image", langConfig.Image, logging.Err(err))
+				return
+			}
+			mutex.Lock()
+			versions[versionKey(langConfig)] = version
+			mutex.Unlock()
+		}(key, langConfig)
+	}
+	probes.Wait()
+
+	e.versions.replace(versions)
+	slog.Info("probed language versions", "languages", len(versions))
+}
+
+// probeVersion runs a language's VersionCmd and returns the first line it prints
+func (e *CodeExecutor) probeVersion(langConfig config.LanguageConfig) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), versionProbeTimeout)
+	defer cancel()
+
+	output, err := e.runtime.Compile(ctx, Spec{
+		Image:  langConfig.Image,
+		Cmd:    langConfig.VersionCmd,
+		Limits: e.compileLimits(langConfig),
+		Probe:  true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+
+	// Compilers print a banner; the first line names the version
+	for _, line := range strings.Split(string(output), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			if len(line) > maxVersionLength {
+				line = line[:maxVersionLength]
+			}
+			return line, nil
+		}
+	}
+	return "", errors.New("no output")
+}
+
+// LanguageInfos describes the configured languages for clients, sorted by ID
+func (e *CodeExecutor) LanguageInfos() []models.LanguageInfo {
+	languages := e.Languages()
+	infos := make([]models.LanguageInfo, 0, len(languages))
+	for id, langConfig := range languages {
+		infos = append(infos, models.LanguageInfo{
+			ID:            id,
+			Name:          langConfig.Name,
+			Version:       e.versions.get(langConfig),
+			Image:         langConfig.Image,
+			FileExtension: langConfig.FileExt,
+			Compiled:      len(langConfig.CompileCmd) > 0,
+			MemoryLimit:   langConfig.MemoryLimit,
+			CPULimit:      langConfig.CPULimit,
+			TimeoutSec:    langConfig.TimeoutSec,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].ID < infos[j].ID })
+	return infos
+}
@@ -0,0 +1,226 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+)
+
+func TestProbeVersion(t *testing.T) {
+	tests := []struct {
+		name        string
+		output      string
+		err         error
+		wantVersion string
+		wantErr     string // Empty if the probe succeeds
+	}{
+		{name: "first line", output: "gcc (GCC) 13.2.0\nCopyright (C) 2023\n", wantVersion: "gcc (GCC) 13.2.0"},
+		{name: "blank lines first", output: "\n  \n  Python 3.12.1  \n", wantVersion: "Python 3.12.1"},
+		{name: "long line", output: strings.Repeat("v", 2*maxVersionLength), wantVersion: strings.Repeat("v", maxVersionLength)},
+		{name: "no output", output: " \n\n", wantErr: "no output"},
+		{name: "failure", output: "exec: java: not found\n", err: errors.New("exit status 127"), wantErr: "exit status 127: exec: java: not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := NewFakeRuntime()
+			rt.CompileFunc = func(ctx context.Context, spec Spec) ([]byte, error) {
+				return []byte(tt.output), tt.err
+			}
+			e := newTestExecutor(t, rt, nil)
+			langConfig := config.LanguageConfig{Image: "probe:latest", MemoryLimit: "64m", CPULimit: "0.5", VersionCmd: []string{"probe", "--version"}}
+
+			version, err := e.probeVersion(langConfig)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Fatalf("probeVersion() failed: %v", err)
+			case tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr):
+				t.Fatalf("probeVersion() = %q, %v; want error %q", version, err, tt.wantErr)
+			}
+			if version != tt.wantVersion {
+				t.Errorf("version = %q, want %q", version, tt.wantVersion)
+			}
+
+			specs := rt.Specs()
+			if len(specs) != 1 {
+				t.Fatalf("%d commands ran, want 1", len(specs))
+			}
+			if spec := specs[0]; !spec.Probe || spec.Image != "probe:latest" || !reflect.DeepEqual(spec.Cmd, langConfig.VersionCmd) {
+				t.Errorf("probe ran %v in %s (probe %v)", spec.Cmd, spec.Image, spec.Probe)
+			}
+		})
+	}
+}
+
+// versionProbes answers version probes by image in its compile method. Probes of
+// images in blocked wait until they are unblocked.
+type versionProbes struct {
+	mutex    sync.Mutex
+	versions map[string]string // Output by image; other images fail
+	calls    map[string]int    // Probes by image
+	blocked  map[string]chan struct{}
+}
+
+func newVersionProbes(versions map[string]string) *versionProbes {
+	return &versionProbes{versions: versions, calls: make(map[string]int), blocked: make(map[string]chan struct{})}
+}
+
+func (p *versionProbes) compile(ctx context.Context, spec Spec) ([]byte, error) {
+	p.mutex.Lock()
+	p.calls[spec.Image]++
+	version, exists := p.versions[spec.Image]
+	blocked := p.blocked[spec.Image]
+	p.mutex.Unlock()
+
+	if blocked != nil {
+		<-blocked
+	}
+	if !exists {
+		return []byte("Unable to find image"), errors.New("exit status 125")
+	}
+	return []byte(version + "\n"), nil
+}
+
+// block makes probes of image wait until the returned function is called
+func (p *versionProbes) block(image string) func() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	release := make(chan struct{})
+	p.blocked[image] = release
+	return func() { close(release) }
+}
+
+func (p *versionProbes) count(image string) int {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.calls[image]
+}
+
+// waitRefreshed waits until image has been probed at least probes times and
+// no refresh of e's versions is running
+func waitRefreshed(t *testing.T, e *CodeExecutor, p *versionProbes, image string, probes int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for time.Now().Before(deadline) {
+		e.versions.refreshMutex.Lock()
+		refreshing := e.versions.refreshing
+		e.versions.refreshMutex.Unlock()
+		if !refreshing && p.count(image) >= probes {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("%s was probed %d times, want %d", image, p.count(image), probes)
+}
+
+// infoVersions returns the version LanguageInfos shows for each language
+func infoVersions(e *CodeExecutor) map[string]string {
+	versions := make(map[string]string)
+	for _, info := range e.LanguageInfos() {
+		versions[info.ID] = info.Version
+	}
+	return versions
+}
+
+// versionedLanguages are the test languages with version commands
+func versionedLanguages() map[string]config.LanguageConfig {
+	languages := testLanguages()
+	for key, langConfig := range languages {
+		langConfig.VersionCmd = []string{key, "--version"}
+		languages[key] = langConfig
+	}
+	return languages
+}
+
+func TestVersionsCached(t *testing.T) {
+	probes := newVersionProbes(map[string]string{"script:latest": "Script 1.0"})
+	rt := NewFakeRuntime()
+	rt.CompileFunc = probes.compile
+	e := newTestExecutor(t, rt, func(cfg *config.Config) {
+		cfg.Languages = versionedLanguages()
+	})
+	waitRefreshed(t, e, probes, "compiled:latest", 1)
+
+	// The failed probe leaves its language without a version
+	want := map[string]string{"script": "Script 1.0", "compiled": ""}
+	for i := 0; i < 3; i++ {
+		if got := infoVersions(e); !reflect.DeepEqual(got, want) {
+			t.Errorf("versions = %v, want %v", got, want)
+		}
+	}
+	if got := len(rt.Specs()); got != 2 {
+		t.Errorf("%d probes ran, want 2 at startup and none when listing languages", got)
+	}
+}
+
+func TestVersionsAfterReload(t *testing.T) {
+	probes := newVersionProbes(map[string]string{"script:latest": "Script 1.0", "script:2": "Script 2.0"})
+	rt := NewFakeRuntime()
+	rt.CompileFunc = probes.compile
+	e := newTestExecutor(t, rt, func(cfg *config.Config) {
+		cfg.Languages = versionedLanguages()
+	})
+	waitRefreshed(t, e, probes, "compiled:latest", 1)
+
+	languages := versionedLanguages()
+	script := languages["script"]
+	script.Image = "script:2"
+	languages["script"] = script
+	e.SetConfigLoader(func() (*config.Config, error) {
+		return &config.Config{Languages: languages}, nil
+	})
+
+	// Until the new image is probed its version is unknown, not the old one
+	release := probes.block("script:2")
+	if err := e.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := infoVersions(e)["script"]; got != "" {
+		t.Errorf("version before probing the new image = %q, want none", got)
+	}
+	release()
+	waitRefreshed(t, e, probes, "script:2", 1)
+	if got := infoVersions(e)["script"]; got != "Script 2.0" {
+		t.Errorf("version after the reload = %q, want Script 2.0", got)
+	}
+}
+
+func TestRefreshVersionsCoalesces(t *testing.T) {
+	probes := newVersionProbes(map[string]string{"script:latest": "Script 1.0"})
+	release := probes.block("script:latest")
+	rt := NewFakeRuntime()
+	rt.CompileFunc = probes.compile
+	e := newTestExecutor(t, rt, func(cfg *config.Config) {
+		languages := versionedLanguages()
+		delete(languages, "compiled")
+		cfg.Languages = languages
+	})
+
+	// While the startup refresh is stuck, further requests return at once
+	deadline := time.Now().Add(10 * time.Second)
+	for probes.count("script:latest") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the startup refresh did not probe")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	for i := 0; i < 3; i++ {
+		e.refreshVersions()
+	}
+	release()
+
+	// and are served by a single further refresh
+	waitRefreshed(t, e, probes, "script:latest", 2)
+	if got := probes.count("script:latest"); got != 2 {
+		t.Errorf("probed %d times, want 2", got)
+	}
+	if got := infoVersions(e)["script"]; got != "Script 1.0" {
+		t.Errorf("version = %q, want Script 1.0", got)
+	}
+}
@@ -0,0 +1,314 @@
+// Package judge decides whether a program's output is correct
+package judge
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// Comparator names accepted in models.TestCase.Comparator
+const (
+	ComparatorExact           = "exact"
+	ComparatorWhitespace      = "whitespace"
+	ComparatorLines           = "lines"
+	ComparatorCaseInsensitive = "case-insensitive"
+	ComparatorFloat           = "float"
+	ComparatorUnordered       = "unordered"
+	ComparatorRegex           = "regex"
+)
+
+// DefaultComparator is used when a test case does not name one
+const DefaultComparator = ComparatorLines
+
+// defaultEpsilon is the absolute tolerance of the float comparator when
+// neither tolerance is given
+const defaultEpsilon = 1e-6
+
+// Comparator checks a program's output against the expected output
+type Comparator interface {
+	// Compare returns nil if actual is acceptable, or a hint pointing at the
+	// first mismatch otherwise
+	Compare(expected, actual string) *models.DiffHint
+}
+
+// Options tunes the comparators that take parameters
+type Options struct {
+	AbsEpsilon float64 // Absolute tolerance of the float comparator
+	RelEpsilon float64 // Relative tolerance of the float comparator
+}
+
+// NewComparator returns the comparator called name. An empty name selects
+// DefaultComparator. For the regex comparator, pattern is the expected output
+// and is compiled up front so a bad pattern is reported early.
+func NewComparator(name string, options Options, pattern string) (Comparator, error) {
+	switch name {
+	case "", ComparatorLines:
+		return lineComparator{equal: func(a, b string) bool { return a == b }}, nil
+	case ComparatorExact:
+		return exactComparator{}, nil
+	case ComparatorWhitespace:
+		return tokenComparator{equal: func(a, b string) bool { return a == b }}, nil
+	case ComparatorCaseInsensitive:
+		return lineComparator{equal: strings.EqualFold}, nil
+	case ComparatorFloat:
+		if options.AbsEpsilon < 0 || options.RelEpsilon < 0 {
+			return nil, fmt.Errorf("float comparator: tolerances must not be negative")
+		}
+		if options.AbsEpsilon == 0 && options.RelEpsilon == 0 {
+			options.AbsEpsilon = defaultEpsilon
+		}
+		return tokenComparator{equal: options.floatEqual}, nil
+	case ComparatorUnordered:
+		return unorderedComparator{}, nil
+	case ComparatorRegex:
+		re, err := regexp.Compile(`^(?:` + pattern + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("regex comparator: %v", err)
+		}
+		return regexComparator{re: re}, nil
+	default:
+		return nil, fmt.Errorf("unknown comparator %q", name)
+	}
+}
+
+// exactComparator requires byte-for-byte equal output
+type exactComparator struct{}
+
+func (exactComparator) Compare(expected, actual string) *models.DiffHint {
+	if expected == actual {
+		return nil
+	}
+	return diffLines(strings.Split(expected, "\n"), strings.Split(actual, "\n"),
+		func(a, b string) bool { return a == b })
+}
+
+// lineComparator compares line by line, ignoring leading and trailing
+// whitespace on each line, Windows line endings and trailing blank lines
+type lineComparator struct {
+	equal func(a, b string) bool
+}
+
+func (c lineComparator) Compare(expected, actual string) *models.DiffHint {
+	return diffLines(normalizeLines(expected), normalizeLines(actual), c.equal)
+}
+
+// tokenComparator compares whitespace-separated tokens, ignoring how the
+// tokens are laid out on lines
+type tokenComparator struct {
+	equal func(a, b string) bool
+}
+
+func (c tokenComparator) Compare(expected, actual string) *models.DiffHint {
+	expectedTokens := tokenize(expected)
+	actualTokens := tokenize(actual)
+
+	for i := 0; i < len(expectedTokens) || i < len(actualTokens); i++ {
+		switch {
+		case i >= len(actualTokens):
+			last := lastPosition(actual)
+			return &models.DiffHint{
+				Line: last.line, Column: last.column,
+				Expected: expectedTokens[i].text,
+				Message:  "output ended early",
+			}
+		case i >= len(expectedTokens):
+			return &models.DiffHint{
+				Line: actualTokens[i].line, Column: actualTokens[i].column,
+				Actual:  actualTokens[i].text,
+				Message: "unexpected extra output",
+			}
+		case !c.equal(expectedTokens[i].text, actualTokens[i].text):
+			return &models.DiffHint{
+				Line: actualTokens[i].line, Column: actualTokens[i].column,
+				Expected: expectedTokens[i].text,
+				Actual:   actualTokens[i].text,
+				Message:  fmt.Sprintf("token %d differs", i+1),
+			}
+		}
+	}
+	return nil
+}
+
+// floatEqual treats two tokens as equal if they are numbers within tolerance,
+// or identical otherwise
+func (o Options) floatEqual(expected, actual string) bool {
+	if expected == actual {
+		return true
+	}
+
+	e, err1 := strconv.ParseFloat(expected, 64)
+	a, err2 := strconv.ParseFloat(actual, 64)
+	if err1 != nil || err2 != nil || math.IsNaN(a) {
+		return false
+	}
+
+	diff := math.Abs(e - a)
+	return diff <= o.AbsEpsilon || diff <= o.RelEpsilon*math.Abs(e)
+}
+
+// unorderedComparator accepts the expected lines in any order
+type unorderedComparator struct{}
+
+func (unorderedComparator) Compare(expected, actual string) *models.DiffHint {
+	remaining := make(map[string]int)
+	for _, line := range normalizeLines(expected) {
+		remaining[line]++
+	}
+
+	for i, line := range normalizeLines(actual) {
+		if remaining[line] == 0 {
+			return &models.DiffHint{
+				Line: i + 1, Column: 1,
+				Actual:  line,
+				Message: "line is not expected (or appears too often)",
+			}
+		}
+		remaining[line]--
+	}
+
+	// Report a missing line deterministically
+	var missing []string
+	for line, count := range remaining {
+		if count > 0 {
+			missing = append(missing, line)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		last := lastPosition(actual)
+		return &models.DiffHint{
+			Line: last.line, Column: last.column,
+			Expected: missing[0],
+			Message:  fmt.Sprintf("%d expected line(s) missing", len(missing)),
+		}
+	}
+	return nil
+}
+
+// regexComparator requires the whole output, without trailing whitespace, to
+// match a pattern
+type regexComparator struct {
+	re *regexp.Regexp
+}
+
+func (c regexComparator) Compare(expected, actual string) *models.DiffHint {
+	if c.re.MatchString(strings.TrimRightFunc(actual, unicode.IsSpace)) {
+		return nil
+	}
+	return &models.DiffHint{
+		Line: 1, Column: 1,
+		Expected: expected,
+		Message:  "output does not match the expected pattern",
+	}
+}
+
+// diffLines returns a hint for the first line where expected and actual differ
+func diffLines(expected, actual []string, equal func(a, b string) bool) *models.DiffHint {
+	for i := 0; i < len(expected) || i < len(actual); i++ {
+		switch {
+		case i >= len(actual):
+			return &models.DiffHint{
+				Line: i + 1, Column: 1,
+				Expected: expected[i],
+				Message:  "output ended early",
+			}
+		case i >= len(expected):
+			return &models.DiffHint{
+				Line: i + 1, Column: 1,
+				Actual:  actual[i],
+				Message: "unexpected extra output",
+			}
+		case !equal(expected[i], actual[i]):
+			return &models.DiffHint{
+				Line:     i + 1,
+				Column:   firstDifference(expected[i], actual[i]),
+				Expected: expected[i],
+				Actual:   actual[i],
+				Message:  "line differs",
+			}
+		}
+	}
+	return nil
+}
+
+// firstDifference returns the 1-based column of the first differing rune
+func firstDifference(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	column := 1
+	for column <= len(ar) && column <= len(br) && ar[column-1] == br[column-1] {
+		column++
+	}
+	return column
+}
+
+// normalizeLines splits text into lines with surrounding whitespace and
+// trailing empty lines removed
+func normalizeLines(text string) []string {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Trim(line, " \t\r")
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// token is a whitespace-separated word and where it starts
+type token struct {
+	text   string
+	line   int
+	column int
+}
+
+// position is a 1-based line and column
+type position struct {
+	line   int
+	column int
+}
+
+// tokenize splits text into whitespace-separated tokens with their positions
+func tokenize(text string) []token {
+	var tokens []token
+	line, column := 1, 1
+	start := -1
+	var startLine, startColumn int
+
+	for i, r := range text {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, token{text[start:i], startLine, startColumn})
+				start = -1
+			}
+		} else if start < 0 {
+			start, startLine, startColumn = i, line, column
+		}
+
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{text[start:], startLine, startColumn})
+	}
+	return tokens
+}
+
+// lastPosition returns the position just after the last non-space character
+func lastPosition(text string) position {
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+	if text == "" {
+		return position{1, 1}
+	}
+	lines := strings.Split(text, "\n")
+	return position{len(lines), len([]rune(lines[len(lines)-1])) + 1}
+}
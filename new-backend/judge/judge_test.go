@@ -0,0 +1,214 @@
+package judge
+
+import (
+	"testing"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// comparatorTest is one comparison and the hint it should produce, nil for
+// accepted output
+type comparatorTest struct {
+	name     string
+	expected string
+	actual   string
+	want     *models.DiffHint
+}
+
+func runComparatorTests(t *testing.T, comparator Comparator, tests []comparatorTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := comparator.Compare(tt.expected, tt.actual)
+			switch {
+			case tt.want == nil && got != nil:
+				t.Errorf("Compare(%q, %q) = %+v, want accepted", tt.expected, tt.actual, *got)
+			case tt.want != nil && got == nil:
+				t.Errorf("Compare(%q, %q) accepted, want %+v", tt.expected, tt.actual, *tt.want)
+			case tt.want != nil && *got != *tt.want:
+				t.Errorf("Compare(%q, %q) = %+v, want %+v", tt.expected, tt.actual, *got, *tt.want)
+			}
+		})
+	}
+}
+
+func newComparator(t *testing.T, name string, options Options) Comparator {
+	t.Helper()
+	comparator, err := NewComparator(name, options, "")
+	if err != nil {
+		t.Fatalf("NewComparator(%q): %v", name, err)
+	}
+	return comparator
+}
+
+func TestExactComparator(t *testing.T) {
+	runComparatorTests(t, newComparator(t, ComparatorExact, Options{}), []comparatorTest{
+		{"equal", "1 2\n3\n", "1 2\n3\n", nil},
+		{"empty", "", "", nil},
+		{"trailing space", "42\n", "42 \n", &models.DiffHint{
+			Line: 1, Column: 3, Expected: "42", Actual: "42 ", Message: "line differs"}},
+		{"missing newline", "42\n", "42", &models.DiffHint{
+			Line: 2, Column: 1, Expected: "", Message: "output ended early"}},
+		{"carriage return", "a\nb", "a\r\nb", &models.DiffHint{
+			Line: 1, Column: 2, Expected: "a", Actual: "a\r", Message: "line differs"}},
+		{"second line", "a\nb\n", "a\nc\n", &models.DiffHint{
+			Line: 2, Column: 1, Expected: "b", Actual: "c", Message: "line differs"}},
+	})
+}
+
+func TestLineComparator(t *testing.T) {
+	runComparatorTests(t, newComparator(t, ComparatorLines, Options{}), []comparatorTest{
+		{"equal", "1 2\n3\n", "1 2\n3\n", nil},
+		{"empty", "", "\n\n", nil},
+		{"trailing space", "42\n", "42 \t\n", nil},
+		{"leading space", "42\n", "  42\n", nil},
+		{"windows line endings", "a\nb\n", "a\r\nb\r\n", nil},
+		{"trailing blank lines", "ok\n", "ok\n\n\n", nil},
+		{"missing final newline", "ok\n", "ok", nil},
+		{"inner space", "a b\n", "a  b\n", &models.DiffHint{
+			Line: 1, Column: 3, Expected: "a b", Actual: "a  b", Message: "line differs"}},
+		{"blank line in between", "a\nb\n", "a\n\nb\n", &models.DiffHint{
+			Line: 2, Column: 1, Expected: "b", Message: "line differs"}},
+		{"hint shows trimmed lines", "  x\n", "y  \n", &models.DiffHint{
+			Line: 1, Column: 1, Expected: "x", Actual: "y", Message: "line differs"}},
+		{"case", "Yes\n", "yes\n", &models.DiffHint{
+			Line: 1, Column: 1, Expected: "Yes", Actual: "yes", Message: "line differs"}},
+		{"ended early", "1\n2\n", "1\n", &models.DiffHint{
+			Line: 2, Column: 1, Expected: "2", Message: "output ended early"}},
+		{"extra output", "1\n", "1\n2\n", &models.DiffHint{
+			Line: 2, Column: 1, Actual: "2", Message: "unexpected extra output"}},
+	})
+
+	if _, ok := newComparator(t, "", Options{}).(lineComparator); !ok {
+		t.Error("the default comparator does not compare lines")
+	}
+}
+
+func TestCaseInsensitiveComparator(t *testing.T) {
+	runComparatorTests(t, newComparator(t, ComparatorCaseInsensitive, Options{}), []comparatorTest{
+		{"equal", "yes\n", "yes\n", nil},
+		{"other case", "YES\nNo\n", "yes\nNO\n", nil},
+		{"non-ASCII", "Ärger\n", "äRGER\n", nil},
+		{"surrounding whitespace", "Hello World\n", " hello world \r\n\n", nil},
+		{"inner space", "Hello World\n", "hello  world\n", &models.DiffHint{
+			Line: 1, Column: 1, Expected: "Hello World", Actual: "hello  world", Message: "line differs"}},
+		{"different word", "yes\nyes\n", "YES\nno\n", &models.DiffHint{
+			Line: 2, Column: 1, Expected: "yes", Actual: "no", Message: "line differs"}},
+		{"ended early", "a\nb\n", "A\n", &models.DiffHint{
+			Line: 2, Column: 1, Expected: "b", Message: "output ended early"}},
+	})
+}
+
+func TestUnorderedComparator(t *testing.T) {
+	runComparatorTests(t, newComparator(t, ComparatorUnordered, Options{}), []comparatorTest{
+		{"same order", "a\nb\nc\n", "a\nb\nc\n", nil},
+		{"other order", "a\nb\nc\n", "c\na\nb", nil},
+		{"duplicates", "a\na\nb\n", "a\nb\na\n", nil},
+		{"surrounding whitespace", "a\nb\n", " b \r\na\n\n", nil},
+		{"empty", "", "", nil},
+		{"unexpected line", "a\nb\n", "a\nc\n", &models.DiffHint{
+			Line: 2, Column: 1, Actual: "c", Message: "line is not expected (or appears too often)"}},
+		{"line too often", "a\nb\n", "a\na\n", &models.DiffHint{
+			Line: 2, Column: 1, Actual: "a", Message: "line is not expected (or appears too often)"}},
+		{"missing lines", "c\na\nb\n", "b\n", &models.DiffHint{
+			Line: 1, Column: 2, Expected: "a", Message: "2 expected line(s) missing"}},
+		{"no output", "a\n", "", &models.DiffHint{
+			Line: 1, Column: 1, Expected: "a", Message: "1 expected line(s) missing"}},
+	})
+}
+
+func TestRegexComparator(t *testing.T) {
+	// run checks outputs against one pattern, which is also the expected output
+	run := func(t *testing.T, pattern string, tests []comparatorTest) {
+		comparator, err := NewComparator(ComparatorRegex, Options{}, pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range tests {
+			tests[i].expected = pattern
+		}
+		runComparatorTests(t, comparator, tests)
+	}
+	mismatch := func(pattern string) *models.DiffHint {
+		return &models.DiffHint{Line: 1, Column: 1, Expected: pattern, Message: "output does not match the expected pattern"}
+	}
+
+	run(t, `\d+`, []comparatorTest{
+		{"match", "", "12345", nil},
+		{"trailing whitespace", "", "12345 \r\n\n", nil},
+		{"leading whitespace", "", " 12345", mismatch(`\d+`)},
+		{"partial match", "", "abc123", mismatch(`\d+`)},
+		{"no match", "", "", mismatch(`\d+`)},
+	})
+	run(t, `yes|no`, []comparatorTest{
+		{"alternative", "", "no\n", nil},
+		{"anchored alternatives", "", "yesno", mismatch(`yes|no`)},
+	})
+	run(t, `(?s)start.*end`, []comparatorTest{
+		{"several lines", "", "start\n1\n2\nend\n", nil},
+	})
+
+	if _, err := NewComparator(ComparatorRegex, Options{}, "("); err == nil {
+		t.Error("NewComparator accepted a malformed pattern")
+	}
+}
+
+func TestWhitespaceComparator(t *testing.T) {
+	runComparatorTests(t, newComparator(t, ComparatorWhitespace, Options{}), []comparatorTest{
+		{"equal", "1 2 3\n", "1 2 3\n", nil},
+		{"different layout", "1 2 3\n", "1\n2\t 3", nil},
+		{"extra blank lines", "ok\n", "\n\nok\n\n", nil},
+		{"wrong token", "1 2 3\n", "1 2\n4\n", &models.DiffHint{
+			Line: 2, Column: 1, Expected: "3", Actual: "4", Message: "token 3 differs"}},
+		{"ended early", "1 2 3", "1 2", &models.DiffHint{
+			Line: 1, Column: 4, Expected: "3", Message: "output ended early"}},
+		{"extra output", "1", "1  2", &models.DiffHint{
+			Line: 1, Column: 4, Actual: "2", Message: "unexpected extra output"}},
+		{"numbers compared as text", "1.0", "1", &models.DiffHint{
+			Line: 1, Column: 1, Expected: "1.0", Actual: "1", Message: "token 1 differs"}},
+	})
+}
+
+func TestFloatComparator(t *testing.T) {
+	t.Run("default tolerance", func(t *testing.T) {
+		runComparatorTests(t, newComparator(t, ComparatorFloat, Options{}), []comparatorTest{
+			{"equal", "0.5 1.25", "0.5 1.25", nil},
+			{"within", "3.141593", "3.1415926", nil},
+			{"different notation", "1000", "1e3", nil},
+			{"outside", "1.0", "1.00001", &models.DiffHint{
+				Line: 1, Column: 1, Expected: "1.0", Actual: "1.00001", Message: "token 1 differs"}},
+			{"words must match", "YES 1.0", "yes 1.0", &models.DiffHint{
+				Line: 1, Column: 1, Expected: "YES", Actual: "yes", Message: "token 1 differs"}},
+			{"not a number", "1.0", "one", &models.DiffHint{
+				Line: 1, Column: 1, Expected: "1.0", Actual: "one", Message: "token 1 differs"}},
+			{"NaN", "nan", "NaN", &models.DiffHint{
+				Line: 1, Column: 1, Expected: "nan", Actual: "NaN", Message: "token 1 differs"}},
+		})
+	})
+
+	t.Run("absolute tolerance", func(t *testing.T) {
+		runComparatorTests(t, newComparator(t, ComparatorFloat, Options{AbsEpsilon: 0.01}), []comparatorTest{
+			{"within", "2.00", "2.009", nil},
+			{"outside", "2.00", "2.02", &models.DiffHint{
+				Line: 1, Column: 1, Expected: "2.00", Actual: "2.02", Message: "token 1 differs"}},
+		})
+	})
+
+	t.Run("relative tolerance", func(t *testing.T) {
+		runComparatorTests(t, newComparator(t, ComparatorFloat, Options{RelEpsilon: 1e-3}), []comparatorTest{
+			{"large within", "1000000", "1000900", nil},
+			{"small outside", "0.001", "0.0011", &models.DiffHint{
+				Line: 1, Column: 1, Expected: "0.001", Actual: "0.0011", Message: "token 1 differs"}},
+		})
+	})
+
+	if _, err := NewComparator(ComparatorFloat, Options{AbsEpsilon: -1}, ""); err == nil {
+		t.Error("NewComparator accepted a negative tolerance")
+	}
+}
+
+func TestNewComparatorUnknown(t *testing.T) {
+	if _, err := NewComparator("fuzzy", Options{}, ""); err == nil {
+		t.Error(`NewComparator("fuzzy") succeeded, want an error`)
+	}
+}
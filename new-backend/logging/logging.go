@@ -0,0 +1,82 @@
+// Package logging sets up the server's structured logger and carries
+// per-submission loggers through contexts
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// logContent is set when code and program input may be logged verbatim
+var logContent atomic.Bool
+
+// Setup installs the logger described by cfg as the default, writing to w.
+// Output of the standard log package goes through it as well.
+func Setup(cfg config.LogConfig, w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("log level: %w", err)
+	}
+
+	options := &slog.HandlerOptions{Level: level, AddSource: level <= slog.LevelDebug}
+	var handler slog.Handler
+	switch cfg.Format {
+	case config.LogJSON:
+		handler = slog.NewJSONHandler(w, options)
+	case config.LogText:
+		handler = slog.NewTextHandler(w, options)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	logContent.Store(cfg.Content)
+	return nil
+}
+
+// ForSubmission returns a logger that tags every line with the submission,
+// its language and its user
+func ForSubmission(logger *slog.Logger, submission *models.CodeSubmission) *slog.Logger {
+	return logger.With(
+		"submission", submission.ID,
+		"language", submission.Language,
+		"user", submission.UserID,
+	)
+}
+
+// Content returns an attribute for submitted code or program input. Unless
+// content logging is enabled only its size is logged, since it may hold
+// answers or personal data.
+func Content(key, value string) slog.Attr {
+	if logContent.Load() {
+		return slog.String(key, value)
+	}
+	return slog.String(key, fmt.Sprintf("[redacted %d bytes]", len(value)))
+}
+
+// Err returns the conventional attribute for an error
+func Err(err error) slog.Attr {
+	return slog.Any("error", err)
+}
+
+// contextKey keys the logger stored in a context
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying logger
+func NewContext(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger stored by NewContext, or the default logger
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
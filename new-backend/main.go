@@ -2,11 +2,13 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
@@ -14,56 +16,99 @@ import (
 	"github.com/ishikabhoyar/monaco/new-backend/api"
 	"github.com/ishikabhoyar/monaco/new-backend/config"
 	"github.com/ishikabhoyar/monaco/new-backend/executor"
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
+	"github.com/ishikabhoyar/monaco/new-backend/store"
+	"github.com/ishikabhoyar/monaco/new-backend/tracing"
 	"github.com/ishikabhoyar/monaco/new-backend/utils"
-	"github.com/rs/cors"
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv("MONACO_CONFIG"), "path to a JSON or YAML config file")
+	flag.Parse()
+
+	// Load configuration; until it is loaded, logs use the default text format
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		fatal("failed to load configuration", logging.Err(err))
+	}
+	if err := executor.ValidateLanguages(cfg.Languages); err != nil {
+		fatal("failed to load configuration", logging.Err(err))
+	}
+
 	// Configure logging
-	log.SetFlags(log.LstdFlags | log.Lshortfile | log.Lmicroseconds)
-	log.Println("Starting Monaco Code Execution Server...")
+	if err := logging.Setup(cfg.Log, os.Stderr); err != nil {
+		fatal("failed to configure logging", logging.Err(err))
+	}
+	slog.Info("starting Monaco code execution server",
+		"workers", cfg.Executor.ConcurrentExecutions, "queueCapacity", cfg.Executor.QueueCapacity)
+
+	// Export traces if configured
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		fatal("failed to configure tracing", logging.Err(err))
+	}
+	if cfg.Tracing.Enabled {
+		slog.Info("tracing enabled", "endpoint", describeEndpoint(cfg.Tracing.Endpoint), "sampleRatio", cfg.Tracing.SampleRatio)
+	}
 
 	// Check if Docker is available
 	if !utils.DockerAvailable() {
-		log.Fatal("Docker is required but not available on this system")
+		fatal("Docker is required but not available on this system")
 	}
 
-	// Load configuration
-	cfg := config.GetConfig()
-	log.Printf("Loaded configuration (max workers: %d, queue capacity: %d)",
-		cfg.Executor.ConcurrentExecutions, cfg.Executor.QueueCapacity)
+	// Open the submission store
+	submissionStore, err := store.Open(cfg.Store)
+	if err != nil {
+		fatal("failed to open submission store", logging.Err(err))
+	}
+	defer submissionStore.Close()
+	slog.Info("opened submission store", "backend", cfg.Store.Backend)
 
 	// Initialize code executor
-	codeExecutor := executor.NewCodeExecutor(cfg)
-	log.Println("Code executor initialized")
+	codeExecutor := executor.NewCodeExecutor(cfg, submissionStore)
+	codeExecutor.SetConfigLoader(func() (*config.Config, error) {
+		return config.Load(*configPath)
+	})
+
+	// Reload language configuration on SIGHUP
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
+	go func() {
+		for range reload {
+			slog.Info("received SIGHUP, reloading configuration")
+			if err := codeExecutor.Reload(); err != nil {
+				slog.Error("configuration reload failed", logging.Err(err))
+			}
+		}
+	}()
 
 	// Initialize API handler
-	handler := api.NewHandler(codeExecutor)
-	
+	handler, err := api.NewHandler(codeExecutor, cfg)
+	if err != nil {
+		fatal("failed to initialize API handler", logging.Err(err))
+	}
+	if cfg.Auth.Enabled {
+		slog.Info("authentication enabled", "apiKeys", len(cfg.Auth.APIKeys), "jwt", describeJWT(cfg.Auth.JWT))
+	} else {
+		slog.Warn("authentication disabled: all API routes are open")
+	}
+	slog.Info("configured allowed origins", "origins", strings.Join(cfg.Server.AllowedOrigins, ", "))
+
 	// Setup router with middleware
 	router := mux.NewRouter()
-	
+
 	// Register API routes
 	handler.RegisterRoutes(router)
-	
+
 	// Add a simple welcome route
 	router.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Monaco Code Execution Server v1.0.0")
 	})
-	
-	// Configure CORS
-	corsHandler := cors.New(cors.Options{
-		AllowedOrigins:   []string{"*"}, // For development - restrict in production
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
-		AllowCredentials: true,
-		MaxAge:           300, // Maximum cache time for preflight requests
-	})
 
 	// Create server with timeouts
 	server := &http.Server{
 		Addr:         ":" + cfg.Server.Port,
-		Handler:      corsHandler.Handler(router),
+		Handler:      handler.CORS(router),
 		ReadTimeout:  cfg.Server.ReadTimeout,
 		WriteTimeout: cfg.Server.WriteTimeout,
 		IdleTimeout:  cfg.Server.IdleTimeout,
@@ -75,15 +120,15 @@ func main() {
 
 	// Start server in a goroutine
 	go func() {
-		log.Printf("Server listening on port %s", cfg.Server.Port)
+		slog.Info("server listening", "port", cfg.Server.Port)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Error starting server: %v", err)
+			fatal("error starting server", logging.Err(err))
 		}
 	}()
 
 	// Wait for interrupt signal
 	<-stop
-	log.Println("Shutting down server...")
+	slog.Info("shutting down server")
 
 	// Create context with timeout for graceful shutdown
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -91,8 +136,33 @@ func main() {
 
 	// Shutdown server gracefully
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server shutdown error: %v", err)
+		fatal("server shutdown error", logging.Err(err))
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Warn("failed to flush traces", logging.Err(err))
+	}
+
+	slog.Info("server stopped gracefully")
+}
+
+// fatal logs an error and exits, like log.Fatal
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
+// describeEndpoint names the collector traces are sent to, for the startup log
+func describeEndpoint(endpoint string) string {
+	if endpoint == "" {
+		return "default"
 	}
+	return endpoint
+}
 
-	log.Println("Server stopped gracefully")
+// describeJWT summarizes how bearer tokens are verified, for the startup log
+func describeJWT(cfg config.JWTConfig) string {
+	if cfg.Algorithm == "" {
+		return "disabled"
+	}
+	return cfg.Algorithm
 }
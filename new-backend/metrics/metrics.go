@@ -0,0 +1,102 @@
+// Package metrics defines the Prometheus metrics exported on /metrics
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "monaco"
+
+// durationBuckets covers compile and run times from 50ms to about 100s
+var durationBuckets = prometheus.ExponentialBuckets(0.05, 2, 12)
+
+var (
+	// QueueDepth is the number of submissions waiting for a worker
+	QueueDepth = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Submissions waiting for a worker.",
+	})
+
+	// Workers is the number of execution workers
+	Workers = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers",
+		Help:      "Execution workers started.",
+	})
+
+	// WorkersBusy is the number of workers handling a submission
+	WorkersBusy = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "workers_busy",
+		Help:      "Workers currently handling a submission.",
+	})
+
+	// Submissions counts finished submissions
+	Submissions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "submissions_total",
+		Help:      "Finished submissions by language and final status.",
+	}, []string{"language", "status"})
+
+	// SubmissionsRejected counts submissions refused before being queued
+	SubmissionsRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "submissions_rejected_total",
+		Help:      "Submissions refused before being queued, by reason.",
+	}, []string{"reason"})
+
+	// CompileDuration is how long compile steps take
+	CompileDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "compile_duration_seconds",
+		Help:      "Time spent compiling programs, by language.",
+		Buckets:   durationBuckets,
+	}, []string{"language"})
+
+	// RunDuration is how long submissions take to run once compiled
+	RunDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "run_duration_seconds",
+		Help:      "Wall time of submission runs, including all test cases, by language.",
+		Buckets:   durationBuckets,
+	}, []string{"language"})
+
+	// Timeouts counts runs killed for exceeding their time limit
+	Timeouts = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "timeouts_total",
+		Help:      "Runs and test case runs that hit their time limit, by language.",
+	}, []string{"language"})
+
+	// WebSocketConnections is the number of open terminal connections
+	WebSocketConnections = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "websocket_connections",
+		Help:      "Open terminal WebSocket connections.",
+	})
+
+	// DockerFailures counts docker CLI invocations that failed for reasons
+	// other than the sandboxed program's own exit code
+	DockerFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "docker_failures_total",
+		Help:      "Failed docker CLI invocations, by operation.",
+	}, []string{"operation"})
+
+	// HTTPRequests counts API requests
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route, method and status code.",
+	}, []string{"route", "method", "code"})
+
+	// HTTPDuration is how long API requests take to serve
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests, by route and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method"})
+)
@@ -0,0 +1,14 @@
+package models
+
+// LanguageInfo describes a supported language to clients
+type LanguageInfo struct {
+	ID            string `json:"id"`
+	Name          string `json:"name"`
+	Version       string `json:"version,omitempty"` // As reported by the toolchain; missing until probed or if probing failed
+	Image         string `json:"image"`
+	FileExtension string `json:"fileExtension"`
+	Compiled      bool   `json:"compiled"`
+	MemoryLimit   string `json:"memoryLimit"`
+	CPULimit      string `json:"cpuLimit"`
+	TimeoutSec    int    `json:"timeoutSec"`
+}
@@ -6,18 +6,136 @@ import (
 
 // CodeSubmission represents a code submission for execution
 type CodeSubmission struct {
-	ID          string    `json:"id"`
-	Code        string    `json:"code"`
-	Language    string    `json:"language"`
-	Input       string    `json:"input,omitempty"`
-	Status      string    `json:"status"` // "queued", "running", "completed", "failed"
-	QueuedAt    time.Time `json:"queuedAt"`
-	StartedAt   time.Time `json:"startedAt,omitempty"`
-	CompletedAt time.Time `json:"completedAt,omitempty"`
-	Output      string    `json:"output"`
-	Memory      string    `json:"memory,omitempty"`     // Memory usage statistics
-	CPU         string    `json:"cpu,omitempty"`        // CPU usage statistics
-	ExecutionTime float64 `json:"executionTime,omitempty"` // Execution time in seconds
+	ID            string           `json:"id"`
+	Code          string           `json:"code"`
+	Language      string           `json:"language"`
+	UserID        string           `json:"userId,omitempty"`   // Submitter; queued submissions of different users take turns
+	Priority      Priority         `json:"priority,omitempty"` // Scheduling class, defaults to "normal"
+	Input         string           `json:"input,omitempty"`
+	TestCases     []TestCase       `json:"testCases,omitempty"`  // When set, the submission is judged instead of run interactively
+	Checker       *Program         `json:"checker,omitempty"`    // Custom checker that replaces the test cases' comparators
+	Interactor    *Program         `json:"interactor,omitempty"` // Interactor that talks to the solution and judges it
+	Status        string           `json:"status"`               // "queued", "running", "completed", "failed", "cancelled"
+	QueuedAt      time.Time        `json:"queuedAt"`
+	StartedAt     time.Time        `json:"startedAt,omitempty"`
+	CompletedAt   time.Time        `json:"completedAt,omitempty"`
+	Output        string           `json:"output"`
+	Memory        string           `json:"memory,omitempty"`        // Peak memory, human readable
+	CPU           string           `json:"cpu,omitempty"`           // CPU time, human readable
+	PeakMemory    int64            `json:"peakMemory,omitempty"`    // Peak memory of the program in bytes, the highest over all test cases
+	CPUTime       float64          `json:"cpuTime,omitempty"`       // User plus system CPU time in seconds, summed over test cases
+	ExecutionTime float64          `json:"executionTime,omitempty"` // Wall time of the program itself in seconds, summed over test cases
+	CompileTime   float64          `json:"compileTime,omitempty"`   // Time spent compiling, in seconds
+	RunTime       float64          `json:"runTime,omitempty"`       // Time spent running, summed over test cases, in seconds
+	Verdict       Verdict          `json:"verdict,omitempty"`       // Overall verdict of a judged submission
+	Score         float64          `json:"score,omitempty"`         // Points earned over all test cases
+	MaxScore      float64          `json:"maxScore,omitempty"`      // Points available over all test cases
+	TestResults   []TestCaseResult `json:"testResults,omitempty"`
+	Exit          *ExitInfo        `json:"exit,omitempty"` // How the program ended, for submissions run without test cases
+}
+
+// ExitInfo describes how a program ended
+type ExitInfo struct {
+	ExitCode  int    `json:"exitCode"`
+	Signal    string `json:"signal,omitempty"` // Terminating signal, e.g. "SIGSEGV"
+	OOMKilled bool   `json:"oomKilled"`        // Killed for exceeding its memory limit
+	TimedOut  bool   `json:"timedOut"`         // Killed for exceeding its time limit
+}
+
+// Priority is a scheduling class. Queued submissions of a higher class always
+// run before those of a lower one.
+type Priority string
+
+// Priority classes, highest first
+const (
+	PriorityHigh   Priority = "high"   // e.g. graded exam submissions
+	PriorityNormal Priority = "normal" // the default
+	PriorityLow    Priority = "low"    // e.g. practice runs
+)
+
+// Verdict is the outcome of judging a test case
+type Verdict string
+
+// Standard verdicts
+const (
+	VerdictAccepted            Verdict = "accepted"
+	VerdictWrongAnswer         Verdict = "wrong_answer"
+	VerdictTimeLimitExceeded   Verdict = "time_limit_exceeded"
+	VerdictMemoryLimitExceeded Verdict = "memory_limit_exceeded"
+	VerdictRuntimeError        Verdict = "runtime_error"
+	VerdictCompilationError    Verdict = "compilation_error"
+	VerdictJudgeError          Verdict = "judge_error" // The checker itself failed
+)
+
+// Program is source code in one of the configured languages, e.g. a checker
+type Program struct {
+	Language string `json:"language"`
+	Code     string `json:"code"`
+}
+
+// TestCase is an input and the output a correct program produces for it
+type TestCase struct {
+	ID             string  `json:"id,omitempty"`
+	Input          string  `json:"input"`
+	ExpectedOutput string  `json:"expectedOutput"`
+	TimeLimitMs    int     `json:"timeLimitMs,omitempty"` // Defaults to the language timeout
+	MemoryLimit    string  `json:"memoryLimit,omitempty"` // Docker notation, e.g. "64m"; defaults to the language limit
+	Points         float64 `json:"points,omitempty"`      // Weight of the test case, defaults to 1
+	Comparator     string  `json:"comparator,omitempty"`  // How output is compared, see package judge; defaults to "lines"
+	AbsEpsilon     float64 `json:"absEpsilon,omitempty"`  // Absolute tolerance for the "float" comparator
+	RelEpsilon     float64 `json:"relEpsilon,omitempty"`  // Relative tolerance for the "float" comparator
+}
+
+// TestCaseResult is the verdict for a single test case
+type TestCaseResult struct {
+	ID            string    `json:"id,omitempty"`
+	Verdict       Verdict   `json:"verdict"`
+	Output        string    `json:"output"`
+	Error         string    `json:"error,omitempty"`         // Standard error or compiler output
+	ExecutionTime float64   `json:"executionTime,omitempty"` // Wall time of the program in seconds
+	CPUTime       float64   `json:"cpuTime,omitempty"`       // User plus system CPU time in seconds
+	PeakMemory    int64     `json:"peakMemory,omitempty"`    // Peak memory in bytes
+	Score         float64   `json:"score"`
+	Hint          *DiffHint `json:"hint,omitempty"`          // Where the output first differs, for wrong answers
+	CheckerOutput string    `json:"checkerOutput,omitempty"` // Comment printed by a custom checker
+	Exit          *ExitInfo `json:"exit,omitempty"`          // How the program ended, if it ran
+}
+
+// DiffHint points at the first place a program's output differs from the expected output
+type DiffHint struct {
+	Line     int    `json:"line"`   // 1-based line in the program's output
+	Column   int    `json:"column"` // 1-based column in the program's output
+	Expected string `json:"expected,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	Message  string `json:"message"`
+}
+
+// SubmissionRequest is the body of a code submission. It holds only what a
+// client chooses; the ID, status, results and measurements of a submission
+// are set by the server.
+type SubmissionRequest struct {
+	Code       string     `json:"code"`
+	Language   string     `json:"language"`
+	UserID     string     `json:"userId,omitempty"`
+	Priority   Priority   `json:"priority,omitempty"`
+	Input      string     `json:"input,omitempty"`
+	TestCases  []TestCase `json:"testCases,omitempty"`
+	Checker    *Program   `json:"checker,omitempty"`
+	Interactor *Program   `json:"interactor,omitempty"`
+}
+
+// Submission returns a new submission made from the request
+func (r SubmissionRequest) Submission() *CodeSubmission {
+	return &CodeSubmission{
+		Code:       r.Code,
+		Language:   r.Language,
+		UserID:     r.UserID,
+		Priority:   r.Priority,
+		Input:      r.Input,
+		TestCases:  r.TestCases,
+		Checker:    r.Checker,
+		Interactor: r.Interactor,
+	}
 }
 
 // SubmissionResponse is the response returned after submitting code
@@ -1,15 +1,17 @@
 package models
 
+import "time"
+
 // WebSocketMessage represents a message sent over WebSockets
 type WebSocketMessage struct {
-	Type    string      `json:"type"` 
+	Type    string      `json:"type"`
 	Content interface{} `json:"content"`
 }
 
 // OutputMessage is sent when program produces output
 type OutputMessage struct {
-	Text string `json:"text"`
-	IsError bool `json:"isError"`
+	Text    string `json:"text"`
+	IsError bool   `json:"isError"`
 }
 
 // InputMessage is sent when user provides input
@@ -19,9 +21,33 @@ type InputMessage struct {
 
 // StatusUpdateMessage is sent when execution status changes
 type StatusUpdateMessage struct {
-	Status string `json:"status"`
-	Memory string `json:"memory,omitempty"`
-	CPU    string `json:"cpu,omitempty"`
+	Status         string     `json:"status"`
+	Memory         string     `json:"memory,omitempty"`
+	CPU            string     `json:"cpu,omitempty"`
+	PeakMemory     int64      `json:"peakMemory,omitempty"`
+	CPUTime        float64    `json:"cpuTime,omitempty"`
+	ExecutionTime  float64    `json:"executionTime,omitempty"`
+	QueuePosition  int        `json:"queuePosition,omitempty"`  // 1-based position while queued
+	EstimatedStart *time.Time `json:"estimatedStart,omitempty"` // Expected start while queued
+}
+
+// TestResultMessage is sent when a test case has been judged
+type TestResultMessage struct {
+	Index  int            `json:"index"`
+	Result TestCaseResult `json:"result"`
+}
+
+// TranscriptMessage is sent for every chunk exchanged between a solution and
+// its interactor
+type TranscriptMessage struct {
+	Index int    `json:"index"` // Test case index
+	From  string `json:"from"`  // "solution" or "interactor"
+	Text  string `json:"text"`
+}
+
+// ExitMessage is sent when a program ends
+type ExitMessage struct {
+	ExitInfo
 }
 
 // ErrorMessage is sent when an error occurs
@@ -71,6 +97,42 @@ func NewStatusMessage(status, memory, cpu string) WebSocketMessage {
 	}
 }
 
+// NewQueuedStatusMessage creates a status update for a submission waiting in the queue
+func NewQueuedStatusMessage(position int, estimatedStart time.Time) WebSocketMessage {
+	return WebSocketMessage{
+		Type: "status",
+		Content: StatusUpdateMessage{
+			Status:         "queued",
+			QueuePosition:  position,
+			EstimatedStart: &estimatedStart,
+		},
+	}
+}
+
+// NewFinalStatusMessage creates the status update sent when a submission
+// finishes, including what its program consumed
+func NewFinalStatusMessage(submission *CodeSubmission) WebSocketMessage {
+	return WebSocketMessage{
+		Type: "status",
+		Content: StatusUpdateMessage{
+			Status:        submission.Status,
+			Memory:        submission.Memory,
+			CPU:           submission.CPU,
+			PeakMemory:    submission.PeakMemory,
+			CPUTime:       submission.CPUTime,
+			ExecutionTime: submission.ExecutionTime,
+		},
+	}
+}
+
+// NewExitMessage creates a message describing how a program ended
+func NewExitMessage(exit ExitInfo) WebSocketMessage {
+	return WebSocketMessage{
+		Type:    "exit",
+		Content: ExitMessage{exit},
+	}
+}
+
 // NewErrorMessage creates an error message
 func NewErrorMessage(errorType, message string) WebSocketMessage {
 	return WebSocketMessage{
@@ -89,3 +151,26 @@ func NewSystemMessage(message string) WebSocketMessage {
 		Content: message,
 	}
 }
+
+// NewTestResultMessage creates a message reporting the verdict of one test case
+func NewTestResultMessage(index int, result TestCaseResult) WebSocketMessage {
+	return WebSocketMessage{
+		Type: "test_result",
+		Content: TestResultMessage{
+			Index:  index,
+			Result: result,
+		},
+	}
+}
+
+// NewTranscriptMessage creates a message carrying data sent during an interactive run
+func NewTranscriptMessage(index int, from, text string) WebSocketMessage {
+	return WebSocketMessage{
+		Type: "transcript",
+		Content: TranscriptMessage{
+			Index: index,
+			From:  from,
+			Text:  text,
+		},
+	}
+}
@@ -0,0 +1,136 @@
+// Package ratelimit implements token bucket rate limiting per client key
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled completely are
+// dropped, so idle clients do not accumulate
+const sweepInterval = time.Minute
+
+// Limiter hands out tokens from one bucket per key. Each bucket holds up to
+// burst tokens and refills at a steady rate. A nil Limiter allows everything.
+type Limiter struct {
+	rate      float64 // Tokens added per second
+	burst     int
+	mutex     sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time // Clock, replaced in tests
+}
+
+// bucket is the state of a single key
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Result describes the state of a bucket after a call to Allow
+type Result struct {
+	Allowed    bool
+	Limit      int           // Size of the bucket
+	Remaining  int           // Whole tokens left
+	RetryAfter time.Duration // Until the next token is available, if not allowed
+	Reset      time.Duration // Until the bucket is full again
+}
+
+// New creates a limiter allowing perMinute requests per key on average and
+// bursts of up to burst requests. It returns nil if perMinute is not positive.
+func New(perMinute, burst int) *Limiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:      float64(perMinute) / 60,
+		burst:     burst,
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// Allow takes a token from the bucket of key if one is available
+func (l *Limiter) Allow(key string) Result {
+	if l == nil {
+		return Result{Allowed: true}
+	}
+
+	now := l.now()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweep(now)
+	}
+
+	b := l.refill(key, now)
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     l.burst,
+		Remaining: int(math.Floor(b.tokens)),
+		Reset:     l.duration(float64(l.burst) - b.tokens),
+	}
+	if !allowed {
+		result.RetryAfter = l.duration(1 - b.tokens)
+	}
+	return result
+}
+
+// Refund returns a token taken by Allow, for requests rejected by another
+// limit after this one let them through
+func (l *Limiter) Refund(key string) {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if b, exists := l.buckets[key]; exists {
+		b.tokens = math.Min(b.tokens+1, float64(l.burst))
+	}
+}
+
+// refill returns the bucket of key topped up for the time since its last use
+func (l *Limiter) refill(key string, now time.Time) *bucket {
+	b, exists := l.buckets[key]
+	if !exists {
+		b = &bucket{tokens: float64(l.burst), updated: now}
+		l.buckets[key] = b
+		return b
+	}
+
+	elapsed := now.Sub(b.updated).Seconds()
+	b.tokens = math.Min(b.tokens+elapsed*l.rate, float64(l.burst))
+	b.updated = now
+	return b
+}
+
+// sweep drops buckets that would be full by now; a new bucket starts full
+func (l *Limiter) sweep(now time.Time) {
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.rate >= float64(l.burst) {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
+
+// duration returns how long it takes to gain tokens
+func (l *Limiter) duration(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / l.rate * float64(time.Second))
+}
@@ -0,0 +1,177 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when told to
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// newTestLimiter creates a limiter driven by a fake clock
+func newTestLimiter(perMinute, burst int) (*Limiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(perMinute, burst)
+	l.now = clock.Now
+	l.lastSweep = clock.now
+	return l, clock
+}
+
+// allowN calls Allow n times and returns how many calls were allowed
+func allowN(l *Limiter, key string, n int) int {
+	allowed := 0
+	for i := 0; i < n; i++ {
+		if l.Allow(key).Allowed {
+			allowed++
+		}
+	}
+	return allowed
+}
+
+func TestBurst(t *testing.T) {
+	l, _ := newTestLimiter(60, 5)
+
+	for i := 0; i < 5; i++ {
+		result := l.Allow("client")
+		if !result.Allowed {
+			t.Fatalf("request %d rejected within the burst", i+1)
+		}
+		if result.Limit != 5 || result.Remaining != 4-i {
+			t.Errorf("request %d: limit %d remaining %d, want 5 and %d", i+1, result.Limit, result.Remaining, 4-i)
+		}
+	}
+
+	result := l.Allow("client")
+	if result.Allowed {
+		t.Fatal("request beyond the burst allowed")
+	}
+	if result.Remaining != 0 {
+		t.Errorf("remaining = %d, want 0", result.Remaining)
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("retry after = %s, want 1s", result.RetryAfter)
+	}
+	if result.Reset != 5*time.Second {
+		t.Errorf("reset = %s, want 5s", result.Reset)
+	}
+}
+
+func TestRefill(t *testing.T) {
+	l, clock := newTestLimiter(30, 4) // A token every two seconds
+
+	if got := allowN(l, "client", 4); got != 4 {
+		t.Fatalf("allowed %d of the burst, want 4", got)
+	}
+
+	clock.Advance(time.Second)
+	result := l.Allow("client")
+	if result.Allowed {
+		t.Fatal("allowed after half a token refilled")
+	}
+	if result.RetryAfter != time.Second {
+		t.Errorf("retry after = %s, want 1s", result.RetryAfter)
+	}
+
+	clock.Advance(time.Second)
+	if !l.Allow("client").Allowed {
+		t.Fatal("rejected after a token refilled")
+	}
+	if l.Allow("client").Allowed {
+		t.Fatal("allowed a second request on one refilled token")
+	}
+
+	// A long idle period refills the bucket only up to the burst
+	clock.Advance(time.Hour)
+	if got := allowN(l, "client", 10); got != 4 {
+		t.Errorf("allowed %d after idling, want 4", got)
+	}
+}
+
+func TestPerKeyLimits(t *testing.T) {
+	l, clock := newTestLimiter(60, 2)
+
+	if got := allowN(l, "alice", 3); got != 2 {
+		t.Fatalf("alice allowed %d, want 2", got)
+	}
+	if got := allowN(l, "bob", 3); got != 2 {
+		t.Errorf("bob allowed %d after alice used her burst, want 2", got)
+	}
+
+	clock.Advance(time.Second)
+	if !l.Allow("alice").Allowed {
+		t.Error("alice rejected after her bucket refilled")
+	}
+	if got := allowN(l, "carol", 2); got != 2 {
+		t.Errorf("carol allowed %d, want 2", got)
+	}
+}
+
+func TestRefund(t *testing.T) {
+	l, _ := newTestLimiter(60, 2)
+
+	allowN(l, "client", 2)
+	l.Refund("client")
+	if !l.Allow("client").Allowed {
+		t.Fatal("refunded token not available")
+	}
+
+	// Refunds never fill a bucket beyond its burst
+	for i := 0; i < 5; i++ {
+		l.Refund("client")
+	}
+	if got := allowN(l, "client", 5); got != 2 {
+		t.Errorf("allowed %d after refunds, want 2", got)
+	}
+
+	// Refunding an unknown key does nothing
+	l.Refund("unknown")
+	if got := allowN(l, "unknown", 5); got != 2 {
+		t.Errorf("unknown key allowed %d, want 2", got)
+	}
+}
+
+func TestSweepDropsFullBuckets(t *testing.T) {
+	l, clock := newTestLimiter(60, 2)
+
+	allowN(l, "idle", 2)
+	clock.Advance(sweepInterval - 500*time.Millisecond)
+	allowN(l, "busy", 2)
+
+	// The next call sweeps: idle has refilled long ago, busy has half a token
+	clock.Advance(500 * time.Millisecond)
+	if l.Allow("busy").Allowed {
+		t.Fatal("busy allowed with half a token")
+	}
+	if _, exists := l.buckets["idle"]; exists {
+		t.Error("refilled bucket kept after a sweep")
+	}
+	if _, exists := l.buckets["busy"]; !exists {
+		t.Error("bucket in use dropped by a sweep")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	var l *Limiter
+	if l = New(0, 10); l != nil {
+		t.Fatal("New(0, 10) returned a limiter, want nil")
+	}
+	for i := 0; i < 100; i++ {
+		if !l.Allow("client").Allowed {
+			t.Fatal("nil limiter rejected a request")
+		}
+	}
+	l.Refund("client")
+}
+
+func TestMinimumBurst(t *testing.T) {
+	l, _ := newTestLimiter(60, 0)
+	if got := allowN(l, "client", 3); got != 1 {
+		t.Errorf("allowed %d with burst 0, want 1", got)
+	}
+}
@@ -0,0 +1,91 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// submissionsBucket holds the submissions, keyed by ID and encoded as JSON
+var submissionsBucket = []byte("submissions")
+
+// BoltStore keeps submissions in a BoltDB file so they survive restarts
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// OpenBoltStore opens the database at path, creating it if needed
+func OpenBoltStore(path string) (*BoltStore, error) {
+	// A second server on the same file would block forever without a timeout
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open submission store %s: %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(submissionsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize submission store %s: %w", path, err)
+	}
+
+	return &BoltStore{db: db}, nil
+}
+
+// Save writes submission to the database
+func (s *BoltStore) Save(submission *models.CodeSubmission) error {
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(submissionsBucket).Put([]byte(submission.ID), data)
+	})
+}
+
+// Get reads the submission with the given ID
+func (s *BoltStore) Get(id string) (*models.CodeSubmission, error) {
+	var submission *models.CodeSubmission
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(submissionsBucket).Get([]byte(id))
+		if data == nil {
+			return ErrNotFound
+		}
+		var err error
+		submission, err = decode(data)
+		return err
+	})
+	return submission, err
+}
+
+// Delete removes the submission with the given ID from the database
+func (s *BoltStore) Delete(id string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(submissionsBucket).Delete([]byte(id))
+	})
+}
+
+// ForEach calls fn for every submission in the database inside a single read
+// transaction
+func (s *BoltStore) ForEach(fn func(submission *models.CodeSubmission) error) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(submissionsBucket).ForEach(func(id, data []byte) error {
+			submission, err := decode(data)
+			if err != nil {
+				return fmt.Errorf("submission %s: %w", id, err)
+			}
+			return fn(submission)
+		})
+	})
+}
+
+// Close closes the database
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+func TestBoltStore(t *testing.T) {
+	s, err := OpenBoltStore(filepath.Join(t.TempDir(), "monaco.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testRoundTrip(t, s)
+}
+
+func TestBoltStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "monaco.db")
+	s, err := OpenBoltStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := testSubmission("kept")
+	for _, submission := range []*models.CodeSubmission{want, testSubmission("deleted")} {
+		if err := s.Save(submission); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Delete("deleted"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenBoltStore(path)
+	if err != nil {
+		t.Fatalf("reopening: %v", err)
+	}
+	defer s.Close()
+	got, err := s.Get("kept")
+	if err != nil {
+		t.Fatalf("Get after reopening: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get after reopening = %+v, want %+v", got, want)
+	}
+	if ids := storedIDs(t, s); !reflect.DeepEqual(ids, []string{"kept"}) {
+		t.Errorf("ForEach after reopening visited %v, want [kept]", ids)
+	}
+}
+
+func TestOpenBoltStoreErrors(t *testing.T) {
+	if _, err := OpenBoltStore(filepath.Join(t.TempDir(), "missing", "monaco.db")); err == nil {
+		t.Error("OpenBoltStore succeeded in a missing directory")
+	}
+}
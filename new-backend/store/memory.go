@@ -0,0 +1,154 @@
+package store
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// sweepInterval is how often the memory store drops expired submissions
+const sweepInterval = time.Minute
+
+// MemoryStore keeps submissions in memory, forgetting each one a fixed time
+// after it was last saved. Submissions are kept encoded, exactly as a
+// persistent store would return them.
+type MemoryStore struct {
+	ttl     time.Duration
+	now     func() time.Time // The clock, replaced by tests
+	entries map[string]memoryEntry
+	mutex   sync.RWMutex
+	stop    chan struct{}
+	once    sync.Once
+}
+
+// memoryEntry is a stored submission and when it expires
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time // Zero if it never expires
+}
+
+// NewMemoryStore creates a memory store whose submissions expire ttl after
+// their last save. A ttl of zero keeps them forever.
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	s := &MemoryStore{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]memoryEntry),
+		stop:    make(chan struct{}),
+	}
+	if ttl > 0 {
+		go s.sweep()
+	}
+	return s
+}
+
+// Save stores a copy of submission
+func (s *MemoryStore) Save(submission *models.CodeSubmission) error {
+	data, err := json.Marshal(submission)
+	if err != nil {
+		return err
+	}
+
+	entry := memoryEntry{data: data}
+	if s.ttl > 0 {
+		entry.expiresAt = s.now().Add(s.ttl)
+	}
+
+	s.mutex.Lock()
+	s.entries[submission.ID] = entry
+	s.mutex.Unlock()
+	return nil
+}
+
+// Get returns a copy of the submission with the given ID
+func (s *MemoryStore) Get(id string) (*models.CodeSubmission, error) {
+	s.mutex.RLock()
+	entry, exists := s.entries[id]
+	s.mutex.RUnlock()
+
+	if !exists || entry.expired(s.now()) {
+		return nil, ErrNotFound
+	}
+	return decode(entry.data)
+}
+
+// Delete forgets the submission with the given ID
+func (s *MemoryStore) Delete(id string) error {
+	s.mutex.Lock()
+	delete(s.entries, id)
+	s.mutex.Unlock()
+	return nil
+}
+
+// ForEach calls fn with a copy of every submission that has not expired
+func (s *MemoryStore) ForEach(fn func(submission *models.CodeSubmission) error) error {
+	// Copy the entries first so the lock is not held while fn runs
+	now := s.now()
+	s.mutex.RLock()
+	data := make([][]byte, 0, len(s.entries))
+	for _, entry := range s.entries {
+		if !entry.expired(now) {
+			data = append(data, entry.data)
+		}
+	}
+	s.mutex.RUnlock()
+
+	for _, d := range data {
+		submission, err := decode(d)
+		if err != nil {
+			return err
+		}
+		if err := fn(submission); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close stops the background sweep
+func (s *MemoryStore) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	return nil
+}
+
+// sweep periodically drops expired submissions
+func (s *MemoryStore) sweep() {
+	ticker := time.NewTicker(sweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.dropExpired()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// dropExpired deletes the submissions that have expired
+func (s *MemoryStore) dropExpired() {
+	now := s.now()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for id, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, id)
+		}
+	}
+}
+
+func (e memoryEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// decode restores a submission saved as JSON
+func decode(data []byte) (*models.CodeSubmission, error) {
+	var submission models.CodeSubmission
+	if err := json.Unmarshal(data, &submission); err != nil {
+		return nil, err
+	}
+	return &submission, nil
+}
@@ -0,0 +1,68 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestMemoryStore(t *testing.T) {
+	s := NewMemoryStore(0)
+	defer s.Close()
+	testRoundTrip(t, s)
+}
+
+func TestMemoryStoreTTL(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(time.Hour)
+	defer s.Close()
+	s.now = func() time.Time { return now }
+
+	s.Save(testSubmission("old"))
+	now = now.Add(30 * time.Minute)
+	s.Save(testSubmission("new"))
+	s.Save(testSubmission("refreshed"))
+	now = now.Add(20 * time.Minute)
+	s.Save(testSubmission("refreshed"))
+
+	// One hour after its save, "old" is still there
+	now = now.Add(10 * time.Minute)
+	if _, err := s.Get("old"); err != nil {
+		t.Errorf("Get at the end of the TTL: %v", err)
+	}
+
+	now = now.Add(time.Second)
+	if _, err := s.Get("old"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after the TTL: err = %v, want ErrNotFound", err)
+	}
+	if ids := storedIDs(t, s); !reflect.DeepEqual(ids, []string{"new", "refreshed"}) {
+		t.Errorf("ForEach visited %v, want [new refreshed]", ids)
+	}
+
+	// Saving again restarts the TTL
+	now = now.Add(30 * time.Minute)
+	if ids := storedIDs(t, s); !reflect.DeepEqual(ids, []string{"refreshed"}) {
+		t.Errorf("ForEach visited %v, want [refreshed]", ids)
+	}
+
+	// The sweep frees what has expired
+	s.dropExpired()
+	if len(s.entries) != 1 {
+		t.Errorf("%d entries after the sweep, want 1", len(s.entries))
+	}
+}
+
+func TestMemoryStoreWithoutTTL(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := NewMemoryStore(0)
+	defer s.Close()
+	s.now = func() time.Time { return now }
+
+	s.Save(testSubmission("a"))
+	now = now.Add(24 * 365 * time.Hour)
+	s.dropExpired()
+	if _, err := s.Get("a"); err != nil {
+		t.Errorf("Get a year later: %v", err)
+	}
+}
@@ -0,0 +1,42 @@
+// Package store keeps submissions and their results
+package store
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// ErrNotFound is returned for submissions the store does not have
+var ErrNotFound = errors.New("submission not found")
+
+// SubmissionStore saves submissions as they move through the queue.
+// Implementations are safe for concurrent use and hand out copies, so a
+// submission returned by Get is not affected by later saves.
+type SubmissionStore interface {
+	// Save creates or replaces the submission with the same ID
+	Save(submission *models.CodeSubmission) error
+	// Get returns the submission with the given ID, or ErrNotFound
+	Get(id string) (*models.CodeSubmission, error)
+	// Delete removes the submission with the given ID, if it exists
+	Delete(id string) error
+	// ForEach calls fn for every stored submission until fn returns an
+	// error. fn must not modify the store.
+	ForEach(fn func(submission *models.CodeSubmission) error) error
+	// Close releases the store's resources
+	Close() error
+}
+
+// Open creates the store selected by cfg
+func Open(cfg config.StoreConfig) (SubmissionStore, error) {
+	switch cfg.Backend {
+	case config.StoreMemory:
+		return NewMemoryStore(cfg.TTL), nil
+	case config.StoreBolt:
+		return OpenBoltStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("unknown store backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,106 @@
+package store
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+)
+
+// testSubmission returns a submission with most fields set
+func testSubmission(id string) *models.CodeSubmission {
+	queued := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &models.CodeSubmission{
+		ID:          id,
+		Code:        "print(input())",
+		Language:    "python",
+		UserID:      "alice",
+		Priority:    models.PriorityHigh,
+		TestCases:   []models.TestCase{{ID: "t1", Input: "1\n", ExpectedOutput: "1\n", Points: 2}},
+		Status:      "completed",
+		QueuedAt:    queued,
+		StartedAt:   queued.Add(time.Second),
+		CompletedAt: queued.Add(2 * time.Second),
+		PeakMemory:  1 << 20,
+		Verdict:     models.VerdictAccepted,
+		Score:       2,
+		MaxScore:    2,
+		TestResults: []models.TestCaseResult{{ID: "t1", Verdict: models.VerdictAccepted, Output: "1\n", Score: 2}},
+	}
+}
+
+// storedIDs returns the IDs ForEach visits, sorted
+func storedIDs(t *testing.T, s SubmissionStore) []string {
+	t.Helper()
+	var ids []string
+	err := s.ForEach(func(submission *models.CodeSubmission) error {
+		ids = append(ids, submission.ID)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ForEach: %v", err)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// testRoundTrip checks the behaviour every SubmissionStore shares
+func testRoundTrip(t *testing.T, s SubmissionStore) {
+	t.Helper()
+	want := testSubmission("a")
+	if err := s.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	got, err := s.Get("a")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+
+	// Copies go in and out
+	want.Status = "changed after saving"
+	got.Output = "changed after loading"
+	if again, _ := s.Get("a"); again.Status != "completed" || again.Output != "" {
+		t.Errorf("stored submission changed without a save: status %q, output %q", again.Status, again.Output)
+	}
+
+	// Save replaces
+	replaced := testSubmission("a")
+	replaced.Status = "failed"
+	if err := s.Save(replaced); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if got, _ := s.Get("a"); got.Status != "failed" {
+		t.Errorf("status after replacing = %q, want failed", got.Status)
+	}
+
+	if err := s.Save(testSubmission("b")); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	if ids := storedIDs(t, s); !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Errorf("ForEach visited %v, want [a b]", ids)
+	}
+	stop := errors.New("stop")
+	visited := 0
+	if err := s.ForEach(func(*models.CodeSubmission) error { visited++; return stop }); !errors.Is(err, stop) || visited != 1 {
+		t.Errorf("ForEach stopped after %d calls with %v, want 1 call and the callback's error", visited, err)
+	}
+
+	if err := s.Delete("a"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Get("a"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("unknown"); err != nil {
+		t.Errorf("Delete of an unknown submission: %v", err)
+	}
+	if _, err := s.Get("unknown"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of an unknown submission: err = %v, want ErrNotFound", err)
+	}
+}
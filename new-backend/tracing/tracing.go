@@ -0,0 +1,88 @@
+// Package tracing records OpenTelemetry spans that follow a submission from
+// its HTTP request through the queue, compilation, runs and persistence
+package tracing
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ishikabhoyar/monaco/new-backend/config"
+	"github.com/ishikabhoyar/monaco/new-backend/models"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.12.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates every span of the server. It follows the provider installed
+// by Setup, and records nothing until then.
+var tracer = otel.Tracer("github.com/ishikabhoyar/monaco/new-backend")
+
+// Setup exports spans to the OTLP/HTTP collector described by cfg. The
+// returned function flushes spans that are still buffered and should be
+// called before the server exits. When tracing is disabled nothing is
+// recorded and the function does nothing.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var options []otlptracehttp.Option
+	if cfg.Endpoint != "" {
+		options = append(options, otlptracehttp.WithEndpoint(cfg.Endpoint))
+	}
+	if cfg.Insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	exporter, err := otlptracehttp.New(ctx, options...)
+	if err != nil {
+		return nil, fmt.Errorf("OTLP exporter: %w", err)
+	}
+	return Install(exporter, cfg)
+}
+
+// Install records spans sampled as described by cfg and hands them to
+// exporter, e.g. the in-memory one of go.opentelemetry.io/otel/sdk/trace/tracetest.
+// Incoming W3C traceparent headers are honoured, so a caller's trace continues
+// into the server.
+func Install(exporter sdktrace.SpanExporter, cfg config.TracingConfig) (func(context.Context) error, error) {
+	res, err := resource.Merge(resource.Default(),
+		resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return provider.Shutdown, nil
+}
+
+// Start begins a span named name, a child of the span in ctx if there is one
+func Start(ctx context.Context, name string, options ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name, options...)
+}
+
+// Fail marks span as failed with err
+func Fail(span trace.Span, err error) {
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// Submission returns the attributes identifying a submission on its spans.
+// The user is left out, as trace backends are often less restricted than logs.
+func Submission(submission *models.CodeSubmission) trace.SpanStartEventOption {
+	return trace.WithAttributes(
+		attribute.String("monaco.submission.id", submission.ID),
+		attribute.String("monaco.submission.language", submission.Language),
+	)
+}
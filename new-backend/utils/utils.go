@@ -1,18 +1,20 @@
 package utils
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"os/exec"
 	"regexp"
 	"strings"
+
+	"github.com/ishikabhoyar/monaco/new-backend/logging"
 )
 
 // DockerAvailable checks if Docker is available on the system
 func DockerAvailable() bool {
 	cmd := exec.Command("docker", "--version")
 	if err := cmd.Run(); err != nil {
-		log.Printf("Docker not available: %v", err)
+		slog.Error("Docker not available", logging.Err(err))
 		return false
 	}
 	return true
@@ -28,7 +30,7 @@ func PullDockerImage(image string) error {
 	}
 
 	// Pull the image
-	log.Printf("Pulling Docker image: %s", image)
+	slog.Info("pulling Docker image", "image", image)
 	pullCmd := exec.Command("docker", "pull", image)
 	pullCmd.Stdout = os.Stdout
 	pullCmd.Stderr = os.Stderr